@@ -96,6 +96,7 @@ function createNewMeeting() {
       if (data.signalingServer) {
         sessionStorage.setItem('assignedSignalingServerUrl', data.signalingServer);
       }
+      storeJoinToken(data.joinToken);
       sessionStorage.setItem('meetingName', meetingName);
       sessionStorage.setItem('meetingId', data.meetingID);
       window.location.href = `../meeting/index.html?meetingID=${data.meetingID}`;
@@ -179,6 +180,7 @@ async function joinMeeting() {
     sessionStorage.setItem('meetingId', data.meetingID);
     sessionStorage.setItem('assignedSfuId', data.sfu);
     sessionStorage.setItem('assignedSignalingServerUrl', data.signalingServer);
+    storeJoinToken(data.joinToken);
 
     console.log("Join Meeting: ", data);
     
@@ -190,6 +192,15 @@ async function joinMeeting() {
   }
 }
 
+// Keep the join token the SFU verifies for this meeting; the meeting page sends it with joinMeeting
+function storeJoinToken(joinToken) {
+  if (joinToken) {
+    sessionStorage.setItem('joinToken', joinToken);
+  } else {
+    sessionStorage.removeItem('joinToken');
+  }
+}
+
 // Schedule a meeting (placeholder)
 function scheduleMeeting() {
   alert('Schedule meeting functionality coming soon!');
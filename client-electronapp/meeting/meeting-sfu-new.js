@@ -103,7 +103,7 @@ function setupCallbacks() {
     onNegotiationNeeded: async () => {
       try {
         const offer = await webrtcManager.createOffer();
-        signalingManager.sendOffer(offer.sdp);
+        signalingManager.sendOffer(offer.sdp, webrtcManager.getTrackSources());
         if (window.Logger) {
           window.Logger.info('WEBRTC', 'Offer sent to SFU successfully');
         }
@@ -125,7 +125,7 @@ function setupCallbacks() {
         window.Logger.info('SIGNALING', 'WebSocket connected, registering with signaling server');
       }
       signalingManager.register(window.AppState.userId, 'client');
-      signalingManager.joinMeeting(window.AppState.meetingId);
+      signalingManager.joinMeeting(window.AppState.meetingId, window.AppState.joinToken);
     },
     onMessage: (message) => {
       handleSignalingMessage(message);
@@ -187,6 +187,18 @@ async function handleSignalingMessage(message) {
       return;
     }
 
+    // STUN/TURN servers with credentials issued by the SFU
+    if (message.type === 'iceServers') {
+      webrtcManager.setIceServers(message.payload?.iceServers);
+      return;
+    }
+
+    // The SFU hands the meeting to another SFU; reconnect against it
+    if (message.type === 'sfuMigration') {
+      webrtcManager.migrateToSFU(message);
+      return;
+    }
+
     // Handle chat messages
     if (message.type === 'chat') {
       chatManager.handleIncomingMessage(message.payload);
@@ -318,7 +330,12 @@ window.toggleScreenShare = function() {
   const newState = !window.AppState.isScreenSharing;
   
   if (newState) {
-    mediaManager.getSharedScreenStream().then(() => {
+    mediaManager.getSharedScreenStream().then((screenStream) => {
+      if (!screenStream) {
+        return;
+      }
+      // Adding the screen track fires negotiationneeded; the offer marks it as the screen
+      webrtcManager.startScreenShare(screenStream);
       mediaManager.toggleScreenSharing(true);
       
       const screenShareBtn = document.getElementById('screenShareBtn');
@@ -330,6 +347,7 @@ window.toggleScreenShare = function() {
       }
     });
   } else {
+    webrtcManager.stopScreenShare();
     mediaManager.toggleScreenSharing(false);
     
     const screenShareBtn = document.getElementById('screenShareBtn');
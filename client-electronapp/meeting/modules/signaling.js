@@ -179,16 +179,24 @@ class SignalingManager {
     this.sendMessage('register', { id: userId, role: role });
   }
 
-  joinMeeting(meetingId) {
-    this.sendMessage('joinMeeting', { meetingId: meetingId });
+  joinMeeting(meetingId, joinToken) {
+    const payload = { meetingId: meetingId };
+    if (joinToken) {
+      payload.joinToken = joinToken;
+    }
+    this.sendMessage('joinMeeting', payload);
   }
 
   leaveMeeting(meetingId) {
     this.sendMessage('leaveMeeting', { meetingId: meetingId });
   }
 
-  sendOffer(sdp) {
-    this.sendMessage('offer', { sdp: sdp });
+  sendOffer(sdp, trackSources) {
+    const payload = { sdp: sdp };
+    if (trackSources && Object.keys(trackSources).length > 0) {
+      payload.trackSources = trackSources;
+    }
+    this.sendMessage('offer', payload);
   }
 
   sendAnswer(sdp) {
@@ -0,0 +1,68 @@
+const test = require('node:test');
+const assert = require('node:assert');
+
+// The modules are browser scripts; give them the globals they use
+globalThis.window = { location: { search: '?meetingId=meeting-1' } };
+globalThis.WebSocket = { OPEN: 1 };
+
+const storage = new Map();
+globalThis.sessionStorage = {
+  getItem: (key) => (storage.has(key) ? storage.get(key) : null),
+  setItem: (key, value) => storage.set(key, String(value)),
+  removeItem: (key) => storage.delete(key)
+};
+
+const SignalingManager = require('./signaling.js');
+const AppState = require('./state.js');
+
+function connectedManager() {
+  const manager = new SignalingManager();
+  const sent = [];
+  manager.ws = { readyState: WebSocket.OPEN, send: (data) => sent.push(JSON.parse(data)) };
+  return { manager, sent };
+}
+
+test('joinMeeting sends the join token', () => {
+  const { manager, sent } = connectedManager();
+  manager.joinMeeting('meeting-1', 'header.claims.signature');
+
+  assert.strictEqual(sent.length, 1);
+  assert.strictEqual(sent[0].type, 'joinMeeting');
+  assert.deepStrictEqual(sent[0].payload, { meetingId: 'meeting-1', joinToken: 'header.claims.signature' });
+});
+
+test('joinMeeting without a token leaves joinToken out', () => {
+  const { manager, sent } = connectedManager();
+  manager.joinMeeting('meeting-1', null);
+
+  assert.deepStrictEqual(sent[0].payload, { meetingId: 'meeting-1' });
+});
+
+test('the meeting page joins with the token from /meeting/create or /meeting/join', () => {
+  storage.clear();
+  sessionStorage.setItem('user', JSON.stringify({ id: 'user-1', name: 'User' }));
+  sessionStorage.setItem('joinToken', 'header.claims.signature');
+  AppState.initialize();
+  window.AppState = AppState;
+
+  const { manager, sent } = connectedManager();
+  manager.joinMeeting(AppState.meetingId, AppState.joinToken);
+
+  assert.strictEqual(sent[0].meetingId, 'meeting-1');
+  assert.deepStrictEqual(sent[0].payload, { meetingId: 'meeting-1', joinToken: 'header.claims.signature' });
+});
+
+test('sendOffer announces the track sources', () => {
+  const { manager, sent } = connectedManager();
+  manager.sendOffer('v=0', { 'camera-track': 'camera', 'screen-track': 'screen' });
+
+  assert.strictEqual(sent[0].type, 'offer');
+  assert.deepStrictEqual(sent[0].payload, { sdp: 'v=0', trackSources: { 'camera-track': 'camera', 'screen-track': 'screen' } });
+});
+
+test('sendOffer without tracks leaves trackSources out', () => {
+  const { manager, sent } = connectedManager();
+  manager.sendOffer('v=0', {});
+
+  assert.deepStrictEqual(sent[0].payload, { sdp: 'v=0' });
+});
@@ -4,6 +4,7 @@ const AppState = {
   userId: null,
   userName: null,
   signalingUrl: null,
+  joinToken: null, // Issued by /meeting/create or /meeting/join, verified by the SFU
   WSconnectionState: 'disconnected',
   peerConnectionState: 'new',
   localStreamState: 'not_initialized',
@@ -54,7 +55,8 @@ const AppState = {
       meetingId: meetingID,
       userId: user?.id,
       userName: user?.name || user?.email,
-      signalingUrl: sessionStorage.getItem('assignedSignalingServerUrl')
+      signalingUrl: sessionStorage.getItem('assignedSignalingServerUrl'),
+      joinToken: sessionStorage.getItem('joinToken')
     });
     
     return {
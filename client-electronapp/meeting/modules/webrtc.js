@@ -2,9 +2,15 @@
 class WebRTCManager {
   constructor() {
     this.peerConnection = null;
+    this.previousPeerConnection = null;
     this.remoteIceCandidates = [];
     this.stunServers = [{ urls: 'stun:stun.l.google.com:19302' }];
+    // Replaced by the STUN/TURN servers the SFU sends once it has set up our peer
+    this.iceServers = this.stunServers;
     this.localStream = null;
+    // Shared screen, announced to the SFU as source "screen"
+    this.screenStream = null;
+    this.screenSenders = [];
     this.onTrackCallback = null;
     this.onConnectionStateChangeCallback = null;
     this.onNegotiationNeededCallback = null;
@@ -21,13 +27,13 @@ class WebRTCManager {
   createPeerConnection(localStream) {
     if (window.Logger) {
       window.Logger.info('WEBRTC', 'Creating new PeerConnection', {
-        stunServers: this.stunServers,
+        iceServers: this.iceServers.map(server => server.urls),
         localStreamTracks: localStream ? localStream.getTracks().length : 0
       });
     }
 
     try {
-      this.peerConnection = new RTCPeerConnection({ iceServers: this.stunServers });
+      this.peerConnection = new RTCPeerConnection({ iceServers: this.iceServers });
       this.localStream = localStream;
       
       if (window.Logger) {
@@ -55,6 +61,12 @@ class WebRTCManager {
         }
       }
 
+      // A screen shared before a migration stays shared on the new connection
+      this.screenSenders = [];
+      if (this.screenStream) {
+        this.addScreenTracks();
+      }
+
       // Set up event handlers
       this.setupEventHandlers();
 
@@ -131,6 +143,11 @@ class WebRTCManager {
         }
       }
       }
+
+      if (newState === 'connected') {
+        // A migration is complete once the new SFU carries the media
+        this.closePreviousPeerConnection();
+      }
       
       if (this.onConnectionStateChangeCallback) {
         this.onConnectionStateChangeCallback(newState);
@@ -230,6 +247,89 @@ class WebRTCManager {
     }
   }
 
+  // Applies the ICE servers (including TURN credentials) sent by the SFU. The SFU
+  // only issues them after the PeerConnection exists, so gathering is restarted to
+  // pick up relay candidates.
+  setIceServers(iceServers) {
+    if (!Array.isArray(iceServers) || iceServers.length === 0) {
+      return;
+    }
+
+    this.iceServers = iceServers;
+    if (window.Logger) {
+      window.Logger.info('WEBRTC', 'Received ICE servers from SFU', {
+        iceServers: iceServers.map(server => server.urls),
+        hasPeerConnection: !!this.peerConnection
+      });
+    }
+
+    if (!this.peerConnection) {
+      return;
+    }
+
+    try {
+      this.peerConnection.setConfiguration({
+        ...this.peerConnection.getConfiguration(),
+        iceServers: iceServers
+      });
+      // Fires negotiationneeded once signaling is stable; the new offer carries fresh ICE credentials
+      this.peerConnection.restartIce();
+    } catch (error) {
+      if (window.Logger) {
+        window.Logger.error('WEBRTC', 'Failed to apply ICE servers from SFU', error);
+      }
+    }
+  }
+
+  // Moves the session to another SFU during a live meeting migration. The current SFU
+  // forwards our negotiation to the target and keeps relaying media until we reconnect,
+  // so the old PeerConnection stays up until the new one is connected.
+  migrateToSFU(message) {
+    if (!this.peerConnection) {
+      if (window.Logger) {
+        window.Logger.warn('WEBRTC', 'PeerConnection not initialized, ignoring SFU migration');
+      }
+      return;
+    }
+
+    if (window.Logger) {
+      window.Logger.info('WEBRTC', 'Meeting is migrating to another SFU, reconnecting', {
+        meetingId: message.payload?.meetingId
+      });
+    }
+
+    const previous = this.peerConnection;
+    previous.onicecandidate = null;
+    previous.ontrack = null;
+    previous.onnegotiationneeded = null;
+    previous.onconnectionstatechange = null;
+    this.closePreviousPeerConnection();
+    this.previousPeerConnection = previous;
+    this.remoteIceCandidates = [];
+
+    try {
+      // Adding the local tracks fires negotiationneeded, which sends a fresh offer
+      this.createPeerConnection(this.localStream);
+    } catch (error) {
+      if (window.Logger) {
+        window.Logger.error('WEBRTC', 'Failed to reconnect to migration target, keeping current connection', error);
+      }
+      this.peerConnection = previous;
+      this.previousPeerConnection = null;
+      this.setupEventHandlers();
+    }
+  }
+
+  closePreviousPeerConnection() {
+    if (this.previousPeerConnection) {
+      this.previousPeerConnection.close();
+      this.previousPeerConnection = null;
+      if (window.Logger) {
+        window.Logger.info('WEBRTC', 'Previous PeerConnection closed after migration');
+      }
+    }
+  }
+
   async addIceCandidate(candidate) {
     try {
       if (this.peerConnection && this.peerConnection.remoteDescription) {
@@ -271,6 +371,50 @@ class WebRTCManager {
     }
   }
 
+  startScreenShare(screenStream) {
+    this.stopScreenShare();
+    this.screenStream = screenStream;
+    if (this.peerConnection) {
+      this.addScreenTracks();
+    }
+  }
+
+  stopScreenShare() {
+    if (this.peerConnection) {
+      this.screenSenders.forEach(sender => this.peerConnection.removeTrack(sender));
+    }
+    this.screenSenders = [];
+    this.screenStream = null;
+  }
+
+  addScreenTracks() {
+    this.screenStream.getTracks().forEach(track => {
+      this.screenSenders.push(this.peerConnection.addTrack(track, this.screenStream));
+      if (window.Logger) {
+        window.Logger.debug('WEBRTC', 'Screen track added to PeerConnection', {
+          trackKind: track.kind,
+          trackId: track.id
+        });
+      }
+    });
+  }
+
+  // Sources of the published tracks by track ID, sent with offers: only we know which stream is the screen
+  getTrackSources() {
+    const sources = {};
+    if (this.localStream) {
+      this.localStream.getTracks().forEach(track => {
+        sources[track.id] = track.kind === 'audio' ? 'microphone' : 'camera';
+      });
+    }
+    if (this.screenStream) {
+      this.screenStream.getTracks().forEach(track => {
+        sources[track.id] = 'screen';
+      });
+    }
+    return sources;
+  }
+
   async createOffer() {
     if (!this.peerConnection) {
       throw new Error('PeerConnection not initialized');
@@ -287,6 +431,7 @@ class WebRTCManager {
   }
 
   cleanup() {
+    this.closePreviousPeerConnection();
     if (this.peerConnection) {
       const previousState = this.peerConnection.connectionState;
       this.peerConnection.close();
@@ -298,6 +443,8 @@ class WebRTCManager {
     
     this.remoteIceCandidates = [];
     this.localStream = null;
+    this.screenStream = null;
+    this.screenSenders = [];
     
     if (window.AppState) {
       window.AppState.updateState({ 
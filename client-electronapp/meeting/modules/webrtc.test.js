@@ -0,0 +1,55 @@
+const test = require('node:test');
+const assert = require('node:assert');
+
+// The module is a browser script; it only needs window for its logger
+globalThis.window = globalThis.window || {};
+
+const WebRTCManager = require('./webrtc.js');
+
+function fakeStream(id, tracks) {
+  return { id, getTracks: () => tracks };
+}
+
+function fakePeerConnection() {
+  const pc = { senders: [] };
+  pc.addTrack = (track, stream) => {
+    const sender = { track, stream };
+    pc.senders.push(sender);
+    return sender;
+  };
+  pc.removeTrack = (sender) => {
+    pc.senders = pc.senders.filter(s => s !== sender);
+  };
+  return pc;
+}
+
+const camera = fakeStream('camera-stream', [
+  { id: 'mic-track', kind: 'audio' },
+  { id: 'camera-track', kind: 'video' }
+]);
+const screen = fakeStream('screen-stream', [{ id: 'screen-track', kind: 'video' }]);
+
+test('the screen stream is announced as screen, the rest by kind', () => {
+  const manager = new WebRTCManager();
+  manager.peerConnection = fakePeerConnection();
+  manager.localStream = camera;
+  manager.startScreenShare(screen);
+
+  assert.deepStrictEqual(manager.getTrackSources(), {
+    'mic-track': 'microphone',
+    'camera-track': 'camera',
+    'screen-track': 'screen'
+  });
+  assert.deepStrictEqual(manager.peerConnection.senders.map(s => s.track.id), ['screen-track']);
+});
+
+test('stopping the screen share removes its tracks and source', () => {
+  const manager = new WebRTCManager();
+  manager.peerConnection = fakePeerConnection();
+  manager.localStream = camera;
+  manager.startScreenShare(screen);
+  manager.stopScreenShare();
+
+  assert.deepStrictEqual(manager.peerConnection.senders, []);
+  assert.deepStrictEqual(manager.getTrackSources(), { 'mic-track': 'microphone', 'camera-track': 'camera' });
+});
@@ -0,0 +1,77 @@
+package main
+
+import "sync"
+
+// bandwidthAllocator shares a subscriber's bandwidth estimate (REMB covers the whole
+// PeerConnection) among its SVC video down tracks. Screen shares are served first, up to the
+// bitrate of their highest allowed layers; cameras split what is left. Layer selection keeps
+// the highest spatial layer that fits, so a constrained screen share loses frame rate before
+// resolution.
+type bandwidthAllocator struct {
+	mu         sync.Mutex
+	estimate   uint64 // Latest estimate in bps (0 = none yet)
+	downTracks map[*DownTrack]bool
+}
+
+func newBandwidthAllocator() *bandwidthAllocator {
+	return &bandwidthAllocator{downTracks: make(map[*DownTrack]bool)}
+}
+
+// add includes a down track in the allocation
+func (a *bandwidthAllocator) add(downTrack *DownTrack) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.downTracks[downTrack] = true
+	a.allocateLocked()
+}
+
+// remove hands a closed down track's share to the others
+func (a *bandwidthAllocator) remove(downTrack *DownTrack) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.downTracks[downTrack] {
+		delete(a.downTracks, downTrack)
+		a.allocateLocked()
+	}
+}
+
+// setEstimate reallocates after the subscriber reported a new bandwidth estimate
+func (a *bandwidthAllocator) setEstimate(bps uint64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.estimate = bps
+	a.allocateLocked()
+}
+
+func (a *bandwidthAllocator) allocateLocked() {
+	if a.estimate == 0 {
+		return
+	}
+
+	var screens, cameras []*DownTrack
+	for downTrack := range a.downTracks {
+		if downTrack.Paused() {
+			continue
+		}
+		if isScreenShareVideo(downTrack.router) {
+			screens = append(screens, downTrack)
+		} else {
+			cameras = append(cameras, downTrack)
+		}
+	}
+
+	remaining := a.estimate
+	for i, downTrack := range screens {
+		share := remaining / uint64(len(screens)-i)
+		if wanted := downTrack.maxBitrate(); wanted > 0 && wanted < share {
+			share = wanted
+		}
+		remaining -= share
+		downTrack.setBandwidth(share)
+	}
+	for i, downTrack := range cameras {
+		share := remaining / uint64(len(cameras)-i)
+		remaining -= share
+		downTrack.setBandwidth(share)
+	}
+}
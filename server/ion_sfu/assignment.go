@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis keys describing which SFU hosts a meeting and who is in it
+const (
+	meetingSFUKeyFormat          = "meeting:%s:sfu"
+	meetingParticipantsKeyFormat = "meeting:%s:participants"
+)
+
+// Lua scripts operate on a single key so they are safe on Redis Cluster
+var (
+	// takeoverLeaseScript replaces the owner only if it is still the owner we observed
+	// (used to take over stale leases and to hand a lease over during migration)
+	takeoverLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+	return 1
+end
+return 0`)
+
+	// renewLeaseScript extends the lease only if this SFU still owns it
+	renewLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+	// releaseLeaseScript deletes the lease only if this SFU still owns it
+	releaseLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+)
+
+func meetingSFUKey(meetingID string) string {
+	return fmt.Sprintf(meetingSFUKeyFormat, meetingID)
+}
+
+func meetingParticipantsKey(meetingID string) string {
+	return fmt.Sprintf(meetingParticipantsKeyFormat, meetingID)
+}
+
+// claimMeeting atomically claims ownership of a meeting for this SFU.
+// It returns the current owner when the meeting belongs to another live SFU.
+func claimMeeting(meeting *Meeting) (bool, string, error) {
+	key := meetingSFUKey(meeting.ID)
+	ttl := C.MeetingLeaseTTL
+
+	acquired, err := redisClient.SetNX(ctx, key, sfuID, ttl).Result()
+	if err != nil {
+		return false, "", err
+	}
+
+	if !acquired {
+		owner, err := redisClient.Get(ctx, key).Result()
+		if err == redis.Nil {
+			// Lease expired between SETNX and GET, try once more
+			acquired, err = redisClient.SetNX(ctx, key, sfuID, ttl).Result()
+			if err != nil {
+				return false, "", err
+			}
+			if !acquired {
+				return false, "", fmt.Errorf("meeting %s was claimed concurrently", meeting.ID)
+			}
+		} else if err != nil {
+			return false, "", err
+		} else if owner != sfuID {
+			if isSFUAlive(owner) {
+				return false, owner, nil
+			}
+
+			sfuLogger.Warn("REDIS", "Meeting owned by stale SFU, taking over lease", map[string]interface{}{
+				"meetingID":  meeting.ID,
+				"staleOwner": owner,
+				"sfuID":      sfuID,
+			})
+			taken, err := takeoverLeaseScript.Run(ctx, redisClient, []string{key}, owner, sfuID, ttl.Milliseconds()).Int()
+			if err != nil {
+				return false, "", err
+			}
+			if taken == 0 {
+				return false, owner, nil
+			}
+		} else if err := redisClient.Expire(ctx, key, ttl).Err(); err != nil {
+			return false, "", err
+		}
+	}
+
+	meeting.mu.Lock()
+	meeting.leaseHeld = true
+	meeting.mu.Unlock()
+
+	sfuLogger.Info("REDIS", "Meeting claimed by this SFU", map[string]interface{}{
+		"meetingID": meeting.ID,
+		"sfuID":     sfuID,
+		"leaseTTL":  ttl.String(),
+	})
+	return true, sfuID, nil
+}
+
+// isSFUAlive reports whether another SFU has sent a heartbeat within the lease TTL
+func isSFUAlive(otherSFUID string) bool {
+	lastHeartbeat, err := redisClient.HGet(ctx, fmt.Sprintf("sfu:%s:metrics", otherSFUID), "last_heartbeat").Result()
+	if err != nil {
+		if err != redis.Nil {
+			// Be conservative and assume the owner is alive if we cannot tell
+			sfuLogger.Error("REDIS", "Error reading SFU heartbeat", err, map[string]interface{}{
+				"otherSFUID": otherSFUID,
+			})
+			return true
+		}
+		return false
+	}
+
+	lastMillis, err := strconv.ParseInt(lastHeartbeat, 10, 64)
+	if err != nil {
+		return false
+	}
+	return time.Since(time.UnixMilli(lastMillis)) < C.MeetingLeaseTTL
+}
+
+// meetingOwner returns the SFU currently holding the meeting lease, or "" if unclaimed
+func meetingOwner(meetingID string) (string, error) {
+	owner, err := redisClient.Get(ctx, meetingSFUKey(meetingID)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return owner, err
+}
+
+// ensureMeetingClaim claims the meeting unless this SFU already holds its lease
+// or serves it as an edge of the owning SFU
+func ensureMeetingClaim(meeting *Meeting) (bool, string, error) {
+	meeting.mu.RLock()
+	held := meeting.leaseHeld
+	edge := meeting.originSFUID != ""
+	meeting.mu.RUnlock()
+
+	if held || edge {
+		return true, sfuID, nil
+	}
+	return claimMeeting(meeting)
+}
+
+// renewMeetingLeases extends the lease and roster TTL of every meeting owned by this SFU
+func renewMeetingLeases() {
+	meetingsMu.RLock()
+	owned := make([]*Meeting, 0, len(meetings))
+	for _, meeting := range meetings {
+		meeting.mu.RLock()
+		if meeting.leaseHeld {
+			owned = append(owned, meeting)
+		}
+		meeting.mu.RUnlock()
+	}
+	meetingsMu.RUnlock()
+
+	ttl := C.MeetingLeaseTTL
+	for _, meeting := range owned {
+		renewed, err := renewLeaseScript.Run(ctx, redisClient, []string{meetingSFUKey(meeting.ID)}, sfuID, ttl.Milliseconds()).Int()
+		if err != nil {
+			sfuLogger.Error("REDIS", "Error renewing meeting lease", err, map[string]interface{}{
+				"meetingID": meeting.ID,
+			})
+			sfuState.IncrementCounters(0, 0, 1)
+			continue
+		}
+
+		if renewed == 0 {
+			sfuLogger.Error("REDIS", "Lost meeting lease to another SFU", nil, map[string]interface{}{
+				"meetingID": meeting.ID,
+				"sfuID":     sfuID,
+			})
+			sfuState.IncrementCounters(0, 0, 1)
+			meeting.mu.Lock()
+			meeting.leaseHeld = false
+			meeting.mu.Unlock()
+			continue
+		}
+
+		if err := redisClient.Expire(ctx, meetingParticipantsKey(meeting.ID), ttl).Err(); err != nil {
+			sfuLogger.Error("REDIS", "Error renewing meeting roster TTL", err, map[string]interface{}{
+				"meetingID": meeting.ID,
+			})
+			sfuState.IncrementCounters(0, 0, 1)
+		}
+	}
+}
+
+// releaseMeetingClaim gives up this SFU's ownership of a meeting and removes its roster
+func releaseMeetingClaim(meeting *Meeting) {
+	meeting.mu.Lock()
+	if meeting.migration != nil {
+		// The lease is handed to the target SFU by finishMigration
+		meeting.mu.Unlock()
+		return
+	}
+	held := meeting.leaseHeld
+	meeting.leaseHeld = false
+	meeting.mu.Unlock()
+
+	if !held {
+		return
+	}
+
+	if err := releaseLeaseScript.Run(ctx, redisClient, []string{meetingSFUKey(meeting.ID)}, sfuID).Err(); err != nil {
+		sfuLogger.Error("REDIS", "Error releasing meeting lease", err, map[string]interface{}{
+			"meetingID": meeting.ID,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+	}
+
+	if err := redisClient.Del(ctx, meetingParticipantsKey(meeting.ID)).Err(); err != nil {
+		sfuLogger.Error("REDIS", "Error deleting meeting roster", err, map[string]interface{}{
+			"meetingID": meeting.ID,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+	}
+
+	sfuLogger.Info("REDIS", "Meeting lease released", map[string]interface{}{
+		"meetingID": meeting.ID,
+		"sfuID":     sfuID,
+	})
+}
+
+// meetingMetadata snapshots the meeting into its Redis representation
+func meetingMetadata(meeting *Meeting) MeetingMetadata {
+	meeting.mu.RLock()
+	defer meeting.mu.RUnlock()
+
+	participants := make([]string, 0, len(meeting.clients))
+	for clientID := range meeting.clients {
+		participants = append(participants, clientID)
+	}
+
+	return MeetingMetadata{
+		ID:              meeting.ID,
+		SFUID:           sfuID,
+		Participants:    participants,
+		CreatedAt:       meeting.createdAt,
+		Status:          meeting.status,
+		MaxParticipants: meeting.maxParticipants,
+	}
+}
+
+// publishMeetingRoster writes the current participant roster to meeting:<id>:participants
+func publishMeetingRoster(meeting *Meeting) {
+	meeting.mu.RLock()
+	held := meeting.leaseHeld
+	meeting.mu.RUnlock()
+
+	if !held {
+		sfuLogger.Debug("REDIS", "Skipping roster publish for meeting not owned by this SFU", map[string]interface{}{
+			"meetingID": meeting.ID,
+		})
+		return
+	}
+
+	metadata := meetingMetadata(meeting)
+	rosterJSON, err := json.Marshal(metadata)
+	if err != nil {
+		sfuLogger.Error("REDIS", "Error marshalling meeting roster", err, map[string]interface{}{
+			"meetingID": meeting.ID,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return
+	}
+
+	if err := redisClient.Set(ctx, meetingParticipantsKey(meeting.ID), rosterJSON, C.MeetingLeaseTTL).Err(); err != nil {
+		sfuLogger.Error("REDIS", "Error publishing meeting roster", err, map[string]interface{}{
+			"meetingID": meeting.ID,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return
+	}
+
+	sfuLogger.Debug("REDIS", "Published meeting roster", map[string]interface{}{
+		"meetingID":    meeting.ID,
+		"participants": len(metadata.Participants),
+	})
+}
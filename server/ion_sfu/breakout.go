@@ -0,0 +1,234 @@
+package main
+
+import (
+	"sort"
+)
+
+// Breakout rooms split a meeting's participants without new PeerConnections: a client only
+// receives the tracks published in its own room, and moving it rearranges its down tracks
+// with one renegotiation. Rooms are kept per SFU; relayed tracks belong to the main room.
+
+// inSameBreakoutRoom reports whether a client is in the room a router's track is published in.
+// The caller holds meeting.mu.
+func inSameBreakoutRoom(meeting *Meeting, clientID string, router *TrackRouter) bool {
+	return meeting.roomAssignments[clientID] == meeting.roomAssignments[meeting.trackPublishers[router.ID()]]
+}
+
+// handleCreateBreakoutRooms opens breakout rooms, renaming rooms that already exist.
+// Payload: rooms (array of roomId, optional name), optional requestedBy (must be a host).
+func handleCreateBreakoutRooms(sfuCommand SFUCommand, meeting *Meeting) {
+	rooms, ok := sfuCommand.Payload["rooms"].([]interface{})
+	if !ok || len(rooms) == 0 {
+		sfuLogger.Error("KAFKA", "Missing or invalid rooms in createBreakoutRooms command", nil, map[string]interface{}{
+			"payload": sfuCommand.Payload,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return
+	}
+
+	created := make(map[string]string, len(rooms))
+	for _, value := range rooms {
+		room, _ := value.(map[string]interface{})
+		roomID, _ := room["roomId"].(string)
+		if roomID == "" {
+			sfuLogger.Error("KAFKA", "Missing roomId in createBreakoutRooms command", nil, map[string]interface{}{
+				"meetingID": meeting.ID,
+				"payload":   sfuCommand.Payload,
+			})
+			sfuState.IncrementCounters(0, 0, 1)
+			return
+		}
+		name, _ := room["name"].(string)
+		if name == "" {
+			name = roomID
+		}
+		created[roomID] = name
+	}
+
+	requestedBy, _ := sfuCommand.Payload["requestedBy"].(string)
+
+	meeting.mu.Lock()
+	authorized := mayManageMeeting(meeting, requestedBy)
+	if authorized {
+		for roomID, name := range created {
+			meeting.breakoutRooms[roomID] = name
+		}
+	}
+	meeting.mu.Unlock()
+
+	if !authorized {
+		rejectBreakoutCommand(sfuCommand, meeting, requestedBy)
+		return
+	}
+
+	sfuLogger.Info("WEBRTC", "Breakout rooms created", map[string]interface{}{
+		"meetingID":   meeting.ID,
+		"rooms":       len(created),
+		"requestedBy": requestedBy,
+	})
+	broadcastBreakoutRooms(meeting)
+}
+
+// handleAssignBreakoutRooms assigns participants to rooms or moves them between rooms.
+// Clients that have not joined yet get their room when they join.
+// Payload: assignments (clientId to roomId, "" for the main room), optional requestedBy.
+func handleAssignBreakoutRooms(sfuCommand SFUCommand, meeting *Meeting) {
+	assignments, ok := sfuCommand.Payload["assignments"].(map[string]interface{})
+	if !ok || len(assignments) == 0 {
+		sfuLogger.Error("KAFKA", "Missing or invalid assignments in assignBreakoutRooms command", nil, map[string]interface{}{
+			"payload": sfuCommand.Payload,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return
+	}
+
+	requestedBy, _ := sfuCommand.Payload["requestedBy"].(string)
+
+	meeting.mu.Lock()
+	authorized := mayManageMeeting(meeting, requestedBy)
+	var unknownRoom string
+	for _, value := range assignments {
+		roomID, _ := value.(string)
+		if _, exists := meeting.breakoutRooms[roomID]; roomID != "" && !exists {
+			unknownRoom = roomID
+			break
+		}
+	}
+	if authorized && unknownRoom == "" {
+		for clientID, value := range assignments {
+			if roomID, _ := value.(string); roomID != "" {
+				meeting.roomAssignments[clientID] = roomID
+			} else {
+				delete(meeting.roomAssignments, clientID)
+			}
+		}
+	}
+	meeting.mu.Unlock()
+
+	if !authorized {
+		rejectBreakoutCommand(sfuCommand, meeting, requestedBy)
+		return
+	}
+	if unknownRoom != "" {
+		sfuLogger.Warn("KAFKA", "assignBreakoutRooms names a room that does not exist", map[string]interface{}{
+			"meetingID": meeting.ID,
+			"roomID":    unknownRoom,
+		})
+		return
+	}
+
+	rearranged := syncBreakoutRooms(meeting)
+
+	sfuLogger.Info("WEBRTC", "Breakout room assignments changed", map[string]interface{}{
+		"meetingID":         meeting.ID,
+		"assignments":       len(assignments),
+		"renegotiatedPeers": rearranged,
+		"requestedBy":       requestedBy,
+	})
+	broadcastBreakoutRooms(meeting)
+}
+
+// handleCloseBreakoutRooms closes every breakout room and brings everyone back to the main room.
+// Payload: optional requestedBy (must be a host).
+func handleCloseBreakoutRooms(sfuCommand SFUCommand, meeting *Meeting) {
+	requestedBy, _ := sfuCommand.Payload["requestedBy"].(string)
+
+	meeting.mu.Lock()
+	authorized := mayManageMeeting(meeting, requestedBy)
+	closed := len(meeting.breakoutRooms)
+	if authorized {
+		meeting.breakoutRooms = make(map[string]string)
+		meeting.roomAssignments = make(map[string]string)
+	}
+	meeting.mu.Unlock()
+
+	if !authorized {
+		rejectBreakoutCommand(sfuCommand, meeting, requestedBy)
+		return
+	}
+
+	rearranged := syncBreakoutRooms(meeting)
+
+	sfuLogger.Info("WEBRTC", "Breakout rooms closed", map[string]interface{}{
+		"meetingID":         meeting.ID,
+		"rooms":             closed,
+		"renegotiatedPeers": rearranged,
+		"requestedBy":       requestedBy,
+	})
+	broadcastBreakoutRooms(meeting)
+}
+
+// syncBreakoutRooms adds the down tracks of each client's room and removes those of other
+// rooms, renegotiating every client whose tracks changed once. It returns that number of clients.
+func syncBreakoutRooms(meeting *Meeting) int {
+	meeting.mu.RLock()
+	defer meeting.mu.RUnlock()
+
+	rearranged := 0
+	for _, clientPeer := range meeting.clients {
+		if isClientMigrating(meeting, clientPeer.ID) {
+			continue
+		}
+
+		changed := false
+		for trackID, router := range meeting.routers {
+			if meeting.trackPublishers[trackID] == clientPeer.ID {
+				continue
+			}
+			downTrack := router.DownTrack(clientPeer.ID)
+			visible := inSameBreakoutRoom(meeting, clientPeer.ID, router)
+			switch {
+			case visible && downTrack == nil:
+				if attachTrackToPeer(meeting, clientPeer, router) {
+					changed = true
+				}
+			case !visible && downTrack != nil:
+				router.RemoveDownTrack(clientPeer.ID)
+				if detachTrackFromPeer(clientPeer, downTrack) {
+					changed = true
+				}
+			}
+		}
+
+		if changed {
+			renegotiateClient(clientPeer, "")
+			rearranged++
+		}
+	}
+	return rearranged
+}
+
+// broadcastBreakoutRooms tells the meeting which rooms are open and who is in which
+func broadcastBreakoutRooms(meeting *Meeting) {
+	meeting.mu.RLock()
+	rooms := make([]map[string]interface{}, 0, len(meeting.breakoutRooms))
+	for roomID, name := range meeting.breakoutRooms {
+		participants := make([]string, 0)
+		for clientID, assigned := range meeting.roomAssignments {
+			if assigned == roomID {
+				participants = append(participants, clientID)
+			}
+		}
+		sort.Strings(participants)
+		rooms = append(rooms, map[string]interface{}{
+			"roomId":       roomID,
+			"name":         name,
+			"participants": participants,
+		})
+	}
+	meeting.mu.RUnlock()
+
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i]["roomId"].(string) < rooms[j]["roomId"].(string) })
+	sendMeetingEvent(meeting, "breakoutRoomsChanged", map[string]interface{}{
+		"rooms": rooms,
+	})
+}
+
+// rejectBreakoutCommand logs a breakout room command from a participant who may not manage the meeting
+func rejectBreakoutCommand(sfuCommand SFUCommand, meeting *Meeting, requestedBy string) {
+	sfuLogger.Warn("KAFKA", "Breakout room command requested by a participant who may not manage the meeting", map[string]interface{}{
+		"commandType": sfuCommand.Type,
+		"meetingID":   meeting.ID,
+		"requestedBy": requestedBy,
+	})
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Command authentication modes
+const (
+	commandAuthOff      = "off"      // Envelopes are unwrapped without verification
+	commandAuthOptional = "optional" // Envelopes are verified, unsigned commands are still accepted
+	commandAuthRequired = "required" // Only verified envelopes are accepted (default)
+)
+
+// Optional mode exists for rolling out signing: anyone able to produce to sfu_commands can
+// still send unsigned commands, so it only protects the commands that do carry an envelope.
+
+// commandNonceKeyFormat remembers the nonces of commands this SFU accepted
+const commandNonceKeyFormat = "sfu:%s:nonce:%s:%s"
+
+// commandSigningVersion prefixes the signing input so signatures cannot be reused for other formats
+const commandSigningVersion = "sfu-command-v1"
+
+var (
+	commandKeys      map[string]signatureKey // Verification keys by key ID; the shared secret has the empty key ID
+	commandSigner    *commandSigningKey      // Signs commands this SFU sends (nil = unsigned)
+	commandsRejected int64                   // Commands refused by authenticateCommand, reported in heartbeats
+)
+
+// commandSigningKey signs the commands this SFU sends to other SFUs
+type commandSigningKey struct {
+	alg    string // "HS256" or "EdDSA"
+	keyID  string
+	secret []byte
+	edKey  ed25519.PrivateKey
+}
+
+func (key *commandSigningKey) sign(signingInput []byte) []byte {
+	if key.alg == "EdDSA" {
+		return ed25519.Sign(key.edKey, signingInput)
+	}
+	mac := hmac.New(sha256.New, key.secret)
+	mac.Write(signingInput)
+	return mac.Sum(nil)
+}
+
+// initCommandAuth loads the keys command envelopes are verified and signed with
+func initCommandAuth() {
+	if err := loadCommandKeys(); err != nil {
+		sfuLogger.Error("AUTH", "Error loading command keys", err, map[string]interface{}{
+			"keysFile":       C.CommandAuthKeysFile,
+			"signingKeyFile": C.CommandSigningKeyFile,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		panic(fmt.Sprintf("Error loading command keys: %v", err))
+	}
+	if C.CommandAuthMode == commandAuthRequired && len(commandKeys) == 0 {
+		panic("SFU_COMMAND_AUTH=required needs SFU_COMMAND_SECRET or SFU_COMMAND_KEYS_FILE (or SFU_COMMAND_AUTH=optional while rolling out signing)")
+	}
+	if C.CommandAuthMode != commandAuthRequired {
+		sfuLogger.Warn("AUTH", "COMMANDS ARE NOT AUTHENTICATED: unsigned sfu_commands are accepted, set SFU_COMMAND_AUTH=required once every issuer signs", map[string]interface{}{
+			"mode": C.CommandAuthMode,
+		})
+	}
+
+	signingAlg := ""
+	if commandSigner != nil {
+		signingAlg = commandSigner.alg
+	}
+	sfuLogger.Info("AUTH", "Command authentication configured", map[string]interface{}{
+		"mode":             C.CommandAuthMode,
+		"verificationKeys": len(commandKeys),
+		"signingAlgorithm": signingAlg,
+		"maxAge":           C.CommandMaxAge.String(),
+	})
+}
+
+func loadCommandKeys() error {
+	commandKeys = make(map[string]signatureKey)
+	if C.CommandAuthSecret != "" {
+		commandKeys[""] = signatureKey{alg: "HS256", secret: []byte(C.CommandAuthSecret), issuers: C.CommandAuthSecretIssuers}
+	}
+	if C.CommandAuthKeysFile != "" {
+		if err := loadJSONWebKeySet(C.CommandAuthKeysFile, commandKeys); err != nil {
+			return err
+		}
+	}
+	for keyID, key := range commandKeys {
+		if len(key.issuers) == 0 {
+			key.issuers = []string{keyID}
+			commandKeys[keyID] = key
+		}
+	}
+
+	switch {
+	case C.CommandSigningKeyFile != "":
+		data, err := os.ReadFile(C.CommandSigningKeyFile)
+		if err != nil {
+			return err
+		}
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return fmt.Errorf("signing key file is not PEM encoded")
+		}
+		privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("parsing signing key: %w", err)
+		}
+		edKey, ok := privateKey.(ed25519.PrivateKey)
+		if !ok {
+			return fmt.Errorf("signing key must be an Ed25519 key")
+		}
+		commandSigner = &commandSigningKey{alg: "EdDSA", keyID: C.CommandSigningKeyID, edKey: edKey}
+	case C.CommandAuthSecret != "":
+		commandSigner = &commandSigningKey{alg: "HS256", secret: []byte(C.CommandAuthSecret)}
+	}
+	return nil
+}
+
+// commandSigningInput is what the issuer signs: the target SFU binds the command to its Kafka key
+func commandSigningInput(targetSFUID string, envelope *CommandEnvelope) []byte {
+	input := commandSigningVersion + "\n" + targetSFUID + "\n" + envelope.Issuer + "\n" +
+		strconv.FormatInt(envelope.Timestamp, 10) + "\n" + envelope.Nonce + "\n"
+	return append([]byte(input), envelope.Command...)
+}
+
+// sealCommand serializes a command for another SFU, wrapped in a signed envelope when a signing key is configured
+func sealCommand(targetSFUID string, command SFUCommand) ([]byte, error) {
+	raw, err := json.Marshal(command)
+	if err != nil || commandSigner == nil {
+		return raw, err
+	}
+
+	envelope := CommandEnvelope{
+		Issuer:    sfuID,
+		KeyID:     commandSigner.keyID,
+		Algorithm: commandSigner.alg,
+		Timestamp: time.Now().UnixMilli(),
+		Nonce:     uuid.New().String(),
+		Command:   raw,
+	}
+	envelope.Signature = base64.RawURLEncoding.EncodeToString(commandSigner.sign(commandSigningInput(targetSFUID, &envelope)))
+	return json.Marshal(envelope)
+}
+
+// allowsIssuer reports whether a command key may sign as issuer. A pattern ending in "*"
+// matches by prefix. A shared secret cannot tell its holders apart, so every issuer it
+// lists can be impersonated by the others.
+func (key signatureKey) allowsIssuer(issuer string) bool {
+	if issuer == "" {
+		return false
+	}
+	for _, pattern := range key.issuers {
+		if pattern == issuer {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(issuer, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSFUIssuer reports whether a verified issuer is an SFU rather than a signaling or control service
+func isSFUIssuer(issuer string) bool {
+	return strings.HasPrefix(issuer, SFUIDPrefix)
+}
+
+// authenticateCommand verifies the envelope of a command addressed to this SFU: signature,
+// issuer, age and nonce. A nil envelope is an unsigned command.
+func authenticateCommand(envelope *CommandEnvelope) error {
+	if C.CommandAuthMode == commandAuthOff {
+		return nil
+	}
+	if envelope == nil {
+		if C.CommandAuthMode == commandAuthRequired {
+			return fmt.Errorf("unsigned command")
+		}
+		return nil
+	}
+
+	key, ok := commandKeys[envelope.KeyID]
+	if !ok {
+		return fmt.Errorf("unknown key ID %q", envelope.KeyID)
+	}
+	if envelope.Algorithm != key.alg {
+		return fmt.Errorf("algorithm %q not allowed for key %q", envelope.Algorithm, envelope.KeyID)
+	}
+	if !key.allowsIssuer(envelope.Issuer) {
+		return fmt.Errorf("issuer %q not allowed for key %q", envelope.Issuer, envelope.KeyID)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(envelope.Signature)
+	if err != nil || !key.verify(commandSigningInput(sfuID, envelope), signature) {
+		return fmt.Errorf("invalid signature")
+	}
+
+	age := time.Since(time.UnixMilli(envelope.Timestamp))
+	if age > C.CommandMaxAge || age < -C.CommandMaxAge {
+		return fmt.Errorf("timestamp outside the accepted window (age %s)", age.Round(time.Millisecond))
+	}
+	if envelope.Nonce == "" {
+		return fmt.Errorf("missing nonce")
+	}
+
+	// Nonces only need to outlive the accepted window on both sides of now
+	fresh, err := redisClient.SetNX(ctx, fmt.Sprintf(commandNonceKeyFormat, sfuID, envelope.Issuer, envelope.Nonce), 1, 2*C.CommandMaxAge).Result()
+	if err != nil {
+		return fmt.Errorf("checking nonce: %w", err)
+	}
+	if !fresh {
+		return fmt.Errorf("replayed nonce")
+	}
+	return nil
+}
+
+// rejectCommand counts and logs a command that failed authentication
+func rejectCommand(sfuCommand SFUCommand, envelope *CommandEnvelope, err error) {
+	atomic.AddInt64(&commandsRejected, 1)
+
+	fields := map[string]interface{}{
+		"commandType": sfuCommand.Type,
+		"reason":      err.Error(),
+		"sfuID":       sfuID,
+	}
+	if envelope != nil {
+		fields["issuer"] = envelope.Issuer
+		fields["keyID"] = envelope.KeyID
+	}
+	sfuLogger.Warn("AUTH", "Rejected Kafka command", fields)
+}
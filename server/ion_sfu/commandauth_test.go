@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// nonceStore answers the SET NX commands of authenticateCommand in memory, so the
+// nonce check runs without a Redis cluster
+type nonceStore struct {
+	mu   sync.Mutex
+	keys map[string]bool
+}
+
+func (s *nonceStore) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return nil, fmt.Errorf("unexpected Redis dial to %s", addr)
+	}
+}
+
+func (s *nonceStore) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		boolCmd, ok := cmd.(*redis.BoolCmd)
+		if !ok || len(cmd.Args()) < 2 {
+			err := fmt.Errorf("unexpected Redis command %v", cmd.Args())
+			cmd.SetErr(err)
+			return err
+		}
+		key := fmt.Sprint(cmd.Args()[1])
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		boolCmd.SetVal(!s.keys[key])
+		s.keys[key] = true
+		return nil
+	}
+}
+
+func (s *nonceStore) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+// The JS sealer fixtures in testdata were produced by sealSfuCommand in
+// server/utils/kafka-envelope.js for target SFU "sfu-fixture" and issuer "signaling-server":
+// the HS256 one with SFU_COMMAND_SECRET=fixture-command-secret, the EdDSA one with an
+// Ed25519 key whose public half is fixtureCommandEdKey (SFU_COMMAND_SIGNING_KEY_ID=signaling-ed).
+const (
+	fixtureCommandSecret = "fixture-command-secret"
+	fixtureCommandEdKey  = "L-C2rOZgTey6XBxJn9GgF0BuVU_3yqGHjKckWj9hbAU"
+	fixtureTargetSFUID   = "sfu-fixture"
+)
+
+// setupCommandAuth loads the fixture keys in the given mode and replaces Redis with a nonce store
+func setupCommandAuth(t *testing.T, mode string) {
+	t.Helper()
+	controlKey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keySet := fmt.Sprintf(`{"keys":[
+		{"kty":"OKP","kid":"signaling-ed","crv":"Ed25519","alg":"EdDSA","x":%q,"issuers":["signaling-server"]},
+		{"kty":"OKP","kid":"control-ed","crv":"Ed25519","x":%q}
+	]}`, fixtureCommandEdKey, base64.RawURLEncoding.EncodeToString(controlKey))
+	path := filepath.Join(t.TempDir(), "command-keys.json")
+	if err := os.WriteFile(path, []byte(keySet), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	previousConfig, previousSFUID, previousRedis := C, sfuID, redisClient
+	t.Cleanup(func() {
+		C, sfuID, redisClient = previousConfig, previousSFUID, previousRedis
+		commandKeys, commandSigner = nil, nil
+	})
+
+	C.CommandAuthMode = mode
+	C.CommandAuthSecret = fixtureCommandSecret
+	C.CommandAuthSecretIssuers = []string{SFUIDPrefix + "*", "signaling-server"}
+	C.CommandAuthKeysFile = path
+	C.CommandSigningKeyFile = ""
+	C.CommandMaxAge = 30 * time.Second
+	sfuID = fixtureTargetSFUID
+	if err := loadCommandKeys(); err != nil {
+		t.Fatalf("loading command keys: %v", err)
+	}
+
+	redisClient = redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{"127.0.0.1:1"}})
+	redisClient.AddHook(&nonceStore{keys: make(map[string]bool)})
+}
+
+func readEnvelopeFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []byte(strings.TrimSpace(string(data)))
+}
+
+func TestAuthenticateCommandJSSealerFixtures(t *testing.T) {
+	for _, name := range []string{"command_envelope_hs256.json", "command_envelope_eddsa.json"} {
+		t.Run(name, func(t *testing.T) {
+			setupCommandAuth(t, commandAuthRequired)
+			value := readEnvelopeFixture(t, name)
+
+			command, envelope, err := parseKafkaCommand(value)
+			if err != nil || envelope == nil {
+				t.Fatalf("parsing envelope: envelope=%v err=%v", envelope, err)
+			}
+			if command.Type != "clientJoined" || command.Payload["clientId"] != "client-1" {
+				t.Fatalf("command = %+v", command)
+			}
+
+			// The fixture was sealed once; widen the window to its age so only the signature is judged
+			C.CommandMaxAge = time.Since(time.UnixMilli(envelope.Timestamp)) + time.Hour
+			if err := authenticateCommand(envelope); err != nil {
+				t.Fatalf("fixture rejected: %v", err)
+			}
+			if err := authenticateCommand(envelope); err == nil || !strings.Contains(err.Error(), "replayed") {
+				t.Fatalf("replayed fixture: err = %v", err)
+			}
+
+			// The same envelope read by another SFU
+			sfuID = "sfu-other"
+			_, envelope, _ = parseKafkaCommand(value)
+			if err := authenticateCommand(envelope); err == nil || !strings.Contains(err.Error(), "signature") {
+				t.Fatalf("fixture for another SFU: err = %v", err)
+			}
+		})
+	}
+}
+
+// signedEnvelope seals a command from another SFU for a target SFU with a chosen timestamp and nonce
+func signedEnvelope(t *testing.T, targetSFUID string, timestamp time.Time, nonce string) []byte {
+	t.Helper()
+	return signedEnvelopeAs(t, "sfu-origin", targetSFUID, timestamp, nonce)
+}
+
+// signedEnvelopeAs seals a command with the shared secret, claiming to come from issuer
+func signedEnvelopeAs(t *testing.T, issuer, targetSFUID string, timestamp time.Time, nonce string) []byte {
+	t.Helper()
+	raw, err := json.Marshal(SFUCommand{Type: "startRelay", Payload: map[string]interface{}{"meetingId": "meeting-1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope := CommandEnvelope{
+		Issuer:    issuer,
+		Algorithm: commandSigner.alg,
+		Timestamp: timestamp.UnixMilli(),
+		Nonce:     nonce,
+		Command:   raw,
+	}
+	envelope.Signature = base64.RawURLEncoding.EncodeToString(commandSigner.sign(commandSigningInput(targetSFUID, &envelope)))
+	value, err := json.Marshal(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+func TestAuthenticateCommand(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		value   func(t *testing.T) []byte
+		wantErr string
+	}{
+		{
+			name: "sealed by sealCommand",
+			value: func(t *testing.T) []byte {
+				value, err := sealCommand(fixtureTargetSFUID, SFUCommand{Type: "startRelay", Payload: map[string]interface{}{"meetingId": "meeting-1"}})
+				if err != nil {
+					t.Fatal(err)
+				}
+				return value
+			},
+		},
+		{
+			name:    "sealed for another SFU",
+			value:   func(t *testing.T) []byte { return signedEnvelope(t, "sfu-other", now, "nonce-1") },
+			wantErr: "invalid signature",
+		},
+		{
+			name: "older than CommandMaxAge",
+			value: func(t *testing.T) []byte {
+				return signedEnvelope(t, fixtureTargetSFUID, now.Add(-time.Minute), "nonce-2")
+			},
+			wantErr: "timestamp",
+		},
+		{
+			name: "further in the future than CommandMaxAge",
+			value: func(t *testing.T) []byte {
+				return signedEnvelope(t, fixtureTargetSFUID, now.Add(time.Minute), "nonce-3")
+			},
+			wantErr: "timestamp",
+		},
+		{
+			name: "within CommandMaxAge",
+			value: func(t *testing.T) []byte {
+				return signedEnvelope(t, fixtureTargetSFUID, now.Add(-20*time.Second), "nonce-4")
+			},
+		},
+		{
+			name:    "missing nonce",
+			value:   func(t *testing.T) []byte { return signedEnvelope(t, fixtureTargetSFUID, now, "") },
+			wantErr: "nonce",
+		},
+		{
+			name: "command changed after signing",
+			value: func(t *testing.T) []byte {
+				value := signedEnvelope(t, fixtureTargetSFUID, now, "nonce-5")
+				return []byte(strings.Replace(string(value), "startRelay", "stopRelay", 1))
+			},
+			wantErr: "invalid signature",
+		},
+		{
+			name: "issuer not allowed for the shared secret",
+			value: func(t *testing.T) []byte {
+				return signedEnvelopeAs(t, "control-service", fixtureTargetSFUID, now, "nonce-7")
+			},
+			wantErr: "issuer",
+		},
+		{
+			name:    "empty issuer",
+			value:   func(t *testing.T) []byte { return signedEnvelopeAs(t, "", fixtureTargetSFUID, now, "nonce-8") },
+			wantErr: "issuer",
+		},
+		{
+			name: "unknown key ID",
+			value: func(t *testing.T) []byte {
+				value := signedEnvelope(t, fixtureTargetSFUID, now, "nonce-6")
+				return []byte(strings.Replace(string(value), `"issuer"`, `"kid":"retired","issuer"`, 1))
+			},
+			wantErr: "unknown key ID",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupCommandAuth(t, commandAuthRequired)
+			_, envelope, err := parseKafkaCommand(tt.value(t))
+			if err != nil || envelope == nil {
+				t.Fatalf("parsing envelope: envelope=%v err=%v", envelope, err)
+			}
+
+			err = authenticateCommand(envelope)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCommandKeyIssuers(t *testing.T) {
+	setupCommandAuth(t, commandAuthRequired)
+
+	tests := []struct {
+		keyID   string
+		issuer  string
+		allowed bool
+	}{
+		{keyID: "", issuer: "sfu-a", allowed: true},
+		{keyID: "", issuer: "signaling-server", allowed: true},
+		{keyID: "", issuer: "signaling-server-2", allowed: false},
+		{keyID: "", issuer: "sfu", allowed: false},
+		{keyID: "", issuer: "", allowed: false},
+		{keyID: "signaling-ed", issuer: "signaling-server", allowed: true},
+		{keyID: "signaling-ed", issuer: "sfu-a", allowed: false},
+		{keyID: "control-ed", issuer: "control-ed", allowed: true}, // No issuers listed: the key ID
+		{keyID: "control-ed", issuer: "signaling-server", allowed: false},
+	}
+
+	for _, tt := range tests {
+		if allowed := commandKeys[tt.keyID].allowsIssuer(tt.issuer); allowed != tt.allowed {
+			t.Errorf("key %q signing as %q: allowed = %v, want %v", tt.keyID, tt.issuer, allowed, tt.allowed)
+		}
+	}
+}
+
+func TestAuthenticateCommandReplayedNonce(t *testing.T) {
+	setupCommandAuth(t, commandAuthRequired)
+	value := signedEnvelope(t, fixtureTargetSFUID, time.Now(), "nonce-replayed")
+
+	_, envelope, _ := parseKafkaCommand(value)
+	if err := authenticateCommand(envelope); err != nil {
+		t.Fatalf("first delivery rejected: %v", err)
+	}
+	_, envelope, _ = parseKafkaCommand(value)
+	if err := authenticateCommand(envelope); err == nil || !strings.Contains(err.Error(), "replayed nonce") {
+		t.Fatalf("second delivery: err = %v, want replayed nonce", err)
+	}
+
+	// A fresh nonce from the same issuer is still accepted
+	other := signedEnvelope(t, fixtureTargetSFUID, time.Now(), "nonce-other")
+	_, envelope, _ = parseKafkaCommand(other)
+	if err := authenticateCommand(envelope); err != nil {
+		t.Fatalf("fresh nonce rejected: %v", err)
+	}
+}
+
+func TestAuthenticateUnsignedCommand(t *testing.T) {
+	unsigned := []byte(`{"type":"clientLeft","payload":{"meetingId":"meeting-1","clientId":"client-1"}}`)
+
+	tests := []struct {
+		mode    string
+		wantErr bool
+	}{
+		{mode: commandAuthOff},
+		{mode: commandAuthOptional},
+		{mode: commandAuthRequired, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			setupCommandAuth(t, tt.mode)
+			command, envelope, err := parseKafkaCommand(unsigned)
+			if err != nil || envelope != nil || command.Type != "clientLeft" {
+				t.Fatalf("parsed unsigned command as %+v, envelope %v, err %v", command, envelope, err)
+			}
+			if err := authenticateCommand(envelope); (err != nil) != tt.wantErr {
+				t.Fatalf("authenticateCommand error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Optional mode still rejects envelopes that fail verification
+	t.Run("optional with a bad signature", func(t *testing.T) {
+		setupCommandAuth(t, commandAuthOptional)
+		_, envelope, _ := parseKafkaCommand(signedEnvelope(t, "sfu-other", time.Now(), "nonce-optional"))
+		if err := authenticateCommand(envelope); err == nil {
+			t.Fatal("envelope for another SFU accepted in optional mode")
+		}
+	})
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"net"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -11,20 +14,103 @@ import (
 
 // Config holds the configuration for the SFU
 type Config struct {
-	SFUID               string
-	LogLevel            LogLevel
-	SignalingURL        string
-	RedisClusterNodes   []string
-	KafkaBrokers        []string
-	ICEServers          []webrtc.ICEServer
-	HeartbeatInterval   time.Duration
-	RedisPoolSize       int
-	RedisMinIdleConns   int
-	RedisMaxRetries     int
-	KafkaMaxRetries     int
-	KafkaRetryMax       int
-	WSReconnectDelay    time.Duration
-	RedisReconnectDelay time.Duration
+	SFUID                string
+	LogLevel             LogLevel
+	SignalingURL         string
+	RedisClusterNodes    []string
+	KafkaBrokers         []string
+	ICEServers           []webrtc.ICEServer
+	HeartbeatInterval    time.Duration
+	RedisPoolSize        int
+	RedisMinIdleConns    int
+	RedisMaxRetries      int
+	KafkaMaxRetries      int
+	KafkaRetryMax        int
+	WSReconnectDelay     time.Duration
+	RedisReconnectDelay  time.Duration
+	MeetingLeaseTTL      time.Duration
+	MigrationTimeout     time.Duration
+	ReconnectGracePeriod time.Duration
+	MaxICERestarts       int
+	ICEUDPMuxPort        int // Single UDP port for all ICE traffic (0 = ephemeral ports)
+	ICEPortMin           int // Ephemeral UDP port range used when no UDP mux is configured
+	ICEPortMax           int
+	ICETCPPort           int      // Port for passive ICE-TCP candidates (0 = disabled)
+	NAT1To1IPs           []string // Public IPs advertised instead of (or in addition to) local ones
+	NAT1To1CandidateType string   // "host" replaces host candidates, "srflx" adds server reflexive ones
+	ICEInterfaces        []string // Network interfaces allowed for gathering (empty = all)
+	ICEAllowedNetworks   []string // CIDRs allowed for gathering (empty = all)
+	ICEMDNSMode          string   // "disabled", "query" or "gather"
+	TURNEnabled          bool     // Run the embedded TURN server
+	TURNPort             int      // UDP listen port (0 = disabled)
+	TURNTCPPort          int      // TCP listen port (0 = disabled)
+	TURNTLSPort          int      // TLS listen port, requires a certificate (0 = disabled)
+	TURNTLSCertFile      string
+	TURNTLSKeyFile       string
+	TURNRealm            string
+	TURNPublicIP         string // Relay address handed out in allocations
+	TURNHost             string // Host name advertised in TURN URLs (defaults to the public IP)
+	TURNSecret           string // Shared secret for REST-style ephemeral credentials
+	TURNCredentialTTL    time.Duration
+	TURNRelayPortMin     int
+	TURNRelayPortMax     int
+	AudioCodecs          []string // Audio codecs in preference order ("opus", "red")
+	VideoCodecs          []string // Video codecs in preference order ("vp8", "vp9", "h264", "av1")
+	H264Profiles         []string // profile-level-id values registered for H.264
+	VideoRTX             bool     // Negotiate RTX retransmission for video
+	DownTrackQueueSize   int      // Packets buffered per subscriber and track before dropping
+	DownTrackDropPolicy  string   // "drop-oldest" or "drop-newest" when a subscriber's queue is full
+	DataChannelMaxSize   int      // Largest data channel message relayed, in bytes
+	DataChannelRateLimit float64  // Messages per second a client may send over its data channel
+	DataChannelBurst     int      // Messages a client may send in a burst above the rate limit
+	ChatPersistTopic     string   // Kafka topic chat messages are published to for history (empty = disabled)
+	MeetingEventsTopic   string   // Kafka topic meeting lifecycle events are published to (empty = disabled)
+	HistoryMaxLength     int      // Chat and reaction entries kept per meeting in Redis
+	HistoryTTL           time.Duration
+	HistoryOnJoin        int // Entries delivered to a newly joined client (0 = none)
+
+	// Join tokens issued by the auth service (no keys = joins are not authenticated)
+	JoinTokenSecret         string        // HS256 secret shared with the auth service
+	JoinTokenKeysFile       string        // JWK set with HS256, RS256 and EdDSA verification keys
+	JoinTokenIssuer         string        // Required iss claim (empty = not checked)
+	JoinTokenAudience       string        // Required aud claim (empty = not checked)
+	JoinTokenMigrationGrace time.Duration // How long after expiry the token of a client moved by a signed migration is still accepted
+	DefaultRole             string        // Role of clients whose token and command carry none
+
+	// Signed command envelopes on sfu_commands
+	CommandAuthMode          string        // "required" (default), "optional" (verify envelopes, accept unsigned) or "off"
+	CommandAuthSecret        string        // HS256 secret shared by the command issuers and SFUs
+	CommandAuthSecretIssuers []string      // Issuers allowed to sign with CommandAuthSecret ("sfu-*" matches by prefix)
+	CommandAuthKeysFile      string        // JWK set with the issuers' verification keys
+	CommandSigningKeyFile    string        // Ed25519 PKCS#8 PEM key this SFU signs its commands with
+	CommandSigningKeyID      string        // Key ID of CommandSigningKeyFile in the other SFUs' key sets
+	CommandMaxAge            time.Duration // How old (or how far in the future) a command's timestamp may be
+
+	// Kafka client security
+	KafkaTLSEnabled            bool
+	KafkaTLSCAFile             string
+	KafkaTLSCertFile           string // Client certificate for mutual TLS
+	KafkaTLSKeyFile            string
+	KafkaTLSInsecureSkipVerify bool
+	KafkaSASLMechanism         string // "", "PLAIN", "SCRAM-SHA-256" or "SCRAM-SHA-512"
+	KafkaSASLUser              string
+	KafkaSASLPassword          string
+
+	// Meeting lobby
+	LobbyTimeout                time.Duration // How long a participant waits to be admitted before being turned away
+	LobbyAutoAdmitAuthenticated bool          // Participants with a verified join token skip the lobby
+
+	MaxScreenShares int // Concurrent screen shares per meeting (0 = unlimited)
+
+	// Webinars
+	WebinarMaxViewers        int           // Viewers of one webinar this SFU serves before refusing more (0 = unlimited)
+	ViewerRenegotiationDelay time.Duration // Window over which viewers' renegotiations are coalesced and spread
+
+	// RTP egress and ingest, file playback
+	EgressSDPDir      string        // Where SDP files describing RTP egress streams are written
+	IngestBindAddress string        // Local address RTP ingest ports are opened on
+	IngestIdleTimeout time.Duration // An ingest receiving no RTP for this long is stopped
+	PlaybackDir       string        // Directory playMedia files are read from (empty = playback disabled)
 }
 
 // C is the global configuration object
@@ -35,31 +121,208 @@ func initConfig() {
 	sfuLogger.Info("CONFIG", "Loading configuration from environment variables", nil)
 
 	C = Config{
-		SFUID:               getEnv("SFU_ID", SFUIDPrefix+generateRandomID()),
-		LogLevel:            getLogLevelEnv("SFU_LOG_LEVEL", DEBUG),
-		SignalingURL:        getEnv("SIGNALING_SERVER_URL", "ws://localhost:8080"),
-		RedisClusterNodes:   getEnvSlice("REDIS_CLUSTER_NODES", "localhost:7000,localhost:7001,localhost:7002"),
-		KafkaBrokers:        getEnvSlice("KAFKA_BROKERS", "kafka1:9092,kafka2:9093,kafka3:9094"),
-		HeartbeatInterval:   5 * time.Second,
-		RedisPoolSize:       10,
-		RedisMinIdleConns:   5,
-		RedisMaxRetries:     3,
-		KafkaMaxRetries:     5,
-		KafkaRetryMax:       5,
-		WSReconnectDelay:    5 * time.Second,
-		RedisReconnectDelay: 2 * time.Second,
-		ICEServers: []webrtc.ICEServer{
-			{URLs: getEnvSlice("STUN_SERVERS", "stun:stun.l.google.com:19302")},
-		},
+		SFUID:                getEnv("SFU_ID", SFUIDPrefix+generateRandomID()),
+		LogLevel:             getLogLevelEnv("SFU_LOG_LEVEL", DEBUG),
+		SignalingURL:         getEnv("SIGNALING_SERVER_URL", "ws://localhost:8080"),
+		RedisClusterNodes:    getEnvSlice("REDIS_CLUSTER_NODES", "localhost:7000,localhost:7001,localhost:7002"),
+		KafkaBrokers:         getEnvSlice("KAFKA_BROKERS", "kafka1:9092,kafka2:9093,kafka3:9094"),
+		HeartbeatInterval:    5 * time.Second,
+		RedisPoolSize:        10,
+		RedisMinIdleConns:    5,
+		RedisMaxRetries:      3,
+		KafkaMaxRetries:      5,
+		KafkaRetryMax:        5,
+		WSReconnectDelay:     5 * time.Second,
+		RedisReconnectDelay:  2 * time.Second,
+		MeetingLeaseTTL:      getEnvDuration("SFU_MEETING_LEASE_TTL", 30*time.Second),
+		MigrationTimeout:     getEnvDuration("SFU_MIGRATION_TIMEOUT", 60*time.Second),
+		ReconnectGracePeriod: getEnvDuration("SFU_RECONNECT_GRACE_PERIOD", 15*time.Second),
+		MaxICERestarts:       getEnvInt("SFU_MAX_ICE_RESTARTS", 3),
+		ICEServers:           getICEServersEnv("STUN_SERVERS", "stun:stun.l.google.com:19302"),
+		ICEUDPMuxPort:        getEnvInt("SFU_ICE_UDP_MUX_PORT", 0),
+		ICEPortMin:           getEnvInt("SFU_ICE_PORT_MIN", 0),
+		ICEPortMax:           getEnvInt("SFU_ICE_PORT_MAX", 0),
+		ICETCPPort:           getEnvInt("SFU_ICE_TCP_PORT", 0),
+		NAT1To1IPs:           getEnvList("SFU_NAT_1TO1_IPS"),
+		NAT1To1CandidateType: getEnv("SFU_NAT_1TO1_CANDIDATE_TYPE", "host"),
+		ICEInterfaces:        getEnvList("SFU_ICE_INTERFACES"),
+		ICEAllowedNetworks:   getEnvList("SFU_ICE_ALLOWED_NETWORKS"),
+		ICEMDNSMode:          getEnv("SFU_ICE_MDNS_MODE", "query"),
+		TURNEnabled:          getEnvBool("SFU_TURN_ENABLED", false),
+		TURNPort:             getEnvInt("SFU_TURN_PORT", 3478),
+		TURNTCPPort:          getEnvInt("SFU_TURN_TCP_PORT", 3478),
+		TURNTLSPort:          getEnvInt("SFU_TURN_TLS_PORT", 0),
+		TURNTLSCertFile:      getEnv("SFU_TURN_TLS_CERT_FILE", ""),
+		TURNTLSKeyFile:       getEnv("SFU_TURN_TLS_KEY_FILE", ""),
+		TURNRealm:            getEnv("SFU_TURN_REALM", "videochat"),
+		TURNPublicIP:         getEnv("SFU_TURN_PUBLIC_IP", ""),
+		TURNHost:             getEnv("SFU_TURN_HOST", ""),
+		TURNSecret:           getEnv("SFU_TURN_SECRET", ""),
+		TURNCredentialTTL:    getEnvDuration("SFU_TURN_CREDENTIAL_TTL", 12*time.Hour),
+		TURNRelayPortMin:     getEnvInt("SFU_TURN_RELAY_PORT_MIN", 49152),
+		TURNRelayPortMax:     getEnvInt("SFU_TURN_RELAY_PORT_MAX", 65535),
+		AudioCodecs:          getEnvSlice("SFU_AUDIO_CODECS", "opus,red"),
+		VideoCodecs:          getEnvSlice("SFU_VIDEO_CODECS", "vp8,vp9,h264,av1"),
+		H264Profiles:         getEnvSlice("SFU_H264_PROFILES", "42e01f,42001f,4d001f,640032"),
+		VideoRTX:             getEnvBool("SFU_VIDEO_RTX", true),
+		DownTrackQueueSize:   getEnvInt("SFU_DOWNTRACK_QUEUE_SIZE", 256),
+		DownTrackDropPolicy:  getEnv("SFU_DOWNTRACK_DROP_POLICY", dropOldest),
+		DataChannelMaxSize:   getEnvInt("SFU_DATA_CHANNEL_MAX_SIZE", 16*1024),
+		DataChannelRateLimit: float64(getEnvInt("SFU_DATA_CHANNEL_RATE_LIMIT", 20)),
+		DataChannelBurst:     getEnvInt("SFU_DATA_CHANNEL_BURST", 40),
+		ChatPersistTopic:     getEnv("SFU_CHAT_PERSIST_TOPIC", ""),
+		MeetingEventsTopic:   getEnv("SFU_MEETING_EVENTS_TOPIC", "meeting_events"),
+		HistoryMaxLength:     getEnvInt("SFU_HISTORY_MAX_LENGTH", 1000),
+		HistoryTTL:           getEnvDuration("SFU_HISTORY_TTL", 24*time.Hour),
+		HistoryOnJoin:        getEnvInt("SFU_HISTORY_ON_JOIN", 50),
+
+		JoinTokenSecret:         getEnv("SFU_JOIN_TOKEN_SECRET", ""),
+		JoinTokenKeysFile:       getEnv("SFU_JOIN_TOKEN_KEYS_FILE", ""),
+		JoinTokenIssuer:         getEnv("SFU_JOIN_TOKEN_ISSUER", "videochat-auth"),
+		JoinTokenAudience:       getEnv("SFU_JOIN_TOKEN_AUDIENCE", "sfu"),
+		JoinTokenMigrationGrace: getEnvDuration("SFU_JOIN_TOKEN_MIGRATION_GRACE", 5*time.Minute),
+		DefaultRole:             getEnv("SFU_DEFAULT_ROLE", roleAttendee),
+
+		CommandAuthMode:          getEnv("SFU_COMMAND_AUTH", commandAuthRequired),
+		CommandAuthSecret:        getEnv("SFU_COMMAND_SECRET", ""),
+		CommandAuthSecretIssuers: getEnvSlice("SFU_COMMAND_SECRET_ISSUERS", SFUIDPrefix+"*"),
+		CommandAuthKeysFile:      getEnv("SFU_COMMAND_KEYS_FILE", ""),
+		CommandSigningKeyFile:    getEnv("SFU_COMMAND_SIGNING_KEY_FILE", ""),
+		CommandSigningKeyID:      getEnv("SFU_COMMAND_SIGNING_KEY_ID", ""),
+		CommandMaxAge:            getEnvDuration("SFU_COMMAND_MAX_AGE", 30*time.Second),
+
+		KafkaTLSEnabled:            getEnvBool("KAFKA_TLS_ENABLED", false),
+		KafkaTLSCAFile:             getEnv("KAFKA_TLS_CA_FILE", ""),
+		KafkaTLSCertFile:           getEnv("KAFKA_TLS_CERT_FILE", ""),
+		KafkaTLSKeyFile:            getEnv("KAFKA_TLS_KEY_FILE", ""),
+		KafkaTLSInsecureSkipVerify: getEnvBool("KAFKA_TLS_INSECURE_SKIP_VERIFY", false),
+		KafkaSASLMechanism:         getEnv("KAFKA_SASL_MECHANISM", ""),
+		KafkaSASLUser:              getEnv("KAFKA_SASL_USER", ""),
+		KafkaSASLPassword:          getEnv("KAFKA_SASL_PASSWORD", ""),
+
+		LobbyTimeout:                getEnvDuration("SFU_LOBBY_TIMEOUT", 10*time.Minute),
+		LobbyAutoAdmitAuthenticated: getEnvBool("SFU_LOBBY_AUTO_ADMIT_AUTHENTICATED", false),
+
+		MaxScreenShares: getEnvInt("SFU_MAX_SCREEN_SHARES", 1),
+
+		WebinarMaxViewers:        getEnvInt("SFU_WEBINAR_MAX_VIEWERS", 500),
+		ViewerRenegotiationDelay: getEnvDuration("SFU_VIEWER_RENEGOTIATION_DELAY", 500*time.Millisecond),
+
+		EgressSDPDir:      getEnv("SFU_EGRESS_SDP_DIR", filepath.Join(os.TempDir(), "sfu-egress")),
+		IngestBindAddress: getEnv("SFU_INGEST_BIND_ADDRESS", "0.0.0.0"),
+		IngestIdleTimeout: getEnvDuration("SFU_INGEST_IDLE_TIMEOUT", time.Minute),
+		PlaybackDir:       getEnv("SFU_PLAYBACK_DIR", ""),
+	}
+
+	if C.DownTrackQueueSize <= 0 {
+		sfuLogger.Warn("CONFIG", "Invalid down track queue size, using fallback", map[string]interface{}{
+			"value":    C.DownTrackQueueSize,
+			"fallback": 256,
+		})
+		C.DownTrackQueueSize = 256
+	}
+	if C.DownTrackDropPolicy != dropOldest && C.DownTrackDropPolicy != dropNewest {
+		sfuLogger.Warn("CONFIG", "Invalid down track drop policy, using fallback", map[string]interface{}{
+			"value":    C.DownTrackDropPolicy,
+			"fallback": dropOldest,
+		})
+		C.DownTrackDropPolicy = dropOldest
+	}
+	if _, ok := rolePermissions[C.DefaultRole]; !ok {
+		sfuLogger.Warn("CONFIG", "Invalid default role, using fallback", map[string]interface{}{
+			"value":    C.DefaultRole,
+			"fallback": roleAttendee,
+		})
+		C.DefaultRole = roleAttendee
+	}
+	if C.CommandAuthMode != commandAuthOff && C.CommandAuthMode != commandAuthOptional && C.CommandAuthMode != commandAuthRequired {
+		sfuLogger.Warn("CONFIG", "Invalid command authentication mode, using fallback", map[string]interface{}{
+			"value":    C.CommandAuthMode,
+			"fallback": commandAuthRequired,
+		})
+		C.CommandAuthMode = commandAuthRequired
+	}
+	if C.LobbyTimeout <= 0 {
+		sfuLogger.Warn("CONFIG", "Invalid lobby timeout, using fallback", map[string]interface{}{
+			"value":    C.LobbyTimeout.String(),
+			"fallback": "10m0s",
+		})
+		C.LobbyTimeout = 10 * time.Minute
+	}
+	if C.ViewerRenegotiationDelay <= 0 {
+		sfuLogger.Warn("CONFIG", "Invalid viewer renegotiation delay, using fallback", map[string]interface{}{
+			"value":    C.ViewerRenegotiationDelay.String(),
+			"fallback": "500ms",
+		})
+		C.ViewerRenegotiationDelay = 500 * time.Millisecond
+	}
+	if net.ParseIP(C.IngestBindAddress) == nil {
+		sfuLogger.Warn("CONFIG", "Invalid ingest bind address, using fallback", map[string]interface{}{
+			"value":    C.IngestBindAddress,
+			"fallback": "0.0.0.0",
+		})
+		C.IngestBindAddress = "0.0.0.0"
 	}
 
 	sfuLogger.Info("CONFIG", "Configuration loaded", map[string]interface{}{
-		"SFUID":             C.SFUID,
-		"LogLevel":          C.LogLevel.String(),
-		"SignalingURL":      C.SignalingURL,
-		"RedisClusterNodes": C.RedisClusterNodes,
-		"KafkaBrokers":      C.KafkaBrokers,
-		"ICEServers":        C.ICEServers,
+		"SFUID":                C.SFUID,
+		"LogLevel":             C.LogLevel.String(),
+		"SignalingURL":         C.SignalingURL,
+		"RedisClusterNodes":    C.RedisClusterNodes,
+		"KafkaBrokers":         C.KafkaBrokers,
+		"ICEServers":           C.ICEServers,
+		"MeetingLeaseTTL":      C.MeetingLeaseTTL.String(),
+		"MigrationTimeout":     C.MigrationTimeout.String(),
+		"ReconnectGracePeriod": C.ReconnectGracePeriod.String(),
+		"ICEUDPMuxPort":        C.ICEUDPMuxPort,
+		"ICEPortRange":         []int{C.ICEPortMin, C.ICEPortMax},
+		"ICETCPPort":           C.ICETCPPort,
+		"NAT1To1IPs":           C.NAT1To1IPs,
+		"ICEInterfaces":        C.ICEInterfaces,
+		"ICEAllowedNetworks":   C.ICEAllowedNetworks,
+		"ICEMDNSMode":          C.ICEMDNSMode,
+		"TURNEnabled":          C.TURNEnabled,
+		"TURNPorts":            []int{C.TURNPort, C.TURNTCPPort, C.TURNTLSPort},
+		"TURNPublicIP":         C.TURNPublicIP,
+		"TURNCredentialTTL":    C.TURNCredentialTTL.String(),
+		"AudioCodecs":          C.AudioCodecs,
+		"VideoCodecs":          C.VideoCodecs,
+		"H264Profiles":         C.H264Profiles,
+		"VideoRTX":             C.VideoRTX,
+		"DownTrackQueueSize":   C.DownTrackQueueSize,
+		"DownTrackDropPolicy":  C.DownTrackDropPolicy,
+		"DataChannelMaxSize":   C.DataChannelMaxSize,
+		"DataChannelRateLimit": C.DataChannelRateLimit,
+		"DataChannelBurst":     C.DataChannelBurst,
+		"ChatPersistTopic":     C.ChatPersistTopic,
+		"MeetingEventsTopic":   C.MeetingEventsTopic,
+		"HistoryMaxLength":     C.HistoryMaxLength,
+		"HistoryTTL":           C.HistoryTTL.String(),
+		"HistoryOnJoin":        C.HistoryOnJoin,
+
+		"JoinTokenKeysFile": C.JoinTokenKeysFile,
+		"JoinTokenIssuer":   C.JoinTokenIssuer,
+		"JoinTokenAudience": C.JoinTokenAudience,
+		"DefaultRole":       C.DefaultRole,
+
+		"CommandAuthMode":          C.CommandAuthMode,
+		"CommandAuthSecretIssuers": C.CommandAuthSecretIssuers,
+		"CommandMaxAge":            C.CommandMaxAge.String(),
+		"KafkaTLSEnabled":          C.KafkaTLSEnabled,
+		"KafkaSASLMechanism":       C.KafkaSASLMechanism,
+
+		"LobbyTimeout":                C.LobbyTimeout.String(),
+		"LobbyAutoAdmitAuthenticated": C.LobbyAutoAdmitAuthenticated,
+
+		"MaxScreenShares": C.MaxScreenShares,
+
+		"WebinarMaxViewers":        C.WebinarMaxViewers,
+		"ViewerRenegotiationDelay": C.ViewerRenegotiationDelay.String(),
+
+		"EgressSDPDir":      C.EgressSDPDir,
+		"IngestBindAddress": C.IngestBindAddress,
+		"IngestIdleTimeout": C.IngestIdleTimeout.String(),
+		"PlaybackDir":       C.PlaybackDir,
 	})
 }
 
@@ -86,6 +349,77 @@ func getEnvSlice(key, fallback string) []string {
 	return strings.Split(value, ",")
 }
 
+// getEnvList reads an optional comma-separated environment variable, dropping empty entries
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range getEnvSlice(key, "") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getICEServersEnv builds the STUN server list, allowing it to be disabled with an empty value
+func getICEServersEnv(key, fallback string) []webrtc.ICEServer {
+	value := getEnv(key, fallback)
+	var urls []string
+	for _, url := range strings.Split(value, ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			urls = append(urls, url)
+		}
+	}
+	if len(urls) == 0 {
+		return nil
+	}
+	return []webrtc.ICEServer{{URLs: urls}}
+}
+
+// getEnvInt reads an integer from an environment variable or returns a default value
+func getEnvInt(key string, fallback int) int {
+	value := getEnv(key, strconv.Itoa(fallback))
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		sfuLogger.Warn("CONFIG", "Invalid integer specified, using fallback", map[string]interface{}{
+			"key":      key,
+			"value":    value,
+			"fallback": fallback,
+		})
+		return fallback
+	}
+	return n
+}
+
+// getEnvBool reads a boolean from an environment variable or returns a default value
+func getEnvBool(key string, fallback bool) bool {
+	value := getEnv(key, strconv.FormatBool(fallback))
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		sfuLogger.Warn("CONFIG", "Invalid boolean specified, using fallback", map[string]interface{}{
+			"key":      key,
+			"value":    value,
+			"fallback": fallback,
+		})
+		return fallback
+	}
+	return b
+}
+
+// getEnvDuration reads a duration (e.g. "30s") from an environment variable or returns a default value
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := getEnv(key, fallback.String())
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		sfuLogger.Warn("CONFIG", "Invalid duration specified, using fallback", map[string]interface{}{
+			"key":      key,
+			"value":    value,
+			"fallback": fallback.String(),
+		})
+		return fallback
+	}
+	return d
+}
+
 // getLogLevelEnv reads the log level from an environment variable
 func getLogLevelEnv(key string, fallback LogLevel) LogLevel {
 	value := getEnv(key, fallback.String())
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pion/webrtc/v3"
+)
+
+// Both sides create the meeting data channel with a fixed ID instead of announcing it in-band,
+// so clients can open it before their first offer: createDataChannel("meeting", {negotiated: true, id: 0})
+const (
+	meetingDataChannelLabel = "meeting"
+	meetingDataChannelID    = 0
+)
+
+const (
+	dataMessageDedupeWindow = time.Minute // How long the IDs of relayed data channel messages are remembered
+	dataMessageEnvelopeSize = 512         // Room for the fields the SFU adds to a client's message
+)
+
+// Message types clients may send over the meeting data channel
+var relayedDataChannelTypes = map[string]bool{
+	"chat":     true,
+	"reaction": true,
+	"app":      true,
+	"e2ee":     true, // Opaque key exchange between participants, never stored or published
+}
+
+// messageRateLimiter is a token bucket limiting the messages one client may send
+type messageRateLimiter struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newMessageRateLimiter() *messageRateLimiter {
+	return &messageRateLimiter{tokens: float64(C.DataChannelBurst), last: time.Now()}
+}
+
+// allow takes a token if one is available
+func (l *messageRateLimiter) allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * C.DataChannelRateLimit
+	if l.tokens > float64(C.DataChannelBurst) {
+		l.tokens = float64(C.DataChannelBurst)
+	}
+	l.last = now
+
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// messageDeduper remembers the data channel messages a meeting relayed, so a copy reaching
+// this SFU again over another relay is not delivered twice
+type messageDeduper struct {
+	mu     sync.Mutex
+	seen   map[string]time.Time // Map<sender + "/" + message ID, first seen>
+	pruned time.Time
+}
+
+// firstSeen records a message and reports whether it was not seen within the dedupe window
+func (d *messageDeduper) firstSeen(from, id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	if d.seen == nil {
+		d.seen = make(map[string]time.Time)
+	}
+	if now.Sub(d.pruned) > dataMessageDedupeWindow {
+		for key, seenAt := range d.seen {
+			if now.Sub(seenAt) > dataMessageDedupeWindow {
+				delete(d.seen, key)
+			}
+		}
+		d.pruned = now
+	}
+
+	key := from + "/" + id
+	if seenAt, ok := d.seen[key]; ok && now.Sub(seenAt) <= dataMessageDedupeWindow {
+		return false
+	}
+	d.seen[key] = now
+	return true
+}
+
+// setupDataChannel creates the client's meeting data channel and relays what it receives
+func setupDataChannel(meeting *Meeting, clientPeer *ClientPeer) error {
+	negotiated := true
+	id := uint16(meetingDataChannelID)
+	dataChannel, err := clientPeer.PeerConnection.CreateDataChannel(meetingDataChannelLabel, &webrtc.DataChannelInit{
+		Negotiated: &negotiated,
+		ID:         &id,
+	})
+	if err != nil {
+		return err
+	}
+
+	clientPeer.dataChannel = dataChannel
+	clientPeer.dataLimiter = newMessageRateLimiter()
+	clientPeer.dataChannelOpen = make(chan struct{})
+
+	dataChannel.OnOpen(func() {
+		sfuLogger.Debug("DATACHANNEL", "Meeting data channel open", map[string]interface{}{
+			"clientID":  clientPeer.ID,
+			"meetingID": meeting.ID,
+		})
+		close(clientPeer.dataChannelOpen)
+	})
+	dataChannel.OnMessage(func(msg webrtc.DataChannelMessage) {
+		handleDataChannelMessage(meeting, clientPeer, msg.Data)
+	})
+	return nil
+}
+
+// handleDataChannelMessage validates a client's message and relays it to the meeting
+func handleDataChannelMessage(meeting *Meeting, clientPeer *ClientPeer, data []byte) {
+	if len(data) > C.DataChannelMaxSize {
+		sendDataChannelError(clientPeer, "message_too_large")
+		return
+	}
+	if !clientPeer.dataLimiter.allow() {
+		sendDataChannelError(clientPeer, "rate_limited")
+		return
+	}
+
+	var message DataChannelMessage
+	if err := json.Unmarshal(data, &message); err != nil {
+		sendDataChannelError(clientPeer, "invalid_message")
+		return
+	}
+	if !relayedDataChannelTypes[message.Type] {
+		sendDataChannelError(clientPeer, "unsupported_type")
+		return
+	}
+
+	// Never trust sender information from the client
+	message.From = clientPeer.ID
+	message.MeetingID = meeting.ID
+	message.Timestamp = time.Now().UnixMilli()
+	if message.ID == "" {
+		message.ID = uuid.New().String()
+	}
+	if !meeting.dataMessages.firstSeen(message.From, message.ID) {
+		sendDataChannelError(clientPeer, "duplicate_id")
+		return
+	}
+
+	raw, err := json.Marshal(message)
+	if err != nil {
+		sfuLogger.Error("DATACHANNEL", "Error marshalling data channel message", err, map[string]interface{}{
+			"clientID":  clientPeer.ID,
+			"meetingID": meeting.ID,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return
+	}
+
+	if !relayDataChannelMessage(meeting, clientPeer.ID, message.To, raw, "") {
+		sendDataChannelError(clientPeer, "unknown_recipient")
+		return
+	}
+
+	if historyMessageTypes[message.Type] && message.To == "" {
+		// Directed messages stay private and are not replayed to later joiners
+		go appendMeetingHistory(meeting.ID, raw)
+	}
+	if message.Type == "chat" && C.ChatPersistTopic != "" {
+		go publishKafkaJSON(C.ChatPersistTopic, meeting.ID, "chatMessage", message)
+	}
+}
+
+// relayDataChannelMessage sends a message to one participant, or to everyone but the
+// sender when to is empty. Participants on other SFUs are reached through the SFUs this
+// meeting is relayed with, except fromSFUID the message came from. It returns false if the
+// recipient is not connected here and there is no other SFU it could be on.
+func relayDataChannelMessage(meeting *Meeting, senderID, to string, raw []byte, fromSFUID string) bool {
+	meeting.mu.RLock()
+	var recipients []*ClientPeer
+	if to != "" {
+		if clientPeer, ok := meeting.clients[to]; ok {
+			recipients = append(recipients, clientPeer)
+		}
+	} else {
+		for clientID, clientPeer := range meeting.clients {
+			if clientID != senderID {
+				recipients = append(recipients, clientPeer)
+			}
+		}
+	}
+	var remoteSFUs []string
+	if to == "" || len(recipients) == 0 {
+		remoteSFUs = relayedSFUs(meeting, fromSFUID)
+	}
+	meeting.mu.RUnlock()
+
+	if to != "" && len(recipients) == 0 && len(remoteSFUs) == 0 {
+		return false
+	}
+
+	for _, clientPeer := range recipients {
+		sendDataChannel(clientPeer, raw)
+	}
+	for _, remoteSFUID := range remoteSFUs {
+		sendSFUCommand(remoteSFUID, SFUCommand{
+			Type: "relayDataMessage",
+			Payload: map[string]interface{}{
+				"meetingId": meeting.ID,
+				"sfuId":     sfuID,
+				"message":   string(raw),
+			},
+		})
+	}
+	return true
+}
+
+// relayedSFUs lists the SFUs the meeting has a relay with in either direction, except
+// excludeSFUID. Caller must hold meeting.mu.
+func relayedSFUs(meeting *Meeting, excludeSFUID string) []string {
+	seen := make(map[string]bool)
+	var sfuIDs []string
+	for _, relay := range meeting.relays {
+		if relay.RemoteSFUID == excludeSFUID || seen[relay.RemoteSFUID] {
+			continue
+		}
+		seen[relay.RemoteSFUID] = true
+		sfuIDs = append(sfuIDs, relay.RemoteSFUID)
+	}
+	return sfuIDs
+}
+
+// handleRelayDataMessage delivers a data channel message relayed by another SFU of the
+// meeting and passes it on to the SFUs beyond this one.
+// Payload: sfuId (the relaying SFU), message (the message as sent to clients).
+func handleRelayDataMessage(sfuCommand SFUCommand, meeting *Meeting) {
+	remoteSFUID, _ := sfuCommand.Payload["sfuId"].(string)
+	raw, _ := sfuCommand.Payload["message"].(string)
+	var message DataChannelMessage
+	if remoteSFUID == "" || json.Unmarshal([]byte(raw), &message) != nil || message.ID == "" || message.From == "" {
+		sfuLogger.Error("DATACHANNEL", "Missing or invalid sfuId or message in relayDataMessage command", nil, map[string]interface{}{
+			"payload": sfuCommand.Payload,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return
+	}
+	if len(raw) > C.DataChannelMaxSize+dataMessageEnvelopeSize || !relayedDataChannelTypes[message.Type] || message.MeetingID != meeting.ID {
+		sfuLogger.Warn("DATACHANNEL", "Dropping invalid relayed data channel message", map[string]interface{}{
+			"meetingID":   meeting.ID,
+			"remoteSFUID": remoteSFUID,
+			"type":        message.Type,
+			"size":        len(raw),
+		})
+		return
+	}
+
+	// Messages only travel between SFUs relaying the meeting's media
+	meeting.mu.RLock()
+	related := false
+	for _, relay := range meeting.relays {
+		related = related || relay.RemoteSFUID == remoteSFUID
+	}
+	meeting.mu.RUnlock()
+	if !related || sfuCommand.issuer != "" && sfuCommand.issuer != remoteSFUID {
+		sfuLogger.Warn("DATACHANNEL", "Dropping data channel message from an SFU not relaying the meeting", map[string]interface{}{
+			"meetingID":   meeting.ID,
+			"remoteSFUID": remoteSFUID,
+			"issuer":      sfuCommand.issuer,
+		})
+		return
+	}
+
+	if !meeting.dataMessages.firstSeen(message.From, message.ID) {
+		return
+	}
+	relayDataChannelMessage(meeting, message.From, message.To, []byte(raw), remoteSFUID)
+}
+
+// sendDataChannel writes a message to a client's data channel if it is open
+func sendDataChannel(clientPeer *ClientPeer, raw []byte) {
+	dataChannel := clientPeer.dataChannel
+	if dataChannel == nil || dataChannel.ReadyState() != webrtc.DataChannelStateOpen {
+		return
+	}
+	if err := dataChannel.SendText(string(raw)); err != nil {
+		sfuLogger.Debug("DATACHANNEL", "Error sending data channel message", map[string]interface{}{
+			"clientID": clientPeer.ID,
+			"error":    err.Error(),
+		})
+	}
+}
+
+// sendDataChannelError tells a client why its message was not relayed
+func sendDataChannelError(clientPeer *ClientPeer, reason string) {
+	sfuLogger.Debug("DATACHANNEL", "Rejected data channel message", map[string]interface{}{
+		"clientID":  clientPeer.ID,
+		"meetingID": clientPeer.MeetingID,
+		"reason":    reason,
+	})
+
+	data, _ := json.Marshal(map[string]string{"reason": reason})
+	raw, err := json.Marshal(DataChannelMessage{
+		Type:      "error",
+		MeetingID: clientPeer.MeetingID,
+		Timestamp: time.Now().UnixMilli(),
+		Data:      data,
+	})
+	if err != nil {
+		return
+	}
+	sendDataChannel(clientPeer, raw)
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// recordingProducer records the Kafka messages the SFU sends instead of producing them
+type recordingProducer struct {
+	sarama.SyncProducer
+	mu       sync.Mutex
+	messages []*sarama.ProducerMessage
+}
+
+func (p *recordingProducer) SendMessage(msg *sarama.ProducerMessage) (int32, int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = append(p.messages, msg)
+	return 0, int64(len(p.messages)), nil
+}
+
+// relayedDataMessages returns the relayDataMessage commands sent, by target SFU, and forgets them
+func (p *recordingProducer) relayedDataMessages(t *testing.T) map[string]DataChannelMessage {
+	t.Helper()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	relayed := make(map[string]DataChannelMessage)
+	for _, msg := range p.messages {
+		value, _ := msg.Value.Encode()
+		var command SFUCommand
+		if err := json.Unmarshal(value, &command); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Topic != "sfu_commands" || command.Type != "relayDataMessage" {
+			continue
+		}
+		key, _ := msg.Key.Encode()
+		if command.Payload["sfuId"] != sfuID {
+			t.Fatalf("relayDataMessage names %v as its sender, want %s", command.Payload["sfuId"], sfuID)
+		}
+		var message DataChannelMessage
+		if err := json.Unmarshal([]byte(command.Payload["message"].(string)), &message); err != nil {
+			t.Fatal(err)
+		}
+		relayed[string(key)] = message
+	}
+	p.messages = nil
+	return relayed
+}
+
+// setupDataRelay runs the test as SFU localSFUID with relays to remoteSFUIDs, sending Kafka messages to a recorder
+func setupDataRelay(t *testing.T, localSFUID string, remoteSFUIDs ...string) (*Meeting, *recordingProducer) {
+	t.Helper()
+	previousSFUID, previousProducer, previousMode := sfuID, producer, C.CommandAuthMode
+	t.Cleanup(func() {
+		sfuID, producer, C.CommandAuthMode = previousSFUID, previousProducer, previousMode
+	})
+
+	recorder := &recordingProducer{}
+	sfuID, producer, C.CommandAuthMode = localSFUID, recorder, commandAuthOff
+	meeting := &Meeting{
+		ID:      "meeting-1",
+		clients: make(map[string]*ClientPeer),
+		relays:  make(map[string]*RelayPeer),
+	}
+	for i, remoteSFUID := range remoteSFUIDs {
+		// A migration relays both ways, so one remote SFU can have two relays
+		relayID := remoteSFUID + "-relay"
+		meeting.relays[relayID] = &RelayPeer{ID: relayID, RemoteSFUID: remoteSFUID, Outbound: i%2 == 0}
+		meeting.relays[relayID+"-back"] = &RelayPeer{ID: relayID + "-back", RemoteSFUID: remoteSFUID}
+	}
+	return meeting, recorder
+}
+
+func addDataClient(meeting *Meeting, clientID string) *ClientPeer {
+	clientPeer := &ClientPeer{ID: clientID, MeetingID: meeting.ID, dataLimiter: newMessageRateLimiter()}
+	meeting.clients[clientID] = clientPeer
+	return clientPeer
+}
+
+func relayDataMessageCommand(t *testing.T, fromSFUID string, message DataChannelMessage) SFUCommand {
+	t.Helper()
+	raw, err := json.Marshal(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return SFUCommand{Type: "relayDataMessage", Payload: map[string]interface{}{
+		"meetingId": "meeting-1",
+		"sfuId":     fromSFUID,
+		"message":   string(raw),
+	}}
+}
+
+func TestDataChannelMessageReachesRelayedSFUs(t *testing.T) {
+	meeting, recorder := setupDataRelay(t, "sfu-origin", "sfu-edge-1", "sfu-edge-2")
+	sender := addDataClient(meeting, "client-1")
+
+	handleDataChannelMessage(meeting, sender, []byte(`{"type":"app","id":"message-1","from":"spoofed","data":{"x":1}}`))
+
+	relayed := recorder.relayedDataMessages(t)
+	if len(relayed) != 2 {
+		t.Fatalf("message relayed to %v, want sfu-edge-1 and sfu-edge-2 once each", relayed)
+	}
+	for remoteSFUID, message := range relayed {
+		if message.ID != "message-1" || message.From != "client-1" || message.MeetingID != "meeting-1" || message.Timestamp == 0 {
+			t.Fatalf("message relayed to %s = %+v", remoteSFUID, message)
+		}
+	}
+
+	// The same ID from the same client is a duplicate
+	handleDataChannelMessage(meeting, sender, []byte(`{"type":"app","id":"message-1"}`))
+	if relayed := recorder.relayedDataMessages(t); len(relayed) != 0 {
+		t.Fatalf("duplicate message relayed to %v", relayed)
+	}
+}
+
+func TestDirectedDataChannelMessage(t *testing.T) {
+	meeting, recorder := setupDataRelay(t, "sfu-origin", "sfu-edge-1")
+	addDataClient(meeting, "client-1")
+	addDataClient(meeting, "client-2")
+
+	// A recipient connected here is not looked for elsewhere
+	if !relayDataChannelMessage(meeting, "client-1", "client-2", []byte(`{}`), "") {
+		t.Fatal("local recipient not found")
+	}
+	if relayed := recorder.relayedDataMessages(t); len(relayed) != 0 {
+		t.Fatalf("message for a local recipient relayed to %v", relayed)
+	}
+
+	// A recipient elsewhere may be on another SFU of the meeting
+	if !relayDataChannelMessage(meeting, "client-1", "client-remote", []byte(`{}`), "") {
+		t.Fatal("message for a recipient on another SFU refused")
+	}
+	if relayed := recorder.relayedDataMessages(t); len(relayed) != 1 {
+		t.Fatalf("message for a remote recipient relayed to %v, want sfu-edge-1", relayed)
+	}
+
+	// Without relays the recipient is unknown
+	meeting.relays = make(map[string]*RelayPeer)
+	if relayDataChannelMessage(meeting, "client-1", "client-remote", []byte(`{}`), "") {
+		t.Fatal("message for an unknown recipient accepted")
+	}
+}
+
+func TestRelayDataMessageForwardsOnce(t *testing.T) {
+	// An edge relayed by the origin, also relaying to a second edge
+	meeting, recorder := setupDataRelay(t, "sfu-edge-1", "sfu-origin", "sfu-edge-2")
+	addDataClient(meeting, "viewer-1")
+	message := DataChannelMessage{Type: "chat", ID: "message-1", From: "client-1", MeetingID: "meeting-1", Timestamp: time.Now().UnixMilli()}
+
+	handleRelayDataMessage(relayDataMessageCommand(t, "sfu-origin", message), meeting)
+	relayed := recorder.relayedDataMessages(t)
+	if _, ok := relayed["sfu-edge-2"]; !ok || len(relayed) != 1 {
+		t.Fatalf("message relayed to %v, want only sfu-edge-2 and never back to sfu-origin", relayed)
+	}
+	if relayed["sfu-edge-2"].From != "client-1" {
+		t.Fatalf("forwarded message = %+v", relayed["sfu-edge-2"])
+	}
+
+	// The copy coming back over the other edge is dropped
+	handleRelayDataMessage(relayDataMessageCommand(t, "sfu-edge-2", message), meeting)
+	if relayed := recorder.relayedDataMessages(t); len(relayed) != 0 {
+		t.Fatalf("duplicate relayed to %v", relayed)
+	}
+
+	// Another sender may use the same message ID
+	message.From = "client-2"
+	handleRelayDataMessage(relayDataMessageCommand(t, "sfu-origin", message), meeting)
+	if relayed := recorder.relayedDataMessages(t); len(relayed) != 1 {
+		t.Fatalf("message of another sender relayed to %v, want sfu-edge-2", relayed)
+	}
+}
+
+func TestRelayDataMessageRejectsUnrelatedSFUs(t *testing.T) {
+	meeting, recorder := setupDataRelay(t, "sfu-edge-1", "sfu-origin", "sfu-edge-2")
+	message := DataChannelMessage{Type: "chat", ID: "message-1", From: "client-1", MeetingID: "meeting-1"}
+
+	tests := []struct {
+		name    string
+		command SFUCommand
+	}{
+		{name: "SFU without a relay of the meeting", command: relayDataMessageCommand(t, "sfu-stranger", message)},
+		{
+			name: "signed by another SFU than the one named",
+			command: func() SFUCommand {
+				command := relayDataMessageCommand(t, "sfu-origin", message)
+				command.issuer = "sfu-stranger"
+				return command
+			}(),
+		},
+		{name: "type clients may not send", command: relayDataMessageCommand(t, "sfu-origin", DataChannelMessage{Type: "error", ID: "message-2", From: "client-1", MeetingID: "meeting-1"})},
+		{name: "other meeting", command: relayDataMessageCommand(t, "sfu-origin", DataChannelMessage{Type: "chat", ID: "message-3", From: "client-1", MeetingID: "meeting-2"})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handleRelayDataMessage(tt.command, meeting)
+			if relayed := recorder.relayedDataMessages(t); len(relayed) != 0 {
+				t.Fatalf("message relayed to %v", relayed)
+			}
+		})
+	}
+
+	// None of the rejected copies was remembered
+	handleRelayDataMessage(relayDataMessageCommand(t, "sfu-origin", message), meeting)
+	if relayed := recorder.relayedDataMessages(t); len(relayed) != 1 {
+		t.Fatalf("valid message relayed to %v, want sfu-edge-2", relayed)
+	}
+}
+
+func TestMessageDeduper(t *testing.T) {
+	var deduper messageDeduper
+	if !deduper.firstSeen("client-1", "message-1") {
+		t.Fatal("first message reported as seen")
+	}
+	if deduper.firstSeen("client-1", "message-1") {
+		t.Fatal("duplicate reported as new")
+	}
+	if !deduper.firstSeen("client-2", "message-1") {
+		t.Fatal("same ID from another sender reported as seen")
+	}
+
+	// Past the window the ID is forgotten
+	deduper.seen["client-1/message-1"] = time.Now().Add(-2 * dataMessageDedupeWindow)
+	deduper.pruned = time.Time{}
+	if !deduper.firstSeen("client-1", "message-1") {
+		t.Fatal("expired ID reported as seen")
+	}
+}
@@ -0,0 +1,460 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+// DownTrack forwards one routed track to one subscriber. It implements webrtc.TrackLocal and
+// owns the subscriber-side SSRC, payload type and sequence number/timestamp offsets, so the
+// subscriber sees one continuous stream across pauses, dropped layers and source switches.
+// Packets are queued by the router and written by the down track's own goroutine, so a
+// slow subscriber only delays (and eventually drops) its own packets.
+type DownTrack struct {
+	router       *TrackRouter
+	subscriberID string
+
+	queue     chan *forwardPacket
+	done      chan struct{}
+	closeOnce sync.Once
+	reselect  int32  // Set by the router when new layer bitrates are available
+	overflows uint64 // Packets dropped because the queue was full
+
+	mu          sync.Mutex
+	bound       bool
+	bindingID   string
+	ssrc        webrtc.SSRC
+	payloadType webrtc.PayloadType
+	writeStream webrtc.TrackLocalWriter
+	ddExtID     uint8 // Dependency descriptor extension ID negotiated with the subscriber
+
+	paused    bool
+	suspended bool // Held by the subscriber's media mode (audio-only)
+	resync    bool // The next packet comes from a new source, re-base the offsets
+	started   bool
+	seqOffset uint16
+	tsOffset  uint32
+	lastSeq   uint16
+	lastTS    uint32
+	lastWrite time.Time
+
+	layers    *svcSelector        // nil unless the track is SVC
+	allocator *bandwidthAllocator // Shares the subscriber's bandwidth among its SVC tracks, set before RTCP is read
+
+	header     rtp.Header      // Scratch header reused by the writer goroutine
+	extensions []rtp.Extension // Scratch extensions for dependency descriptor ID rewrites
+
+	packets     uint64
+	bytes       uint64
+	dropped     uint64
+	writeErrors uint64
+}
+
+// newDownTrack creates a down track and starts its writer goroutine
+func newDownTrack(router *TrackRouter, subscriberID string) *DownTrack {
+	downTrack := &DownTrack{
+		router:       router,
+		subscriberID: subscriberID,
+		queue:        make(chan *forwardPacket, C.DownTrackQueueSize),
+		done:         make(chan struct{}),
+	}
+	if router.svc != nil {
+		downTrack.layers = newSVCSelector()
+	}
+	go downTrack.writeLoop()
+	return downTrack
+}
+
+// Close stops the writer goroutine and releases queued packets
+func (d *DownTrack) Close() {
+	d.closeOnce.Do(func() {
+		close(d.done)
+		if d.allocator != nil {
+			d.allocator.remove(d)
+		}
+	})
+}
+
+// enqueue hands a packet to the writer goroutine, applying the drop policy when the queue is full.
+// The down track owns one reference of the packet.
+func (d *DownTrack) enqueue(fp *forwardPacket) {
+	select {
+	case <-d.done:
+		fp.release()
+		return
+	case d.queue <- fp:
+		return
+	default:
+	}
+
+	// The subscriber is not keeping up
+	atomic.AddUint64(&d.overflows, 1)
+	if C.DownTrackDropPolicy == dropOldest {
+		select {
+		case oldest := <-d.queue:
+			oldest.release()
+		default:
+		}
+		select {
+		case d.queue <- fp:
+		default:
+			fp.release()
+		}
+	} else {
+		fp.release()
+	}
+
+	// The subscriber's decoder needs a keyframe to recover from the gap
+	d.router.RequestKeyframe()
+}
+
+// writeLoop writes queued packets to the subscriber until the down track is closed
+func (d *DownTrack) writeLoop() {
+	for {
+		select {
+		case fp := <-d.queue:
+			if atomic.CompareAndSwapInt32(&d.reselect, 1, 0) {
+				d.reselectLayers()
+			}
+			d.writeRTP(&fp.packet, fp.info, fp.ddExtID)
+			fp.release()
+		case <-d.done:
+			for {
+				select {
+				case fp := <-d.queue:
+					fp.release()
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// Bind is called by the PeerConnection once the subscriber negotiated the track
+func (d *DownTrack) Bind(ctx webrtc.TrackLocalContext) (webrtc.RTPCodecParameters, error) {
+	codec, ok := matchCodec(d.router.Codec(), ctx.CodecParameters())
+	if !ok {
+		return webrtc.RTPCodecParameters{}, webrtc.ErrUnsupportedCodec
+	}
+
+	d.mu.Lock()
+	d.bound = true
+	d.bindingID = ctx.ID()
+	d.ssrc = ctx.SSRC()
+	d.payloadType = codec.PayloadType
+	d.writeStream = ctx.WriteStream()
+	d.ddExtID = headerExtensionID(ctx.HeaderExtensions(), av1DependencyDescriptorURI)
+	d.mu.Unlock()
+
+	// The subscriber can only start decoding at a keyframe
+	d.router.RequestKeyframe()
+	return codec, nil
+}
+
+// bindWriter binds the down track to a writer outside a PeerConnection, such as an RTP egress.
+// The receiver negotiated no header extensions, so dependency descriptors are stripped.
+func (d *DownTrack) bindWriter(ssrc webrtc.SSRC, payloadType webrtc.PayloadType, writer webrtc.TrackLocalWriter) {
+	d.mu.Lock()
+	d.bound = true
+	d.ssrc = ssrc
+	d.payloadType = payloadType
+	d.writeStream = writer
+	d.ddExtID = 0
+	d.mu.Unlock()
+
+	d.router.RequestKeyframe()
+}
+
+// matchCodec finds the negotiated codec for the router's codec, preferring the same H.264 profile
+func matchCodec(capability webrtc.RTPCodecCapability, negotiated []webrtc.RTPCodecParameters) (webrtc.RTPCodecParameters, bool) {
+	key := codecKey(capability.MimeType, capability.SDPFmtpLine)
+	for _, codec := range negotiated {
+		if codecKey(codec.MimeType, codec.SDPFmtpLine) == key {
+			return codec, true
+		}
+	}
+	for _, codec := range negotiated {
+		if strings.EqualFold(codec.MimeType, capability.MimeType) {
+			return codec, true
+		}
+	}
+	return webrtc.RTPCodecParameters{}, false
+}
+
+// Unbind is called when the subscriber's sender stops
+func (d *DownTrack) Unbind(ctx webrtc.TrackLocalContext) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.bindingID == ctx.ID() {
+		d.bound = false
+		d.writeStream = nil
+	}
+	return nil
+}
+
+// ID is the ID of the routed track
+func (d *DownTrack) ID() string { return d.router.ID() }
+
+// RID is empty, simulcast layers are not forwarded as separate encodings
+func (d *DownTrack) RID() string { return "" }
+
+// StreamID is the stream of the routed track
+func (d *DownTrack) StreamID() string { return d.router.StreamID() }
+
+// Kind is the kind of the routed track
+func (d *DownTrack) Kind() webrtc.RTPCodecType { return d.router.Kind() }
+
+// SSRC is the SSRC the subscriber receives the track on (0 until bound)
+func (d *DownTrack) SSRC() webrtc.SSRC {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.ssrc
+}
+
+// SetPaused stops or resumes forwarding on the subscriber's request, without renegotiation
+func (d *DownTrack) SetPaused(paused bool) {
+	d.updateHold(func() { d.paused = paused })
+}
+
+// SetSuspended stops or resumes forwarding because of the subscriber's media mode.
+// It is tracked apart from SetPaused so leaving audio-only mode keeps paused tracks paused.
+func (d *DownTrack) SetSuspended(suspended bool) {
+	d.updateHold(func() { d.suspended = suspended })
+}
+
+func (d *DownTrack) updateHold(update func()) {
+	d.mu.Lock()
+	wasHeld := d.paused || d.suspended
+	update()
+	resumed := wasHeld && !d.paused && !d.suspended
+	if resumed && d.layers != nil {
+		// Decoding restarts at a keyframe
+		d.layers.currentSpatial = -1
+	}
+	d.mu.Unlock()
+
+	if resumed {
+		d.router.RequestKeyframe()
+	}
+}
+
+// Paused reports whether forwarding is paused
+func (d *DownTrack) Paused() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.paused || d.suspended
+}
+
+// SetLayerLimits applies the subscriber's requested SVC layers and resolution.
+// It returns false for tracks without SVC layers.
+func (d *DownTrack) SetLayerLimits(maxSpatial, maxTemporal, maxHeight int) bool {
+	if d.layers == nil {
+		return false
+	}
+
+	d.mu.Lock()
+	d.layers.maxSpatial = clampLayer(maxSpatial, maxSVCSpatialLayers)
+	d.layers.maxTemporal = clampLayer(maxTemporal, maxSVCTemporalLayers)
+	d.layers.maxHeight = maxHeight
+	needKeyframe := d.layers.selectLayers(d.router.svc)
+	d.mu.Unlock()
+
+	if needKeyframe {
+		d.router.RequestKeyframe()
+	}
+	return true
+}
+
+// setBandwidth applies the share of the subscriber's bandwidth allocated to this SVC track
+func (d *DownTrack) setBandwidth(bps uint64) {
+	d.mu.Lock()
+	// A zero bandwidth would mean "unknown"; the base layer is always forwarded anyway
+	d.layers.bandwidth = max(bps, 1)
+	needKeyframe := d.layers.selectLayers(d.router.svc)
+	d.mu.Unlock()
+
+	if needKeyframe {
+		d.router.RequestKeyframe()
+	}
+}
+
+// maxBitrate is the bitrate of the highest layers the subscriber allows (0 = not measured yet)
+func (d *DownTrack) maxBitrate() uint64 {
+	d.mu.Lock()
+	maxSpatial, maxTemporal := d.layers.maxSpatial, d.layers.maxTemporal
+	d.mu.Unlock()
+	return d.router.svc.cumulativeBitrate(maxSpatial, maxTemporal)
+}
+
+// switchSource makes the next packet re-base the offsets onto a new source
+func (d *DownTrack) switchSource() {
+	d.mu.Lock()
+	d.resync = true
+	if d.layers != nil {
+		d.layers.currentSpatial = -1
+	}
+	d.mu.Unlock()
+}
+
+// reselectLayers re-evaluates the SVC layers after a new layer bitrate measurement
+func (d *DownTrack) reselectLayers() {
+	if d.layers == nil {
+		return
+	}
+
+	d.mu.Lock()
+	needKeyframe := d.layers.selectLayers(d.router.svc)
+	d.mu.Unlock()
+
+	if needKeyframe {
+		d.router.RequestKeyframe()
+	}
+}
+
+// writeRTP rewrites a packet of the source for this subscriber and sends it
+func (d *DownTrack) writeRTP(p *rtp.Packet, info svcPacketInfo, ddExtID uint8) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.bound || d.writeStream == nil {
+		return
+	}
+
+	if d.resync {
+		d.resync = false
+		if d.started {
+			// Continue right after the last packet the subscriber got, with timestamps advanced by the gap
+			elapsed := uint32(time.Since(d.lastWrite).Seconds() * float64(d.router.Codec().ClockRate))
+			d.seqOffset = p.SequenceNumber - (d.lastSeq + 1)
+			d.tsOffset = p.Timestamp - (d.lastTS + elapsed)
+		}
+	}
+
+	if d.paused || d.suspended || (d.layers != nil && !d.layers.accept(info)) {
+		// Dropped packets are removed from the subscriber's sequence number space
+		d.seqOffset++
+		d.dropped++
+		return
+	}
+
+	header := &d.header
+	*header = p.Header
+	header.SSRC = uint32(d.ssrc)
+	header.PayloadType = uint8(d.payloadType)
+	header.SequenceNumber = p.SequenceNumber - d.seqOffset
+	header.Timestamp = p.Timestamp - d.tsOffset
+	if d.layers != nil && d.layers.endsPicture(info) {
+		header.Marker = true
+	}
+
+	if ddExtID != 0 && d.ddExtID != ddExtID {
+		d.extensions = append(d.extensions[:0], p.Extensions...)
+		header.Extensions = d.extensions
+		if payload := p.GetExtension(ddExtID); payload != nil {
+			_ = header.DelExtension(ddExtID)
+			if d.ddExtID != 0 {
+				_ = header.SetExtension(d.ddExtID, payload)
+			}
+		}
+	}
+
+	if _, err := d.writeStream.WriteRTP(header, p.Payload); err != nil {
+		d.writeErrors++
+		return
+	}
+
+	d.started = true
+	d.lastSeq = header.SequenceNumber
+	d.lastTS = header.Timestamp
+	d.lastWrite = time.Now()
+	d.packets++
+	d.bytes += uint64(len(p.Payload))
+}
+
+// handleRTCP processes the subscriber's feedback for this track
+func (d *DownTrack) handleRTCP(packets []rtcp.Packet) {
+	needKeyframe := false
+	var estimate uint64
+
+	d.mu.Lock()
+	for _, packet := range packets {
+		switch pkt := packet.(type) {
+		case *rtcp.PictureLossIndication, *rtcp.FullIntraRequest:
+			needKeyframe = true
+		case *rtcp.ReceiverEstimatedMaximumBitrate:
+			if d.layers != nil && d.allocator != nil {
+				estimate = uint64(pkt.Bitrate)
+			} else if d.layers != nil {
+				d.layers.bandwidth = uint64(pkt.Bitrate)
+				needKeyframe = d.layers.selectLayers(d.router.svc) || needKeyframe
+			}
+		case *rtcp.ReceiverReport:
+			if d.layers == nil {
+				continue
+			}
+			for _, report := range pkt.Reports {
+				if report.SSRC == uint32(d.ssrc) {
+					needKeyframe = d.layers.adjustForLoss(d.router.svc, report.FractionLost) || needKeyframe
+				}
+			}
+		}
+	}
+	d.mu.Unlock()
+
+	// The allocator locks every down track of the subscriber, so it runs outside d.mu
+	if estimate > 0 {
+		d.allocator.setEstimate(estimate)
+	}
+	if needKeyframe {
+		d.router.RequestKeyframe()
+	}
+}
+
+// Stats returns the forwarding statistics of this subscriber
+func (d *DownTrack) Stats() DownTrackStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	stats := DownTrackStats{
+		SubscriberID:  d.subscriberID,
+		TrackID:       d.router.ID(),
+		Kind:          d.router.Kind().String(),
+		SSRC:          uint32(d.ssrc),
+		Paused:        d.paused,
+		Suspended:     d.suspended,
+		Packets:       d.packets,
+		Bytes:         d.bytes,
+		Dropped:       d.dropped,
+		QueueDropped:  atomic.LoadUint64(&d.overflows),
+		Queued:        len(d.queue),
+		WriteErrors:   d.writeErrors,
+		SpatialLayer:  -1,
+		TemporalLayer: -1,
+	}
+	if d.layers != nil {
+		stats.SpatialLayer = d.layers.currentSpatial
+		stats.TemporalLayer = d.layers.currentTemporal
+		stats.Bandwidth = d.layers.bandwidth
+	}
+	return stats
+}
+
+// readSenderRTCP reads the subscriber's RTCP for a sender, which keeps the sender's
+// interceptors running and feeds keyframe and bandwidth feedback to the down track
+func readSenderRTCP(sender *webrtc.RTPSender, downTrack *DownTrack) {
+	for {
+		packets, _, err := sender.ReadRTCP()
+		if err != nil {
+			return
+		}
+		downTrack.handleRTCP(packets)
+	}
+}
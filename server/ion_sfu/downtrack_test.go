@@ -0,0 +1,288 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+var testVP8 = webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000}
+
+// recordingWriter records the headers a down track writes. While blocked is set,
+// WriteRTP waits for unblock, which holds the down track's writer goroutine.
+type recordingWriter struct {
+	mu      sync.Mutex
+	headers []rtp.Header
+	written chan struct{}
+	entered chan struct{}
+	blocked chan struct{}
+}
+
+func newRecordingWriter() *recordingWriter {
+	return &recordingWriter{written: make(chan struct{}, 1024)}
+}
+
+func (w *recordingWriter) block() {
+	w.entered = make(chan struct{}, 1)
+	w.blocked = make(chan struct{})
+}
+
+func (w *recordingWriter) unblock() { close(w.blocked) }
+
+func (w *recordingWriter) WriteRTP(header *rtp.Header, payload []byte) (int, error) {
+	if w.blocked != nil {
+		select {
+		case w.entered <- struct{}{}:
+		default:
+		}
+		<-w.blocked
+	}
+	w.mu.Lock()
+	w.headers = append(w.headers, *header)
+	w.mu.Unlock()
+	w.written <- struct{}{}
+	return len(payload), nil
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) { return len(b), nil }
+
+func (w *recordingWriter) sequenceNumbers() []uint16 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	seqs := make([]uint16, len(w.headers))
+	for i, header := range w.headers {
+		seqs[i] = header.SequenceNumber
+	}
+	return seqs
+}
+
+// waitWritten waits until n packets were written
+func (w *recordingWriter) waitWritten(t *testing.T, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		select {
+		case <-w.written:
+		case <-time.After(time.Second):
+			t.Fatalf("only %d of %d packets written", i, n)
+		}
+	}
+}
+
+func testPacket(seq uint16, ts uint32) *rtp.Packet {
+	return &rtp.Packet{
+		Header:  rtp.Header{Version: 2, PayloadType: 96, SequenceNumber: seq, Timestamp: ts, SSRC: 1111},
+		Payload: []byte{0x10, 0x02, 0x03},
+	}
+}
+
+// newTestDownTrack returns a down track bound to a recording writer. Tests call writeRTP
+// directly; the writer goroutine only serves the queue, which these tests leave empty.
+func newTestDownTrack(t *testing.T, codec webrtc.RTPCodecCapability) (*DownTrack, *recordingWriter) {
+	t.Helper()
+	router := newRouter("track", "stream", webrtc.RTPCodecTypeVideo, codec, false, trackSourceCamera)
+	downTrack := router.AddDownTrack("subscriber")
+	writer := newRecordingWriter()
+	downTrack.bindWriter(2222, 100, writer)
+	t.Cleanup(router.Close)
+	return downTrack, writer
+}
+
+func checkContiguous(t *testing.T, seqs []uint16, first uint16, count int) {
+	t.Helper()
+	if len(seqs) != count {
+		t.Fatalf("wrote %d packets %v, want %d", len(seqs), seqs, count)
+	}
+	for i, seq := range seqs {
+		if want := first + uint16(i); seq != want {
+			t.Fatalf("sequence numbers %v are not contiguous from %d", seqs, first)
+		}
+	}
+}
+
+func TestDownTrackRewritesHeader(t *testing.T) {
+	downTrack, writer := newTestDownTrack(t, testVP8)
+	downTrack.writeRTP(testPacket(100, 9000), svcPacketInfo{}, 0)
+
+	if len(writer.headers) != 1 {
+		t.Fatalf("wrote %d packets, want 1", len(writer.headers))
+	}
+	header := writer.headers[0]
+	if header.SSRC != 2222 || header.PayloadType != 100 || header.SequenceNumber != 100 || header.Timestamp != 9000 {
+		t.Fatalf("header = %+v, want subscriber SSRC and payload type with source numbering", header)
+	}
+}
+
+func TestDownTrackSequenceContiguousWhilePaused(t *testing.T) {
+	downTrack, writer := newTestDownTrack(t, testVP8)
+
+	seq := uint16(100)
+	write := func(n int) {
+		for i := 0; i < n; i++ {
+			downTrack.writeRTP(testPacket(seq, uint32(seq)*3000), svcPacketInfo{}, 0)
+			seq++
+		}
+	}
+
+	write(3)
+	downTrack.SetPaused(true)
+	write(5)
+	downTrack.SetPaused(false)
+	write(3)
+	downTrack.SetSuspended(true)
+	write(2)
+	downTrack.SetSuspended(false)
+	write(2)
+
+	checkContiguous(t, writer.sequenceNumbers(), 100, 8)
+	if stats := downTrack.Stats(); stats.Dropped != 7 || stats.Packets != 8 {
+		t.Fatalf("stats = %+v, want 7 dropped and 8 forwarded", stats)
+	}
+}
+
+func TestDownTrackSequenceContiguousAcrossWraparound(t *testing.T) {
+	downTrack, writer := newTestDownTrack(t, testVP8)
+
+	seq := uint16(65530)
+	for i := 0; i < 12; i++ {
+		downTrack.SetPaused(i%3 == 1)
+		downTrack.writeRTP(testPacket(seq, 0), svcPacketInfo{}, 0)
+		seq++
+	}
+
+	checkContiguous(t, writer.sequenceNumbers(), 65530, 8)
+}
+
+func TestDownTrackSequenceContiguousWithDroppedLayers(t *testing.T) {
+	downTrack, writer := newTestDownTrack(t, webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP9, ClockRate: 90000})
+	downTrack.SetLayerLimits(0, -1, 0)
+
+	seq := uint16(1000)
+	for frame := 0; frame < 4; frame++ {
+		for spatial := 0; spatial < 3; spatial++ {
+			info := svcPacketInfo{
+				spatial:      spatial,
+				startOfFrame: true,
+				endOfFrame:   true,
+				keyframe:     frame == 0 && spatial == 0,
+				switchUp:     true,
+			}
+			downTrack.writeRTP(testPacket(seq, uint32(frame)*3000), info, 0)
+			seq++
+		}
+	}
+
+	// Only the base layer of each picture is forwarded, and it ends the picture
+	checkContiguous(t, writer.sequenceNumbers(), 1000, 4)
+	for _, header := range writer.headers {
+		if !header.Marker {
+			t.Fatal("forwarded base layer packet does not end the picture")
+		}
+	}
+}
+
+func TestDownTrackSequenceContiguousAcrossSourceSwitch(t *testing.T) {
+	downTrack, writer := newTestDownTrack(t, testVP8)
+
+	downTrack.writeRTP(testPacket(500, 90000), svcPacketInfo{}, 0)
+	downTrack.writeRTP(testPacket(501, 93000), svcPacketInfo{}, 0)
+
+	// The new source numbers its packets independently
+	downTrack.switchSource()
+	downTrack.writeRTP(testPacket(40000, 7000000), svcPacketInfo{}, 0)
+	downTrack.writeRTP(testPacket(40001, 7003000), svcPacketInfo{}, 0)
+
+	checkContiguous(t, writer.sequenceNumbers(), 500, 4)
+	if writer.headers[2].Timestamp < writer.headers[1].Timestamp {
+		t.Fatalf("timestamp went back from %d to %d after the switch", writer.headers[1].Timestamp, writer.headers[2].Timestamp)
+	}
+	if diff := writer.headers[3].Timestamp - writer.headers[2].Timestamp; diff != 3000 {
+		t.Fatalf("timestamp step after the switch = %d, want 3000", diff)
+	}
+}
+
+// queuePackets blocks the down track's writer on a first packet, then queues packets
+// 1..n through the router. It returns every packet handed to the router.
+func queuePackets(t *testing.T, router *TrackRouter, writer *recordingWriter, n int) []*forwardPacket {
+	t.Helper()
+	var packets []*forwardPacket
+	write := func(seq uint16) {
+		fp := getForwardPacket()
+		fp.packet = *testPacket(seq, 0)
+		packets = append(packets, fp)
+		router.WriteRTP(fp)
+		fp.release()
+	}
+
+	writer.block()
+	write(0)
+	select {
+	case <-writer.entered:
+	case <-time.After(time.Second):
+		t.Fatal("writer goroutine did not pick up the first packet")
+	}
+
+	atomic.StoreInt32(&router.keyframePending, 0)
+	for seq := 1; seq <= n; seq++ {
+		write(uint16(seq))
+	}
+	return packets
+}
+
+func TestDownTrackQueueDropPolicies(t *testing.T) {
+	previousSize, previousPolicy := C.DownTrackQueueSize, C.DownTrackDropPolicy
+	t.Cleanup(func() {
+		C.DownTrackQueueSize, C.DownTrackDropPolicy = previousSize, previousPolicy
+	})
+	C.DownTrackQueueSize = 4
+
+	tests := []struct {
+		policy string
+		want   []uint16 // Written after the first packet that held the writer
+	}{
+		{policy: dropOldest, want: []uint16{0, 4, 5, 6, 7}},
+		{policy: dropNewest, want: []uint16{0, 1, 2, 3, 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			C.DownTrackDropPolicy = tt.policy
+			router := newRouter("track", "stream", webrtc.RTPCodecTypeVideo, testVP8, false, trackSourceCamera)
+			downTrack := router.AddDownTrack("subscriber")
+			writer := newRecordingWriter()
+			downTrack.bindWriter(2222, 100, writer)
+
+			packets := queuePackets(t, router, writer, 7)
+			if overflows := atomic.LoadUint64(&downTrack.overflows); overflows != 3 {
+				t.Fatalf("overflows = %d, want 3", overflows)
+			}
+			if atomic.LoadInt32(&router.keyframePending) != 1 {
+				t.Fatal("queue overflow did not request a keyframe")
+			}
+
+			writer.unblock()
+			writer.waitWritten(t, len(tt.want))
+			seqs := writer.sequenceNumbers()
+			for i := range tt.want {
+				if seqs[i] != tt.want[i] {
+					t.Fatalf("written %v, want %v", seqs, tt.want)
+				}
+			}
+
+			// Every reference is returned, whether the packet was written or dropped
+			router.Close()
+			deadline := time.Now().Add(time.Second)
+			for _, fp := range packets {
+				for atomic.LoadInt32(&fp.refs) != 0 {
+					if time.Now().After(deadline) {
+						t.Fatalf("packet %d still has %d references", fp.packet.SequenceNumber, atomic.LoadInt32(&fp.refs))
+					}
+					time.Sleep(time.Millisecond)
+				}
+			}
+		})
+	}
+}
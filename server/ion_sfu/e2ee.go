@@ -0,0 +1,42 @@
+package main
+
+// End-to-end encrypted meetings (insertable streams / SFrame): clients encrypt every frame
+// before packetization, so RTP payloads are opaque to the SFU. The SFU then only reads RTP
+// headers and header extensions; SVC layers come from the dependency descriptor alone, and
+// tracks without one are forwarded as a single layer. Clients exchange their keys as "e2ee"
+// data channel messages, which the SFU relays without storing or publishing them.
+
+// applyMeetingE2EE turns on encrypted media passthrough when a command asks for it.
+// Once on it stays on: routers created earlier would otherwise keep parsing payloads.
+func applyMeetingE2EE(sfuCommand SFUCommand, meeting *Meeting) {
+	e2ee, _ := sfuCommand.Payload["e2ee"].(bool)
+	if !e2ee {
+		return
+	}
+
+	meeting.mu.Lock()
+	enabled := !meeting.e2ee
+	meeting.e2ee = true
+	meeting.mu.Unlock()
+
+	if enabled {
+		sfuLogger.Info("WEBRTC", "End-to-end encrypted media passthrough enabled", map[string]interface{}{
+			"meetingID":   meeting.ID,
+			"commandType": sfuCommand.Type,
+		})
+	}
+}
+
+// meetingE2EE reports whether a meeting on this SFU forwards end-to-end encrypted media
+func meetingE2EE(meetingID string) bool {
+	meetingsMu.RLock()
+	meeting, ok := meetings[meetingID]
+	meetingsMu.RUnlock()
+	if !ok {
+		return false
+	}
+
+	meeting.mu.RLock()
+	defer meeting.mu.RUnlock()
+	return meeting.e2ee
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+// Egress forwards meeting tracks as plain RTP to a UDP address, e.g. ffmpeg or GStreamer
+// feeding a streaming endpoint. Each track gets its own port (base port + 2 per track, the
+// odd ports are left for RTCP) and an SDP file describing all of them is written to
+// EgressSDPDir. The SDP describes the tracks routed when the egress started.
+type Egress struct {
+	ID        string
+	MeetingID string
+	Host      string
+	ReplyTo   string // Kafka topic egress status is reported to
+	SDPPath   string
+	sdp       string
+	startedAt time.Time
+	tracks    []*egressTrack
+	recording bool // recordingStarted was published for this egress
+}
+
+// egressTrack is one track of an egress and the UDP socket its down track writes to
+type egressTrack struct {
+	router    *TrackRouter
+	downTrack *DownTrack
+	port      int
+	conn      *net.UDPConn
+}
+
+// udpRTPWriter sends the packets of a down track to an egress socket. It implements
+// webrtc.TrackLocalWriter and is only used by the down track's writer goroutine.
+type udpRTPWriter struct {
+	conn *net.UDPConn
+	buf  [forwardMTU]byte
+}
+
+func (w *udpRTPWriter) WriteRTP(header *rtp.Header, payload []byte) (int, error) {
+	packet := rtp.Packet{Header: *header, Payload: payload}
+	n, err := packet.MarshalTo(w.buf[:])
+	if err != nil {
+		return 0, err
+	}
+	return w.conn.Write(w.buf[:n])
+}
+
+func (w *udpRTPWriter) Write(b []byte) (int, error) {
+	return w.conn.Write(b)
+}
+
+// egressSubscriberID is the down track key of an egress, distinct from client and relay IDs
+func egressSubscriberID(egressID string) string {
+	return "egress:" + egressID
+}
+
+// handleStartEgress starts forwarding meeting tracks to a UDP address.
+// Payload: host, port (even base port), optional egressId, optional trackIds (default: all tracks).
+func handleStartEgress(sfuCommand SFUCommand, meeting *Meeting) {
+	host, _ := sfuCommand.Payload["host"].(string)
+	basePort, _ := sfuCommand.Payload["port"].(float64)
+	ip := net.ParseIP(host)
+	if ip == nil || basePort <= 0 || basePort > 65535 {
+		sfuLogger.Error("EGRESS", "Missing or invalid host or port in startEgress command", nil, map[string]interface{}{
+			"payload": sfuCommand.Payload,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return
+	}
+
+	egressID, _ := sfuCommand.Payload["egressId"].(string)
+	if egressID == "" {
+		egressID = uuid.New().String()
+	}
+	egress := &Egress{
+		ID:        egressID,
+		MeetingID: meeting.ID,
+		Host:      host,
+		ReplyTo:   sfuCommand.ReplyTo,
+		SDPPath:   filepath.Join(C.EgressSDPDir, egressID+".sdp"),
+		startedAt: time.Now(),
+	}
+
+	selected := make(map[string]bool)
+	if trackIDs, ok := sfuCommand.Payload["trackIds"].([]interface{}); ok {
+		for _, trackID := range trackIDs {
+			if id, ok := trackID.(string); ok {
+				selected[id] = true
+			}
+		}
+	}
+
+	meeting.mu.Lock()
+	if _, exists := meeting.egresses[egressID]; exists {
+		meeting.mu.Unlock()
+		sfuLogger.Warn("EGRESS", "Egress already running", map[string]interface{}{
+			"egressID":  egressID,
+			"meetingID": meeting.ID,
+		})
+		return
+	}
+	var routers []*TrackRouter
+	for trackID, router := range meeting.routers {
+		if len(selected) == 0 || selected[trackID] {
+			routers = append(routers, router)
+		}
+	}
+	meeting.egresses[egressID] = egress
+	meeting.mu.Unlock()
+
+	// Audio first, then by track ID, so ports are assigned predictably
+	sort.Slice(routers, func(i, j int) bool {
+		if routers[i].Kind() != routers[j].Kind() {
+			return routers[i].Kind() == webrtc.RTPCodecTypeAudio
+		}
+		return routers[i].ID() < routers[j].ID()
+	})
+
+	port := int(basePort)
+	for _, router := range routers {
+		if port > 65534 {
+			break
+		}
+		conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: ip, Port: port})
+		if err != nil {
+			sfuLogger.Error("EGRESS", "Error opening egress socket", err, map[string]interface{}{
+				"egressID": egressID,
+				"trackID":  router.ID(),
+				"port":     port,
+			})
+			sfuState.IncrementCounters(0, 0, 1)
+			stopEgress(meeting, egress, "failed", err)
+			return
+		}
+
+		downTrack := router.AddDownTrack(egressSubscriberID(egressID))
+		downTrack.bindWriter(webrtc.SSRC(rand.Uint32()), egressPayloadType(router.Kind()), &udpRTPWriter{conn: conn})
+		egress.tracks = append(egress.tracks, &egressTrack{router: router, downTrack: downTrack, port: port, conn: conn})
+		port += 2
+	}
+
+	egress.sdp = egressSDP(egress, ip)
+	if err := writeEgressSDP(egress); err != nil {
+		sfuLogger.Error("EGRESS", "Error writing egress SDP file", err, map[string]interface{}{
+			"egressID": egressID,
+			"path":     egress.SDPPath,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		stopEgress(meeting, egress, "failed", err)
+		return
+	}
+
+	sfuLogger.Info("EGRESS", "Egress started", map[string]interface{}{
+		"egressID":  egressID,
+		"meetingID": meeting.ID,
+		"host":      host,
+		"basePort":  int(basePort),
+		"tracks":    len(egress.tracks),
+		"sdpPath":   egress.SDPPath,
+	})
+	sendEgressStatus(egress, "started", nil)
+
+	trackIDs := make([]string, 0, len(egress.tracks))
+	for _, track := range egress.tracks {
+		trackIDs = append(trackIDs, track.router.ID())
+	}
+	egress.recording = true
+	publishLifecycleEvent(meeting.ID, "recordingStarted", map[string]interface{}{
+		"egressId": egressID,
+		"host":     host,
+		"trackIds": trackIDs,
+		"sdpPath":  egress.SDPPath,
+	})
+}
+
+// handleStopEgress stops an egress. Payload: egressId.
+func handleStopEgress(sfuCommand SFUCommand, meeting *Meeting) {
+	egress := lookupEgress(sfuCommand, meeting)
+	if egress == nil {
+		return
+	}
+	if sfuCommand.ReplyTo != "" {
+		egress.ReplyTo = sfuCommand.ReplyTo
+	}
+	stopEgress(meeting, egress, "stopped", nil)
+}
+
+// handleGetEgressStatus reports an egress' tracks and forwarding statistics. Payload: egressId.
+func handleGetEgressStatus(sfuCommand SFUCommand, meeting *Meeting) {
+	egress := lookupEgress(sfuCommand, meeting)
+	if egress == nil {
+		return
+	}
+	if sfuCommand.ReplyTo != "" {
+		egress.ReplyTo = sfuCommand.ReplyTo
+	}
+	sendEgressStatus(egress, "running", nil)
+}
+
+func lookupEgress(sfuCommand SFUCommand, meeting *Meeting) *Egress {
+	egressID, _ := sfuCommand.Payload["egressId"].(string)
+
+	meeting.mu.RLock()
+	egress, ok := meeting.egresses[egressID]
+	meeting.mu.RUnlock()
+	if !ok {
+		sfuLogger.Warn("EGRESS", "Egress not found", map[string]interface{}{
+			"commandType": sfuCommand.Type,
+			"egressID":    egressID,
+			"meetingID":   meeting.ID,
+		})
+		return nil
+	}
+	return egress
+}
+
+// stopEgress stops forwarding, closes the sockets, removes the SDP file and reports the final status
+func stopEgress(meeting *Meeting, egress *Egress, status string, cause error) {
+	meeting.mu.Lock()
+	_, exists := meeting.egresses[egress.ID]
+	delete(meeting.egresses, egress.ID)
+	meeting.mu.Unlock()
+	if !exists {
+		return
+	}
+
+	// Final statistics before the down tracks go away
+	sendEgressStatus(egress, status, cause)
+
+	for _, track := range egress.tracks {
+		track.router.RemoveDownTrack(egressSubscriberID(egress.ID))
+		track.conn.Close()
+	}
+	if err := os.Remove(egress.SDPPath); err != nil && !os.IsNotExist(err) {
+		sfuLogger.Debug("EGRESS", "Error removing egress SDP file", map[string]interface{}{
+			"egressID": egress.ID,
+			"path":     egress.SDPPath,
+			"error":    err.Error(),
+		})
+	}
+
+	sfuLogger.Info("EGRESS", "Egress stopped", map[string]interface{}{
+		"egressID":  egress.ID,
+		"meetingID": meeting.ID,
+		"status":    status,
+		"duration":  time.Since(egress.startedAt).Round(time.Second).String(),
+	})
+	if egress.recording {
+		publishLifecycleEvent(meeting.ID, "recordingStopped", map[string]interface{}{
+			"egressId":   egress.ID,
+			"status":     status,
+			"durationMs": time.Since(egress.startedAt).Milliseconds(),
+		})
+	}
+}
+
+// stopMeetingEgresses stops every egress of a meeting whose tracks are gone
+func stopMeetingEgresses(meeting *Meeting) {
+	meeting.mu.RLock()
+	egresses := make([]*Egress, 0, len(meeting.egresses))
+	for _, egress := range meeting.egresses {
+		egresses = append(egresses, egress)
+	}
+	meeting.mu.RUnlock()
+
+	for _, egress := range egresses {
+		stopEgress(meeting, egress, "stopped", nil)
+	}
+}
+
+// sendEgressStatus reports an egress' state, SDP and per-track statistics to its reply topic
+func sendEgressStatus(egress *Egress, status string, cause error) {
+	if egress.ReplyTo == "" {
+		return
+	}
+
+	tracks := make([]map[string]interface{}, 0, len(egress.tracks))
+	for _, track := range egress.tracks {
+		stats := track.downTrack.Stats()
+		tracks = append(tracks, map[string]interface{}{
+			"trackId": track.router.ID(),
+			"kind":    track.router.Kind().String(),
+			"port":    track.port,
+			"packets": stats.Packets,
+			"bytes":   stats.Bytes,
+			"dropped": stats.Dropped + stats.QueueDropped,
+		})
+	}
+	payload := map[string]interface{}{
+		"egressId":  egress.ID,
+		"meetingId": egress.MeetingID,
+		"status":    status,
+		"host":      egress.Host,
+		"sdpPath":   egress.SDPPath,
+		"sdp":       egress.sdp,
+		"startedAt": egress.startedAt.UnixMilli(),
+		"tracks":    tracks,
+	}
+	if cause != nil {
+		payload["error"] = cause.Error()
+	}
+
+	if err := sendKafkaMessage(egress.ReplyTo, egress.MeetingID, WSMessage{
+		Type:     "egressStatus",
+		SenderID: sfuID,
+		Payload:  payload,
+	}); err != nil {
+		sfuLogger.Error("EGRESS", "Error sending egress status", err, map[string]interface{}{
+			"egressID": egress.ID,
+			"replyTo":  egress.ReplyTo,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+	}
+}
+
+// egressPayloadType is the RTP payload type egress packets are sent with
+func egressPayloadType(kind webrtc.RTPCodecType) webrtc.PayloadType {
+	if kind == webrtc.RTPCodecTypeAudio {
+		return opusPayloadType
+	}
+	return firstVideoPayloadType
+}
+
+// egressSDP describes the egress tracks for an RTP receiver such as ffmpeg
+func egressSDP(egress *Egress, ip net.IP) string {
+	addressType := "IP4"
+	if ip.To4() == nil {
+		addressType = "IP6"
+	}
+
+	var sdp strings.Builder
+	sdp.WriteString("v=0\r\n")
+	fmt.Fprintf(&sdp, "o=- %d 1 IN %s %s\r\n", egress.startedAt.Unix(), addressType, egress.Host)
+	fmt.Fprintf(&sdp, "s=Meeting %s\r\n", egress.MeetingID)
+	fmt.Fprintf(&sdp, "c=IN %s %s\r\n", addressType, egress.Host)
+	sdp.WriteString("t=0 0\r\n")
+
+	for _, track := range egress.tracks {
+		codec := track.router.Codec()
+		payloadType := egressPayloadType(track.router.Kind())
+		encoding := codec.MimeType[strings.Index(codec.MimeType, "/")+1:]
+
+		fmt.Fprintf(&sdp, "m=%s %d RTP/AVP %d\r\n", track.router.Kind().String(), track.port, payloadType)
+		rtpmap := encoding + "/" + strconv.FormatUint(uint64(codec.ClockRate), 10)
+		if codec.Channels > 1 {
+			rtpmap += "/" + strconv.FormatUint(uint64(codec.Channels), 10)
+		}
+		fmt.Fprintf(&sdp, "a=rtpmap:%d %s\r\n", payloadType, rtpmap)
+		if codec.SDPFmtpLine != "" {
+			fmt.Fprintf(&sdp, "a=fmtp:%d %s\r\n", payloadType, codec.SDPFmtpLine)
+		}
+		fmt.Fprintf(&sdp, "a=mid:%s\r\n", track.router.ID())
+		sdp.WriteString("a=recvonly\r\n")
+	}
+	return sdp.String()
+}
+
+func writeEgressSDP(egress *Egress) error {
+	if err := os.MkdirAll(C.EgressSDPDir, 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(egress.SDPPath, []byte(egress.sdp), 0o644)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Lifecycle events are published to MeetingEventsTopic (default "meeting_events") for the
+// signaling server, analytics and billing. Messages are keyed by meeting ID, so the events of
+// a meeting stay in order on one partition. Each message is an SFUMeetingEventPayload:
+//
+//	{"meetingId": "...", "eventType": "...", "sfuId": "...", "timestamp": <unix ms>, "eventData": {...}}
+//
+// eventData by eventType:
+//
+//	participantJoined       clientId, role, mediaMode, migratedFrom ("" unless the client moved here from another SFU)
+//	participantLeft         clientId, reason ("left", "closed", "reconnect_timeout", ...), durationMs
+//	trackPublished          trackId, streamId, publisherId, kind, codec, source
+//	trackUnpublished        trackId, streamId, publisherId, kind, codec, source
+//	connectionStateChanged  clientId, state ("connecting", "connected", "disconnected", "failed", "closed")
+//	recordingStarted        egressId, host, trackIds, sdpPath
+//	recordingStopped        egressId, status ("stopped" or "failed"), durationMs
+//	meetingClosed           durationMs (since prepareMeeting; 0 if the meeting was never prepared here)
+//
+// Events describe what happens on the emitting SFU. Tracks relayed from another SFU are
+// reported by the SFU their publisher is connected to; ingests and file playbacks publish as
+// participants "ingest:<id>" and "playback:<id>" unless the command named them. Clients moved
+// by a migration leave the source SFU and join the target with migratedFrom set. meetingClosed
+// is sent when the last participant on this SFU leaves; tracks still routed then end with it.
+
+// meetingEventQueueSize is how many events may wait for Kafka before new ones are dropped
+const meetingEventQueueSize = 1024
+
+var (
+	meetingEventQueue     = make(chan SFUMeetingEventPayload, meetingEventQueueSize)
+	meetingEventPublisher sync.Once
+)
+
+// publishLifecycleEvent queues an event for the meeting events topic without blocking the caller.
+// The caller must not hold meeting.mu.
+func publishLifecycleEvent(meetingID, eventType string, eventData map[string]interface{}) {
+	if C.MeetingEventsTopic == "" {
+		return
+	}
+	meetingEventPublisher.Do(func() { go publishMeetingEvents() })
+
+	select {
+	case meetingEventQueue <- SFUMeetingEventPayload{
+		MeetingID: meetingID,
+		EventType: eventType,
+		EventData: eventData,
+		SFUID:     sfuID,
+		Timestamp: time.Now().UnixMilli(),
+	}:
+	default:
+		sfuLogger.Warn("KAFKA", "Meeting event queue full, dropping event", map[string]interface{}{
+			"meetingID": meetingID,
+			"eventType": eventType,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+	}
+}
+
+// publishMeetingEvents sends queued events one at a time, which keeps them in order
+func publishMeetingEvents() {
+	for event := range meetingEventQueue {
+		// Failures are logged and counted by the producer
+		_ = publishKafkaJSON(C.MeetingEventsTopic, event.MeetingID, event.EventType, event)
+	}
+}
+
+// trackEventData describes a routed track for trackPublished and trackUnpublished events
+func trackEventData(router *TrackRouter, publisherID string) map[string]interface{} {
+	return map[string]interface{}{
+		"trackId":     router.ID(),
+		"streamId":    router.StreamID(),
+		"publisherId": publisherID,
+		"kind":        router.Kind().String(),
+		"codec":       strings.ToLower(router.Codec().MimeType),
+		"source":      router.Source(),
+	}
+}
+
+// publishParticipantLeft reports a client that left this SFU
+func publishParticipantLeft(meeting *Meeting, clientPeer *ClientPeer, reason string) {
+	publishLifecycleEvent(meeting.ID, "participantLeft", map[string]interface{}{
+		"clientId":   clientPeer.ID,
+		"reason":     reason,
+		"durationMs": time.Since(clientPeer.joinedAt).Milliseconds(),
+	})
+}
+
+// publishMeetingClosed reports that the last participant on this SFU left the meeting
+func publishMeetingClosed(meeting *Meeting) {
+	meeting.mu.RLock()
+	createdAt := meeting.createdAt
+	meeting.mu.RUnlock()
+
+	var duration int64
+	if !createdAt.IsZero() {
+		duration = time.Since(createdAt).Milliseconds()
+	}
+	publishLifecycleEvent(meeting.ID, "meetingClosed", map[string]interface{}{
+		"durationMs": duration,
+	})
+}
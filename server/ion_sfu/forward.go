@@ -0,0 +1,53 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/pion/rtp"
+)
+
+// Down track queue overflow policies
+const (
+	dropOldest = "drop-oldest" // Make room by discarding the oldest queued packet
+	dropNewest = "drop-newest" // Discard the packet that did not fit
+)
+
+// forwardMTU is the largest RTP packet a publisher may send us
+const forwardMTU = 1500
+
+// forwardPacket is one received RTP packet shared by every down track of a router.
+// It is reference counted and returned to forwardPacketPool by the last release,
+// so the forwarding path does not allocate per packet.
+type forwardPacket struct {
+	buf     [forwardMTU]byte
+	packet  rtp.Packet // Payload and extensions point into buf
+	info    svcPacketInfo
+	ddExtID uint8
+	refs    int32
+}
+
+var forwardPacketPool = sync.Pool{
+	New: func() interface{} {
+		return &forwardPacket{}
+	},
+}
+
+// getForwardPacket takes a packet buffer from the pool, owned by the caller
+func getForwardPacket() *forwardPacket {
+	fp := forwardPacketPool.Get().(*forwardPacket)
+	fp.refs = 1
+	return fp
+}
+
+// retain adds references for n more owners
+func (fp *forwardPacket) retain(n int) {
+	atomic.AddInt32(&fp.refs, int32(n))
+}
+
+// release drops one reference and recycles the buffer with the last one
+func (fp *forwardPacket) release() {
+	if atomic.AddInt32(&fp.refs, -1) == 0 {
+		forwardPacketPool.Put(fp)
+	}
+}
@@ -21,7 +21,7 @@ func processKafkaMessage(msg *sarama.ConsumerMessage, messageCount int64) {
 		"keyMatches":   string(msg.Key) == sfuID,
 	})
 
-	sfuCommand, err := parseKafkaCommand(msg.Value)
+	sfuCommand, envelope, err := parseKafkaCommand(msg.Value)
 	if err != nil {
 		sfuLogger.Error("KAFKA", "Error unmarshalling Kafka command", err, map[string]interface{}{
 			"messageCount": messageCount,
@@ -49,6 +49,14 @@ func processKafkaMessage(msg *sarama.ConsumerMessage, messageCount int64) {
 		return
 	}
 
+	if err := authenticateCommand(envelope); err != nil {
+		rejectCommand(sfuCommand, envelope, err)
+		return
+	}
+	if envelope != nil && C.CommandAuthMode != commandAuthOff {
+		sfuCommand.issuer = envelope.Issuer
+	}
+
 	sfuLogger.Info("KAFKA", "Processing SFU command", map[string]interface{}{
 		"commandType": sfuCommand.Type,
 		"sfuID":       sfuID,
@@ -69,11 +77,17 @@ func processKafkaMessage(msg *sarama.ConsumerMessage, messageCount int64) {
 	handleSFUCommand(sfuCommand, meeting)
 }
 
-// parseKafkaCommand unmarshals a Kafka message into an SFUCommand
-func parseKafkaCommand(value []byte) (SFUCommand, error) {
+// parseKafkaCommand unmarshals a Kafka message into an SFUCommand, unwrapping a signed
+// envelope. The envelope is nil for unsigned commands.
+func parseKafkaCommand(value []byte) (SFUCommand, *CommandEnvelope, error) {
 	var sfuCommand SFUCommand
+	var envelope CommandEnvelope
+	if json.Unmarshal(value, &envelope) == nil && envelope.Signature != "" && len(envelope.Command) > 0 {
+		err := json.Unmarshal(envelope.Command, &sfuCommand)
+		return sfuCommand, &envelope, err
+	}
 	err := json.Unmarshal(value, &sfuCommand)
-	return sfuCommand, err
+	return sfuCommand, nil, err
 }
 
 // getOrCreateMeeting retrieves an existing meeting or creates a new one
@@ -84,9 +98,19 @@ func getOrCreateMeeting(meetingID string) *Meeting {
 	meeting, exists := meetings[meetingID]
 	if !exists {
 		meeting = &Meeting{
-			ID:          meetingID,
-			clients:     make(map[string]*ClientPeer),
-			trackLocals: make(map[string]*webrtc.TrackLocalStaticRTP),
+			ID:              meetingID,
+			clients:         make(map[string]*ClientPeer),
+			routers:         make(map[string]*TrackRouter),
+			relays:          make(map[string]*RelayPeer),
+			relayedTracks:   make(map[string]string),
+			relayedSources:  make(map[string]string),
+			trackPublishers: make(map[string]string),
+			breakoutRooms:   make(map[string]string),
+			roomAssignments: make(map[string]string),
+			lobby:           make(map[string]*LobbyEntry),
+			egresses:        make(map[string]*Egress),
+			ingests:         make(map[string]*Ingest),
+			playbacks:       make(map[string]*Playback),
 		}
 		meetings[meetingID] = meeting
 		sfuLogger.Info("KAFKA", "Created new meeting instance", map[string]interface{}{
@@ -103,13 +127,71 @@ func getOrCreateMeeting(meetingID string) *Meeting {
 func handleSFUCommand(sfuCommand SFUCommand, meeting *Meeting) {
 	switch sfuCommand.Type {
 	case "prepareMeeting":
-		handlePrepareMeeting(meeting)
+		handlePrepareMeeting(sfuCommand, meeting)
 	case "clientJoined":
 		handleClientJoined(sfuCommand, meeting)
 	case "clientLeft":
 		handleClientLeft(sfuCommand, meeting)
 	case "webrtcSignal":
 		handleWebRTCSignal(sfuCommand, meeting)
+	case "startRelay":
+		handleStartRelay(sfuCommand, meeting)
+	case "stopRelay":
+		handleStopRelay(sfuCommand, meeting)
+	case "relayOffer":
+		handleRelayOffer(sfuCommand, meeting)
+	case "relayAnswer":
+		handleRelayAnswer(sfuCommand, meeting)
+	case "relayCandidate":
+		handleRelayCandidate(sfuCommand, meeting)
+	case "relayClosed":
+		handleRelayClosed(sfuCommand, meeting)
+	case "relayDataMessage":
+		handleRelayDataMessage(sfuCommand, meeting)
+	case "migrateMeeting":
+		handleMigrateMeeting(sfuCommand, meeting)
+	case "migrationClientConnected":
+		handleMigrationClientConnected(sfuCommand, meeting)
+	case "migrationCompleted":
+		handleMigrationCompleted(sfuCommand, meeting)
+	case "setVideoLayers":
+		handleSetVideoLayers(sfuCommand, meeting)
+	case "setTrackPaused":
+		handleSetTrackPaused(sfuCommand, meeting)
+	case "setMediaMode":
+		handleSetMediaMode(sfuCommand, meeting)
+	case "getHistory":
+		handleGetHistory(sfuCommand, meeting)
+	case "getForwardStats":
+		handleGetForwardStats(sfuCommand, meeting)
+	case "setParticipantRole":
+		handleSetParticipantRole(sfuCommand, meeting)
+	case "createBreakoutRooms":
+		handleCreateBreakoutRooms(sfuCommand, meeting)
+	case "assignBreakoutRooms":
+		handleAssignBreakoutRooms(sfuCommand, meeting)
+	case "closeBreakoutRooms":
+		handleCloseBreakoutRooms(sfuCommand, meeting)
+	case "admitParticipant":
+		handleAdmitParticipant(sfuCommand, meeting)
+	case "denyParticipant":
+		handleDenyParticipant(sfuCommand, meeting)
+	case "startEgress":
+		handleStartEgress(sfuCommand, meeting)
+	case "stopEgress":
+		handleStopEgress(sfuCommand, meeting)
+	case "getEgressStatus":
+		handleGetEgressStatus(sfuCommand, meeting)
+	case "startIngest":
+		handleStartIngest(sfuCommand, meeting)
+	case "stopIngest":
+		handleStopIngest(sfuCommand, meeting)
+	case "getIngestStatus":
+		handleGetIngestStatus(sfuCommand, meeting)
+	case "playMedia":
+		handlePlayMedia(sfuCommand, meeting)
+	case "stopMedia":
+		handleStopMedia(sfuCommand, meeting)
 	default:
 		sfuLogger.Warn("KAFKA", "Unhandled SFU command type", map[string]interface{}{
 			"commandType": sfuCommand.Type,
@@ -119,7 +201,7 @@ func handleSFUCommand(sfuCommand SFUCommand, meeting *Meeting) {
 }
 
 // handlePrepareMeeting processes prepare meeting commands
-func handlePrepareMeeting(meeting *Meeting) {
+func handlePrepareMeeting(sfuCommand SFUCommand, meeting *Meeting) {
 	meetingID := meeting.ID
 
 	sfuLogger.Info("KAFKA", "Processing prepare meeting command", map[string]interface{}{
@@ -136,8 +218,75 @@ func handlePrepareMeeting(meeting *Meeting) {
 		return
 	}
 
+	// An edge SFU serves part of a meeting owned by another SFU and reaches it via relay
+	if originSFUID, ok := sfuCommand.Payload["originSfuId"].(string); ok && originSFUID != "" && originSFUID != sfuID {
+		owner, err := meetingOwner(meetingID)
+		if err != nil {
+			sfuLogger.Error("KAFKA", "Error reading meeting owner from Redis", err, map[string]interface{}{
+				"meetingID": meetingID,
+			})
+			sfuState.IncrementCounters(0, 0, 1)
+			rejectMeetingCommand(sfuCommand, meeting, "", "claim_failed")
+			return
+		}
+		if owner != originSFUID {
+			rejectMeetingCommand(sfuCommand, meeting, owner, "origin_not_owner")
+			return
+		}
+
+		meeting.mu.Lock()
+		meeting.originSFUID = originSFUID
+		meeting.mu.Unlock()
+
+		sfuLogger.Info("KAFKA", "Preparing meeting as edge of origin SFU", map[string]interface{}{
+			"meetingID":   meetingID,
+			"originSFUID": originSFUID,
+		})
+	} else {
+		// Claim the meeting in Redis so no other SFU hosts it concurrently
+		claimed, owner, err := claimMeeting(meeting)
+		if err != nil {
+			sfuLogger.Error("KAFKA", "Error claiming meeting in Redis", err, map[string]interface{}{
+				"meetingID": meetingID,
+			})
+			sfuState.IncrementCounters(0, 0, 1)
+			rejectMeetingCommand(sfuCommand, meeting, "", "claim_failed")
+			return
+		}
+		if !claimed {
+			rejectMeetingCommand(sfuCommand, meeting, owner, "owned_by_other_sfu")
+			return
+		}
+	}
+
+	// Optional codec restriction, e.g. ["opus", "vp8"] for meetings with constrained clients
+	var allowedCodecs map[string]bool
+	if codecs, ok := sfuCommand.Payload["codecs"]; ok {
+		var err error
+		allowedCodecs, err = parseMeetingCodecs(codecs)
+		if err != nil {
+			sfuLogger.Error("KAFKA", "Invalid codec restriction in prepareMeeting, allowing all codecs", err, map[string]interface{}{
+				"meetingID": meetingID,
+				"codecs":    codecs,
+			})
+			sfuState.IncrementCounters(0, 0, 1)
+			allowedCodecs = nil
+		}
+	}
+
+	applyMeetingE2EE(sfuCommand, meeting)
+	applyMeetingLobby(sfuCommand, meeting)
+	applyMeetingMode(sfuCommand, meeting)
+
+	// Optional limit on concurrent screen shares, overriding MaxScreenShares
+	maxScreenShares, _ := sfuCommand.Payload["maxScreenShares"].(float64)
+
 	// Initialize meeting with metadata
 	meeting.mu.Lock()
+	meeting.allowedCodecs = allowedCodecs
+	if maxScreenShares > 0 {
+		meeting.maxScreenShares = int(maxScreenShares)
+	}
 	meeting.createdAt = time.Now()
 	meeting.status = "prepared"
 	meeting.maxParticipants = 10
@@ -155,6 +304,44 @@ func handlePrepareMeeting(meeting *Meeting) {
 		"activeMeetings":  sfuMetrics.ActiveMeetings,
 	})
 	sfuState.UpdateMetrics(sfuMetrics.ConnectedClients, sfuMetrics.ActiveMeetings)
+
+	publishMeetingRoster(meeting)
+}
+
+// rejectMeetingCommand refuses a command for a meeting this SFU cannot host and
+// tells the requester which SFU owns it
+func rejectMeetingCommand(sfuCommand SFUCommand, meeting *Meeting, owner, reason string) {
+	sfuLogger.Warn("KAFKA", "Refusing command for meeting not owned by this SFU", map[string]interface{}{
+		"commandType": sfuCommand.Type,
+		"meetingID":   meeting.ID,
+		"ownerSFUID":  owner,
+		"reason":      reason,
+		"sfuID":       sfuID,
+	})
+
+	// Drop the placeholder created by getOrCreateMeeting if nothing uses it
+	meetingsMu.Lock()
+	meeting.mu.RLock()
+	if len(meeting.clients) == 0 && !meeting.leaseHeld && meeting.originSFUID == "" {
+		delete(meetings, meeting.ID)
+	}
+	meeting.mu.RUnlock()
+	meetingsMu.Unlock()
+
+	if sfuCommand.ReplyTo == "" {
+		return
+	}
+
+	sendKafkaMessage(sfuCommand.ReplyTo, meeting.ID, WSMessage{
+		Type:     "sfuCommandRejected",
+		SenderID: sfuID,
+		Payload: map[string]interface{}{
+			"commandType": sfuCommand.Type,
+			"meetingId":   meeting.ID,
+			"ownerSfuId":  owner,
+			"reason":      reason,
+		},
+	})
 }
 
 // handleClientJoined processes client joined commands
@@ -176,12 +363,131 @@ func handleClientJoined(sfuCommand SFUCommand, meeting *Meeting) {
 		"sfuID":     sfuID,
 	})
 
+	if forwardToMigrationTarget(sfuCommand, meeting, clientID) {
+		return
+	}
+
+	// Only the source SFU itself can vouch for a migration; anyone else's migratedFrom would
+	// let the client skip the lobby and keep using an expired token
+	migratedFrom := verifiedMigratedFrom(sfuCommand)
+	if claimed, _ := sfuCommand.Payload["migratedFrom"].(string); claimed != migratedFrom {
+		sfuLogger.Warn("AUTH", "Ignoring migratedFrom of a clientJoined not signed by that SFU", map[string]interface{}{
+			"clientID":     clientID,
+			"meetingID":    meetingID,
+			"migratedFrom": claimed,
+			"issuer":       sfuCommand.issuer,
+		})
+	}
+
+	// Authenticate before claiming the meeting or creating a PeerConnection
+	claims, ok := authenticateJoin(sfuCommand, meeting, clientID)
+	if !ok {
+		return
+	}
+
+	// Without join tokens the command's role is used as is
+	requestedRole, joinToken := sfuCommand.Payload["role"], ""
+	if claims != nil {
+		joinToken, _ = sfuCommand.Payload["token"].(string)
+		if requestedRole, ok = joinRole(sfuCommand, claims, migratedFrom); !ok {
+			sfuLogger.Warn("AUTH", "Rejected clientJoined setting a role outside a signed migration", map[string]interface{}{
+				"clientID":  clientID,
+				"meetingID": meetingID,
+				"role":      sfuCommand.Payload["role"],
+				"tokenRole": claims.Role,
+				"issuer":    sfuCommand.issuer,
+			})
+			sfuState.IncrementCounters(0, 0, 1)
+			rejectMeetingCommand(sfuCommand, meeting, "", "role_not_allowed")
+			return
+		}
+	}
+	if role, _ := requestedRole.(string); role == "" {
+		// Webinar participants only publish when their token or the command says so
+		meeting.mu.RLock()
+		if meeting.webinar {
+			requestedRole = roleViewer
+		}
+		meeting.mu.RUnlock()
+	}
+	role, ok := parseRole(requestedRole)
+	if !ok {
+		sfuLogger.Warn("KAFKA", "Invalid role in clientJoined command, using default", map[string]interface{}{
+			"clientID":  clientID,
+			"meetingID": meetingID,
+			"role":      requestedRole,
+			"default":   C.DefaultRole,
+		})
+		role = C.DefaultRole
+	}
+
+	claimed, owner, err := ensureMeetingClaim(meeting)
+	if err != nil {
+		sfuLogger.Error("KAFKA", "Error claiming meeting in Redis", err, map[string]interface{}{
+			"clientID":  clientID,
+			"meetingID": meetingID,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		rejectMeetingCommand(sfuCommand, meeting, "", "claim_failed")
+		return
+	}
+	if !claimed {
+		rejectMeetingCommand(sfuCommand, meeting, owner, "owned_by_other_sfu")
+		return
+	}
+	if role == roleViewer && migratedFrom == "" && webinarViewerCapacityReached(meeting) {
+		// The viewer can be served by an edge SFU relaying this meeting
+		rejectMeetingCommand(sfuCommand, meeting, "", "viewer_capacity")
+		return
+	}
+
 	sfuLogger.Info("KAFKA", "Setting up client peer connection", map[string]interface{}{
 		"clientID":  clientID,
 		"meetingID": meetingID,
 		"sfuID":     sfuID,
 	})
-	go setupClientPeerConnection(meeting, clientID, sfuCommand.ReplyTo)
+	mediaMode, ok := parseMediaMode(sfuCommand.Payload["mediaMode"])
+	if !ok {
+		sfuLogger.Warn("KAFKA", "Invalid mediaMode in clientJoined command, using full", map[string]interface{}{
+			"clientID":  clientID,
+			"meetingID": meetingID,
+			"mediaMode": sfuCommand.Payload["mediaMode"],
+		})
+		mediaMode = mediaModeFull
+	}
+
+	options := joinOptions{
+		replyTo:      sfuCommand.ReplyTo,
+		migratedFrom: migratedFrom,
+		mediaMode:    mediaMode,
+		role:         role,
+		joinToken:    joinToken,
+	}
+	if holdInLobby(meeting, &LobbyEntry{
+		ClientID:      clientID,
+		options:       options,
+		authenticated: claims != nil,
+		requestedAt:   time.Now(),
+	}) {
+		return
+	}
+
+	admitClient(meeting, clientID, options)
+}
+
+// admitClient sets up the PeerConnection of a client let into the meeting
+func admitClient(meeting *Meeting, clientID string, options joinOptions) {
+	go func() {
+		setupClientPeerConnection(meeting, clientID, options)
+
+		// A host arriving after participants started waiting needs to see them
+		meeting.mu.RLock()
+		waiting := len(meeting.lobby)
+		meeting.mu.RUnlock()
+		if waiting > 0 && rolePermissions[options.role].manageRoles {
+			announceLobby(meeting)
+		}
+	}()
 	metricsMu.Lock()
 	sfuMetrics.ConnectedClients++
 	if len(meeting.clients) == 0 { // First client in this meeting on this SFU
@@ -191,7 +497,7 @@ func handleClientJoined(sfuCommand SFUCommand, meeting *Meeting) {
 
 	sfuLogger.Info("KAFKA", "Client join processing completed", map[string]interface{}{
 		"clientID":         clientID,
-		"meetingID":        meetingID,
+		"meetingID":        meeting.ID,
 		"connectedClients": sfuMetrics.ConnectedClients,
 		"activeMeetings":   sfuMetrics.ActiveMeetings,
 	})
@@ -218,8 +524,19 @@ func handleClientLeft(sfuCommand SFUCommand, meeting *Meeting) {
 		"sfuID":     sfuID,
 	})
 
+	if forwardToMigrationTarget(sfuCommand, meeting, clientID) {
+		return
+	}
+
+	// A client that gives up waiting in the lobby has no PeerConnection to clean up
+	if takeFromLobby(meeting, clientID) != nil {
+		announceLobby(meeting)
+		return
+	}
+
 	meeting.mu.Lock()
-	if peer, ok := meeting.clients[clientID]; ok {
+	peer, removed := meeting.clients[clientID]
+	if removed {
 		peer.PeerConnection.Close()
 		delete(meeting.clients, clientID)
 		metricsMu.Lock()
@@ -245,16 +562,34 @@ func handleClientLeft(sfuCommand SFUCommand, meeting *Meeting) {
 	meeting.mu.Unlock()
 
 	sfuState.UpdateMetrics(sfuMetrics.ConnectedClients, sfuMetrics.ActiveMeetings)
+	removeDownTracks(meeting, clientID)
+	if removed {
+		publishParticipantLeft(meeting, peer, "left")
+	}
 
 	// If no clients left in this meeting on this SFU, clean up tracks
 	if len(meeting.clients) == 0 {
+		stopMeetingEgresses(meeting)
+		stopMeetingIngests(meeting)
+		stopMeetingPlaybacks(meeting)
 		meeting.mu.Lock()
-		meeting.trackLocals = make(map[string]*webrtc.TrackLocalStaticRTP) // Clear all tracks
+		for _, router := range meeting.routers {
+			router.Close()
+		}
+		meeting.routers = make(map[string]*TrackRouter) // Clear all tracks
+		meeting.relayedTracks = make(map[string]string)
 		meeting.mu.Unlock()
 		sfuLogger.Info("KAFKA", "All clients left meeting, cleared all tracks", map[string]interface{}{
 			"meetingID": meetingID,
 		})
+		if removed {
+			publishMeetingClosed(meeting)
+		}
+		releaseMeetingClaim(meeting)
+		return
 	}
+
+	publishMeetingRoster(meeting)
 }
 
 // handleWebRTCSignal processes WebRTC signaling messages
@@ -285,22 +620,36 @@ func handleWebRTCSignal(sfuCommand SFUCommand, meeting *Meeting) {
 		"meetingID":  meetingID,
 	})
 
+	if forwardToMigrationTarget(sfuCommand, meeting, senderID) {
+		return
+	}
+
 	peer := waitForPeerConnection(meeting, senderID)
 	if peer == nil {
 		return
 	}
 
+	if signalType == "iceRestart" {
+		handleICERestartSignal(sfuCommand, meeting, peer)
+		return
+	}
+
 	peer.mu.Lock() // Lock the specific peer connection
 	defer peer.mu.Unlock()
 
 	switch signalType {
 	case "offer":
-		handleOfferSignal(sfuCommand, peer, senderID, meetingID)
+		handleOfferSignal(sfuCommand, meeting, peer, senderID)
 	case "answer":
 		handleAnswerSignal(sfuCommand, peer, senderID, meetingID)
 	case "candidate":
 		handleCandidateSignal(sfuCommand, peer, senderID, meetingID)
 	}
+
+	// An SFU offer deferred during this negotiation can go out now
+	if peer.renegotiate && peer.PeerConnection.SignalingState() == webrtc.SignalingStateStable {
+		renegotiateClient(peer, "")
+	}
 }
 
 // waitForPeerConnection waits for a peer connection to be available with retry logic
@@ -334,7 +683,8 @@ func waitForPeerConnection(meeting *Meeting, senderID string) *ClientPeer {
 }
 
 // handleOfferSignal processes offer signals
-func handleOfferSignal(sfuCommand SFUCommand, peer *ClientPeer, senderID, meetingID string) {
+func handleOfferSignal(sfuCommand SFUCommand, meeting *Meeting, peer *ClientPeer, senderID string) {
+	meetingID := meeting.ID
 	sdpStr, ok := sfuCommand.Payload["sdp"].(string)
 	if !ok {
 		sfuLogger.Error("KAFKA", "Missing or invalid sdp in offer signal", nil, map[string]interface{}{
@@ -355,6 +705,9 @@ func handleOfferSignal(sfuCommand SFUCommand, peer *ClientPeer, senderID, meetin
 		"sdpLength": len(sdpStr),
 	})
 
+	// Sources must be known before the offer's tracks arrive
+	recordTrackSources(sfuCommand, meeting, peer)
+
 	if err := peer.PeerConnection.SetRemoteDescription(offer); err != nil {
 		sfuLogger.Error("KAFKA", "Error setting remote description", err, map[string]interface{}{
 			"senderID":  senderID,
@@ -367,6 +720,10 @@ func handleOfferSignal(sfuCommand SFUCommand, peer *ClientPeer, senderID, meetin
 	// Process any pending ICE candidates
 	processPendingCandidates(peer, senderID)
 
+	// Only accept codecs the meeting allows and every other participant can decode
+	recordReceiveCodecs(meeting, peer)
+	applyCodecPreferences(meeting, peer)
+
 	answer, err := peer.PeerConnection.CreateAnswer(nil)
 	if err != nil {
 		sfuLogger.Error("KAFKA", "Error creating answer", err, map[string]interface{}{
@@ -542,6 +899,58 @@ func sendSFUSignalToClient(clientID string, signalType string, sdp string, candi
 		Candidate:      candidateData,
 		MeetingID:      meetingID,
 	}
+	deliverSFUSignalToClient(msgPayload, replyTo)
+}
+
+// sendMeetingEvent notifies every participant of the meeting through the signaling servers
+// serving its clients on this SFU
+func sendMeetingEvent(meeting *Meeting, eventType string, eventData interface{}) {
+	meeting.mu.RLock()
+	replyTopics := make(map[string]bool)
+	for _, clientPeer := range meeting.clients {
+		if clientPeer.ReplyTo != "" {
+			replyTopics[clientPeer.ReplyTo] = true
+		}
+	}
+	meeting.mu.RUnlock()
+
+	for replyTo := range replyTopics {
+		if err := sendKafkaMessage(replyTo, meeting.ID, WSMessage{
+			Type:     "meetingEvent",
+			SenderID: sfuID,
+			Payload: SFUMeetingEventPayload{
+				MeetingID: meeting.ID,
+				EventType: eventType,
+				EventData: eventData,
+			},
+		}); err != nil {
+			sfuLogger.Error("KAFKA", "Error sending meeting event", err, map[string]interface{}{
+				"meetingID": meeting.ID,
+				"eventType": eventType,
+				"replyTo":   replyTo,
+			})
+			sfuState.IncrementCounters(0, 0, 1)
+		}
+	}
+}
+
+// sendICEServersToClient tells a client which ICE servers (including TURN credentials) to use
+func sendICEServersToClient(clientID string, meetingID string, replyTo string, iceServers []webrtc.ICEServer) {
+	msgPayload := SFUSignalToClientPayload{
+		TargetClientID: clientID,
+		SignalType:     "iceServers",
+		ICEServers:     iceServers,
+		MeetingID:      meetingID,
+	}
+	deliverSFUSignalToClient(msgPayload, replyTo)
+}
+
+// deliverSFUSignalToClient publishes a signal to the client's signaling server topic
+func deliverSFUSignalToClient(msgPayload SFUSignalToClientPayload, replyTo string) {
+	clientID := msgPayload.TargetClientID
+	signalType := msgPayload.SignalType
+	meetingID := msgPayload.MeetingID
+
 	wsMsg := WSMessage{
 		Type:     "sfuSignalToClient",
 		Payload:  msgPayload,
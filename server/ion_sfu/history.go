@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// meetingHistoryKeyFormat is the Redis stream holding a meeting's chat and reactions
+const meetingHistoryKeyFormat = "meeting:%s:history"
+
+const (
+	historyPageMax         = 200             // Largest page a getHistory command may request
+	historyDataChannelWait = 5 * time.Second // How long a joiner's data channel may take to open
+)
+
+// historyMessageTypes are the data channel messages kept in the meeting history
+var historyMessageTypes = map[string]bool{
+	"chat":     true,
+	"reaction": true,
+}
+
+func meetingHistoryKey(meetingID string) string {
+	return fmt.Sprintf(meetingHistoryKeyFormat, meetingID)
+}
+
+// appendMeetingHistory stores a relayed message, trimming the stream to the configured length
+func appendMeetingHistory(meetingID string, raw []byte) {
+	key := meetingHistoryKey(meetingID)
+	pipe := redisClient.Pipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: key,
+		MaxLen: int64(C.HistoryMaxLength),
+		Approx: true,
+		Values: map[string]interface{}{"message": raw},
+	})
+	pipe.Expire(ctx, key, C.HistoryTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		sfuLogger.Error("REDIS", "Error storing meeting history", err, map[string]interface{}{
+			"meetingID": meetingID,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+	}
+}
+
+// loadMeetingHistory returns up to limit entries older than the before cursor
+// (newest entries when before is empty), oldest first
+func loadMeetingHistory(meetingID, before string, limit int) ([]HistoryEntry, error) {
+	end := "+"
+	if before != "" {
+		end = "(" + before
+	}
+
+	messages, err := redisClient.XRevRangeN(ctx, meetingHistoryKey(meetingID), end, "-", int64(limit)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]HistoryEntry, 0, len(messages))
+	for i := len(messages) - 1; i >= 0; i-- {
+		raw, ok := messages[i].Values["message"].(string)
+		if !ok {
+			continue
+		}
+		entries = append(entries, HistoryEntry{ID: messages[i].ID, Message: json.RawMessage(raw)})
+	}
+	return entries, nil
+}
+
+// sendMeetingHistory delivers history entries to a client through its signaling server
+func sendMeetingHistory(meetingID, clientID, replyTo string, entries []HistoryEntry, nextCursor string) {
+	if replyTo == "" {
+		sfuLogger.Warn("KAFKA", "No reply topic for meeting history", map[string]interface{}{
+			"clientID":  clientID,
+			"meetingID": meetingID,
+		})
+		return
+	}
+
+	payload := map[string]interface{}{
+		"targetClientId": clientID,
+		"meetingId":      meetingID,
+		"messages":       entries,
+	}
+	if nextCursor != "" {
+		payload["nextCursor"] = nextCursor
+	}
+
+	if err := sendKafkaMessage(replyTo, meetingID, WSMessage{
+		Type:     "meetingHistory",
+		SenderID: sfuID,
+		Payload:  payload,
+	}); err != nil {
+		sfuLogger.Error("KAFKA", "Error sending meeting history", err, map[string]interface{}{
+			"clientID":  clientID,
+			"meetingID": meetingID,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+	}
+}
+
+// deliverJoinHistory sends the latest history to a new client, over its data channel
+// when that opens in time, otherwise through the signaling reply topic
+func deliverJoinHistory(meeting *Meeting, clientPeer *ClientPeer) {
+	if C.HistoryOnJoin <= 0 || clientPeer.MigratedFrom != "" {
+		// Migrated clients already received the history on their previous SFU
+		return
+	}
+
+	viaDataChannel := false
+	if clientPeer.dataChannelOpen != nil {
+		select {
+		case <-clientPeer.dataChannelOpen:
+			viaDataChannel = true
+		case <-time.After(historyDataChannelWait):
+		}
+	}
+
+	entries, err := loadMeetingHistory(meeting.ID, "", C.HistoryOnJoin)
+	if err != nil {
+		sfuLogger.Error("REDIS", "Error loading meeting history", err, map[string]interface{}{
+			"clientID":  clientPeer.ID,
+			"meetingID": meeting.ID,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return
+	}
+	if len(entries) == 0 {
+		return
+	}
+
+	if !viaDataChannel {
+		sendMeetingHistory(meeting.ID, clientPeer.ID, clientPeer.ReplyTo, entries, "")
+		return
+	}
+
+	for _, entry := range entries {
+		raw, err := json.Marshal(DataChannelMessage{
+			Type:      "history",
+			ID:        entry.ID,
+			MeetingID: meeting.ID,
+			Data:      entry.Message,
+		})
+		if err != nil {
+			continue
+		}
+		sendDataChannel(clientPeer, raw)
+	}
+
+	sfuLogger.Debug("DATACHANNEL", "Delivered meeting history to joiner", map[string]interface{}{
+		"clientID":  clientPeer.ID,
+		"meetingID": meeting.ID,
+		"entries":   len(entries),
+	})
+}
+
+// handleGetHistory replies with one page of a meeting's history.
+// Payload: clientId, optional before (cursor from a previous page) and limit.
+func handleGetHistory(sfuCommand SFUCommand, meeting *Meeting) {
+	clientID, ok := sfuCommand.Payload["clientId"].(string)
+	if !ok {
+		sfuLogger.Error("KAFKA", "Missing or invalid clientId in getHistory command", nil, map[string]interface{}{
+			"payload": sfuCommand.Payload,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return
+	}
+	before, _ := sfuCommand.Payload["before"].(string)
+
+	limit := C.HistoryOnJoin
+	if value, ok := sfuCommand.Payload["limit"].(float64); ok { // JSON numbers arrive as float64
+		limit = int(value)
+	}
+	if limit <= 0 || limit > historyPageMax {
+		limit = historyPageMax
+	}
+
+	replyTo := sfuCommand.ReplyTo
+	if replyTo == "" {
+		meeting.mu.RLock()
+		if clientPeer, exists := meeting.clients[clientID]; exists {
+			replyTo = clientPeer.ReplyTo
+		}
+		meeting.mu.RUnlock()
+	}
+
+	entries, err := loadMeetingHistory(meeting.ID, before, limit)
+	if err != nil {
+		sfuLogger.Error("REDIS", "Error loading meeting history", err, map[string]interface{}{
+			"clientID":  clientID,
+			"meetingID": meeting.ID,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return
+	}
+
+	nextCursor := ""
+	if len(entries) == limit {
+		nextCursor = entries[0].ID
+	}
+	sendMeetingHistory(meeting.ID, clientID, replyTo, entries, nextCursor)
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v3"
+)
+
+// Ingest receives plain RTP on a UDP port, e.g. from a SIP or RTSP gateway or a file player,
+// and publishes it in a meeting as a track of a synthetic participant. The packets feed a
+// TrackRouter like any WebRTC publisher, so clients, relays and egresses receive the track
+// through the usual fan-out. Keyframe requests are sent as RTCP PLI to the address the RTP
+// comes from (rtcp-mux); senders that do not listen for RTCP should send keyframes regularly.
+// An ingest ends on stopIngest, when it receives nothing for IngestIdleTimeout, or when the
+// last client leaves the meeting.
+type Ingest struct {
+	ID            string
+	MeetingID     string
+	ParticipantID string // Publisher ID of the ingested track
+	ReplyTo       string // Kafka topic ingest status is reported to
+	router        *TrackRouter
+	conn          *net.UDPConn
+	payloadType   int // Only packets with this payload type are forwarded (-1 = any)
+	startedAt     time.Time
+	status        string // Final status, set under meeting.mu when the ingest is removed
+
+	packets    uint64
+	bytes      uint64
+	lastSSRC   uint32
+	lastSource atomic.Pointer[net.UDPAddr]
+}
+
+// meetingCodec finds the registered codec with a configuration name ("opus", "vp8", ...)
+// that the meeting's clients negotiate, for tracks published by the SFU itself
+func meetingCodec(meeting *Meeting, name string) (webrtc.RTPCodecType, webrtc.RTPCodecCapability, bool) {
+	name = codecName(name)
+	meeting.mu.RLock()
+	allowed := meeting.allowedCodecs == nil || meeting.allowedCodecs[name]
+	meeting.mu.RUnlock()
+	if !allowed {
+		return 0, webrtc.RTPCodecCapability{}, false
+	}
+
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeAudio, webrtc.RTPCodecTypeVideo} {
+		for _, codec := range registeredCodecs[kind] {
+			if codecName(codec.MimeType) == name {
+				return kind, codec.RTPCodecCapability, true
+			}
+		}
+	}
+	return 0, webrtc.RTPCodecCapability{}, false
+}
+
+// handleStartIngest opens a UDP port and publishes the RTP received on it.
+// Payload: codec, port (0 = any free port), optional ingestId, participantId, trackId,
+// streamId, source and payloadType.
+func handleStartIngest(sfuCommand SFUCommand, meeting *Meeting) {
+	codec, _ := sfuCommand.Payload["codec"].(string)
+	port, ok := sfuCommand.Payload["port"].(float64)
+	if codec == "" || !ok || port < 0 || port > 65535 {
+		sfuLogger.Error("INGEST", "Missing or invalid codec or port in startIngest command", nil, map[string]interface{}{
+			"payload": sfuCommand.Payload,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return
+	}
+
+	ingestID, _ := sfuCommand.Payload["ingestId"].(string)
+	if ingestID == "" {
+		ingestID = uuid.New().String()
+	}
+	ingest := &Ingest{
+		ID:          ingestID,
+		MeetingID:   meeting.ID,
+		ReplyTo:     sfuCommand.ReplyTo,
+		payloadType: -1,
+		startedAt:   time.Now(),
+	}
+	if payloadType, ok := sfuCommand.Payload["payloadType"].(float64); ok {
+		ingest.payloadType = int(payloadType)
+	}
+
+	kind, capability, ok := meetingCodec(meeting, codec)
+	if !ok {
+		failIngest(ingest, "Codec not available for ingest", errors.New("codec not configured or not allowed in this meeting: "+codec))
+		return
+	}
+
+	ingest.ParticipantID, _ = sfuCommand.Payload["participantId"].(string)
+	if ingest.ParticipantID == "" {
+		ingest.ParticipantID = "ingest:" + ingestID
+	}
+	trackID, _ := sfuCommand.Payload["trackId"].(string)
+	if trackID == "" {
+		trackID = uuid.New().String()
+	}
+	streamID, _ := sfuCommand.Payload["streamId"].(string)
+	if streamID == "" {
+		streamID = ingest.ParticipantID
+	}
+	source := parseTrackSources(map[string]interface{}{trackID: sfuCommand.Payload["source"]})[trackID]
+	if source == "" {
+		source = defaultTrackSource(kind, streamID, trackID)
+	}
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP(C.IngestBindAddress), Port: int(port)})
+	if err != nil {
+		failIngest(ingest, "Error opening ingest socket", err)
+		return
+	}
+	ingest.conn = conn
+
+	meeting.mu.Lock()
+	var refused error
+	if _, exists := meeting.ingests[ingestID]; exists {
+		refused = errors.New("ingest already running")
+	} else if _, exists := meeting.routers[trackID]; exists {
+		refused = errors.New("track already published: " + trackID)
+	} else if meeting.e2ee {
+		// Clients would fail to decrypt the ingested frames
+		refused = errors.New("meeting is end-to-end encrypted")
+	}
+	if refused == nil {
+		ingest.router = newRouter(trackID, streamID, kind, capability, false, source)
+		meeting.ingests[ingestID] = ingest
+		meeting.routers[trackID] = ingest.router
+		meeting.trackPublishers[trackID] = ingest.ParticipantID
+	}
+	meeting.mu.Unlock()
+
+	if refused != nil {
+		conn.Close()
+		failIngest(ingest, "Ingest refused", refused)
+		return
+	}
+
+	ingest.router.attachSource(ingest.ParticipantID, nil, ingest.requestKeyframe)
+	routeToSubscribers(meeting, ingest.router, ingest.ParticipantID)
+	announceScreenShare(meeting, ingest.router, ingest.ParticipantID, true)
+	publishLifecycleEvent(meeting.ID, "trackPublished", trackEventData(ingest.router, ingest.ParticipantID))
+
+	sfuLogger.Info("INGEST", "Ingest started", map[string]interface{}{
+		"ingestID":      ingestID,
+		"meetingID":     meeting.ID,
+		"participantID": ingest.ParticipantID,
+		"trackID":       trackID,
+		"codec":         capability.MimeType,
+		"source":        source,
+		"address":       conn.LocalAddr().String(),
+	})
+	sendIngestStatus(ingest, "started", nil)
+
+	go ingest.readLoop(meeting)
+}
+
+// handleStopIngest stops an ingest and unpublishes its track. Payload: ingestId.
+func handleStopIngest(sfuCommand SFUCommand, meeting *Meeting) {
+	ingest := lookupIngest(sfuCommand, meeting)
+	if ingest == nil {
+		return
+	}
+	if sfuCommand.ReplyTo != "" {
+		ingest.ReplyTo = sfuCommand.ReplyTo
+	}
+	stopIngest(meeting, ingest, "stopped")
+}
+
+// handleGetIngestStatus reports an ingest's address and packet counts. Payload: ingestId.
+func handleGetIngestStatus(sfuCommand SFUCommand, meeting *Meeting) {
+	ingest := lookupIngest(sfuCommand, meeting)
+	if ingest == nil {
+		return
+	}
+	if sfuCommand.ReplyTo != "" {
+		ingest.ReplyTo = sfuCommand.ReplyTo
+	}
+	sendIngestStatus(ingest, "running", nil)
+}
+
+func lookupIngest(sfuCommand SFUCommand, meeting *Meeting) *Ingest {
+	ingestID, _ := sfuCommand.Payload["ingestId"].(string)
+
+	meeting.mu.RLock()
+	ingest, ok := meeting.ingests[ingestID]
+	meeting.mu.RUnlock()
+	if !ok {
+		sfuLogger.Warn("INGEST", "Ingest not found", map[string]interface{}{
+			"commandType": sfuCommand.Type,
+			"ingestID":    ingestID,
+			"meetingID":   meeting.ID,
+		})
+		return nil
+	}
+	return ingest
+}
+
+// stopIngest closes the ingest socket; the read loop then unpublishes the track
+func stopIngest(meeting *Meeting, ingest *Ingest, status string) {
+	meeting.mu.Lock()
+	_, exists := meeting.ingests[ingest.ID]
+	if exists {
+		delete(meeting.ingests, ingest.ID)
+		ingest.status = status
+	}
+	meeting.mu.Unlock()
+
+	if exists {
+		ingest.conn.Close()
+	}
+}
+
+// stopMeetingIngests stops every ingest of a meeting
+func stopMeetingIngests(meeting *Meeting) {
+	meeting.mu.RLock()
+	ingests := make([]*Ingest, 0, len(meeting.ingests))
+	for _, ingest := range meeting.ingests {
+		ingests = append(ingests, ingest)
+	}
+	meeting.mu.RUnlock()
+
+	for _, ingest := range ingests {
+		stopIngest(meeting, ingest, "stopped")
+	}
+}
+
+// readLoop forwards the received RTP to the router until the ingest stops or goes idle
+func (ingest *Ingest) readLoop(meeting *Meeting) {
+	trackID := ingest.router.ID()
+	var readErr error
+
+	for {
+		ingest.conn.SetReadDeadline(time.Now().Add(C.IngestIdleTimeout))
+
+		fp := getForwardPacket()
+		n, addr, err := ingest.conn.ReadFromUDP(fp.buf[:])
+		if err != nil {
+			fp.release()
+			readErr = err
+			break
+		}
+		if err := fp.packet.Unmarshal(fp.buf[:n]); err != nil || isMuxedRTCP(fp.packet.PayloadType) ||
+			(ingest.payloadType >= 0 && int(fp.packet.PayloadType) != ingest.payloadType) {
+			fp.release()
+			continue
+		}
+
+		if previous := ingest.lastSource.Load(); previous == nil || !previous.IP.Equal(addr.IP) || previous.Port != addr.Port {
+			ingest.lastSource.Store(addr)
+		}
+		atomic.StoreUint32(&ingest.lastSSRC, fp.packet.SSRC)
+		atomic.AddUint64(&ingest.packets, 1)
+		atomic.AddUint64(&ingest.bytes, uint64(len(fp.packet.Payload)))
+
+		ingest.router.WriteRTP(fp)
+		fp.release()
+	}
+
+	// Stopped ingests already left the meeting's ingests; anything else ended on its own
+	meeting.mu.Lock()
+	var cause error
+	if _, running := meeting.ingests[ingest.ID]; running {
+		delete(meeting.ingests, ingest.ID)
+		ingest.status = "failed"
+		cause = readErr
+		var netErr net.Error
+		if errors.As(readErr, &netErr) && netErr.Timeout() {
+			ingest.status = "timeout"
+		}
+	}
+	status := ingest.status
+	unpublished := meeting.routers[trackID] == ingest.router
+	if unpublished {
+		delete(meeting.routers, trackID)
+		delete(meeting.trackPublishers, trackID)
+	}
+	meeting.mu.Unlock()
+	ingest.conn.Close()
+
+	if unpublished {
+		ingest.router.Close()
+		removeTrackFromRelays(meeting, trackID)
+		announceScreenShare(meeting, ingest.router, ingest.ParticipantID, false)
+		publishLifecycleEvent(meeting.ID, "trackUnpublished", trackEventData(ingest.router, ingest.ParticipantID))
+	}
+
+	sfuLogger.Info("INGEST", "Ingest stopped", map[string]interface{}{
+		"ingestID":  ingest.ID,
+		"meetingID": meeting.ID,
+		"trackID":   trackID,
+		"status":    status,
+		"packets":   atomic.LoadUint64(&ingest.packets),
+		"duration":  time.Since(ingest.startedAt).Round(time.Second).String(),
+	})
+	sendIngestStatus(ingest, status, cause)
+}
+
+// requestKeyframe sends a PLI to the address the ingested RTP comes from
+func (ingest *Ingest) requestKeyframe() {
+	addr := ingest.lastSource.Load()
+	if addr == nil {
+		return
+	}
+	packet, err := rtcp.Marshal([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: atomic.LoadUint32(&ingest.lastSSRC)}})
+	if err == nil {
+		_, err = ingest.conn.WriteToUDP(packet, addr)
+	}
+	if err != nil {
+		sfuLogger.Debug("INGEST", "Error sending keyframe request to ingest source", map[string]interface{}{
+			"ingestID": ingest.ID,
+			"source":   addr.String(),
+			"error":    err.Error(),
+		})
+	}
+}
+
+// isMuxedRTCP reports whether an RTP payload type is really an RTCP packet type (RFC 5761)
+func isMuxedRTCP(payloadType uint8) bool {
+	return payloadType >= 64 && payloadType <= 95
+}
+
+// failIngest logs an ingest that could not start and reports it to the requester
+func failIngest(ingest *Ingest, message string, cause error) {
+	sfuLogger.Error("INGEST", message, cause, map[string]interface{}{
+		"ingestID":  ingest.ID,
+		"meetingID": ingest.MeetingID,
+	})
+	sfuState.IncrementCounters(0, 0, 1)
+	sendIngestStatus(ingest, "failed", cause)
+}
+
+// sendIngestStatus reports an ingest's state, local address and packet counts to its reply topic
+func sendIngestStatus(ingest *Ingest, status string, cause error) {
+	if ingest.ReplyTo == "" {
+		return
+	}
+
+	payload := map[string]interface{}{
+		"ingestId":      ingest.ID,
+		"meetingId":     ingest.MeetingID,
+		"participantId": ingest.ParticipantID,
+		"status":        status,
+		"startedAt":     ingest.startedAt.UnixMilli(),
+		"packets":       atomic.LoadUint64(&ingest.packets),
+		"bytes":         atomic.LoadUint64(&ingest.bytes),
+	}
+	if ingest.conn != nil {
+		payload["port"] = ingest.conn.LocalAddr().(*net.UDPAddr).Port
+	}
+	if ingest.router != nil {
+		payload["trackId"] = ingest.router.ID()
+		payload["streamId"] = ingest.router.StreamID()
+		payload["kind"] = ingest.router.Kind().String()
+		payload["codec"] = strings.ToLower(ingest.router.Codec().MimeType)
+		payload["source"] = ingest.router.Source()
+	}
+	if source := ingest.lastSource.Load(); source != nil {
+		payload["sourceAddress"] = source.String()
+	}
+	if cause != nil {
+		payload["error"] = cause.Error()
+	}
+
+	if err := sendKafkaMessage(ingest.ReplyTo, ingest.MeetingID, WSMessage{
+		Type:     "ingestStatus",
+		SenderID: sfuID,
+		Payload:  payload,
+	}); err != nil {
+		sfuLogger.Error("INGEST", "Error sending ingest status", err, map[string]interface{}{
+			"ingestID": ingest.ID,
+			"replyTo":  ingest.ReplyTo,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+	}
+}
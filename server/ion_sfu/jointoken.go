@@ -0,0 +1,302 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// joinTokenLeeway absorbs clock skew between the auth service and the SFU
+const joinTokenLeeway = 30 * time.Second
+
+// signatureKey is one verification key; every key is bound to a single algorithm
+// so a signer cannot pick a weaker one (e.g. HS256 with an RSA public key as secret)
+type signatureKey struct {
+	alg     string // "HS256", "RS256" or "EdDSA"
+	secret  []byte
+	rsaKey  *rsa.PublicKey
+	edKey   ed25519.PublicKey
+	issuers []string // Command issuers the key may sign as; unused for join tokens
+}
+
+// joinTokenKeys maps key IDs to verification keys; the shared secret has the empty key ID
+var joinTokenKeys map[string]signatureKey
+
+// jsonWebKey is the subset of RFC 7517 keys the SFU understands
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	K   string `json:"k"` // oct
+	N   string `json:"n"` // RSA
+	E   string `json:"e"`
+	X   string `json:"x"` // OKP
+
+	Issuers []string `json:"issuers"` // Command keys only: issuers the key signs as (default: its kid)
+}
+
+// initJoinTokens loads the keys join tokens are verified with. Without keys joins are not authenticated.
+func initJoinTokens() {
+	keys, err := loadJoinTokenKeys()
+	if err != nil {
+		sfuLogger.Error("AUTH", "Error loading join token keys", err, map[string]interface{}{
+			"keysFile": C.JoinTokenKeysFile,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		panic(fmt.Sprintf("Error loading join token keys: %v", err))
+	}
+	joinTokenKeys = keys
+
+	if !joinTokensEnabled() {
+		sfuLogger.Warn("AUTH", "No join token keys configured, clientJoined commands are not authenticated", nil)
+		return
+	}
+
+	keyIDs := make([]string, 0, len(keys))
+	for keyID, key := range keys {
+		keyIDs = append(keyIDs, keyID+"/"+key.alg)
+	}
+	sfuLogger.Info("AUTH", "Join token verification enabled", map[string]interface{}{
+		"keys":     keyIDs,
+		"audience": C.JoinTokenAudience,
+		"issuer":   C.JoinTokenIssuer,
+	})
+}
+
+// joinTokensEnabled reports whether clientJoined commands must carry a valid token
+func joinTokensEnabled() bool {
+	return len(joinTokenKeys) > 0
+}
+
+func loadJoinTokenKeys() (map[string]signatureKey, error) {
+	keys := make(map[string]signatureKey)
+	if C.JoinTokenSecret != "" {
+		keys[""] = signatureKey{alg: "HS256", secret: []byte(C.JoinTokenSecret)}
+	}
+	if C.JoinTokenKeysFile == "" {
+		return keys, nil
+	}
+	return keys, loadJSONWebKeySet(C.JoinTokenKeysFile, keys)
+}
+
+// loadJSONWebKeySet adds the keys of a JWK set file to keys, indexed by key ID
+func loadJSONWebKeySet(path string, keys map[string]signatureKey) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var keySet struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &keySet); err != nil {
+		return fmt.Errorf("parsing key set: %w", err)
+	}
+
+	for _, jwk := range keySet.Keys {
+		key, err := parseJSONWebKey(jwk)
+		if err != nil {
+			return fmt.Errorf("key %q: %w", jwk.Kid, err)
+		}
+		if _, exists := keys[jwk.Kid]; exists {
+			return fmt.Errorf("duplicate key ID %q", jwk.Kid)
+		}
+		keys[jwk.Kid] = key
+	}
+	return nil
+}
+
+func parseJSONWebKey(jwk jsonWebKey) (signatureKey, error) {
+	var key signatureKey
+	switch jwk.Kty {
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(jwk.K)
+		if err != nil || len(secret) == 0 {
+			return key, fmt.Errorf("invalid symmetric key")
+		}
+		key.alg, key.secret = "HS256", secret
+	case "RSA":
+		n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+		e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+		if errN != nil || errE != nil || len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return key, fmt.Errorf("invalid RSA key")
+		}
+		key.alg = "RS256"
+		key.rsaKey = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if key.rsaKey.N.BitLen() < 2048 {
+			return key, fmt.Errorf("RSA keys must have at least 2048 bits")
+		}
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if jwk.Crv != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+			return key, fmt.Errorf("invalid Ed25519 key")
+		}
+		key.alg, key.edKey = "EdDSA", ed25519.PublicKey(x)
+	default:
+		return key, fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+
+	if jwk.Alg != "" && jwk.Alg != key.alg {
+		return key, fmt.Errorf("algorithm %q does not match key type %q", jwk.Alg, jwk.Kty)
+	}
+	key.issuers = jwk.Issuers
+	return key, nil
+}
+
+// verify checks a signature made with the key's algorithm
+func (key signatureKey) verify(signingInput, signature []byte) bool {
+	switch key.alg {
+	case "HS256":
+		mac := hmac.New(sha256.New, key.secret)
+		mac.Write(signingInput)
+		return hmac.Equal(signature, mac.Sum(nil))
+	case "RS256":
+		digest := sha256.Sum256(signingInput)
+		return rsa.VerifyPKCS1v15(key.rsaKey, crypto.SHA256, digest[:], signature) == nil
+	case "EdDSA":
+		return ed25519.Verify(key.edKey, signingInput, signature)
+	default:
+		return false
+	}
+}
+
+// verifyJoinToken checks a join token's signature, issuer, audience and validity period.
+// expiredGrace accepts tokens that expired at most that long ago.
+func verifyJoinToken(token string, expiredGrace time.Duration) (*JoinTokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeTokenSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid header: %w", err)
+	}
+
+	key, ok := joinTokenKeys[header.Kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key ID %q", header.Kid)
+	}
+	if header.Alg != key.alg {
+		return nil, fmt.Errorf("algorithm %q not allowed for key %q", header.Alg, header.Kid)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature encoding")
+	}
+	if !key.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return nil, fmt.Errorf("invalid signature")
+	}
+
+	var claims JoinTokenClaims
+	if err := decodeTokenSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid claims: %w", err)
+	}
+
+	now := time.Now()
+	if claims.ExpiresAt == 0 {
+		return nil, fmt.Errorf("token has no expiry")
+	}
+	if now.After(time.Unix(claims.ExpiresAt, 0).Add(joinTokenLeeway + expiredGrace)) {
+		return nil, fmt.Errorf("token expired")
+	}
+	if claims.NotBefore != 0 && now.Add(joinTokenLeeway).Before(time.Unix(claims.NotBefore, 0)) {
+		return nil, fmt.Errorf("token not valid yet")
+	}
+	if C.JoinTokenIssuer != "" && claims.Issuer != C.JoinTokenIssuer {
+		return nil, fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	if C.JoinTokenAudience != "" && !tokenAudienceContains(claims.Audience, C.JoinTokenAudience) {
+		return nil, fmt.Errorf("token not issued for audience %q", C.JoinTokenAudience)
+	}
+	return &claims, nil
+}
+
+func decodeTokenSegment(segment string, value interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
+
+// tokenAudienceContains accepts the string and array forms of the aud claim
+func tokenAudienceContains(raw json.RawMessage, audience string) bool {
+	var single string
+	if json.Unmarshal(raw, &single) == nil {
+		return single == audience
+	}
+	var list []string
+	if json.Unmarshal(raw, &list) == nil {
+		for _, entry := range list {
+			if entry == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// authenticateJoin verifies the join token of a clientJoined command for this meeting and client.
+// It rejects the command and returns false when the token is missing or invalid. Without
+// configured keys every join is accepted and the returned claims are nil.
+func authenticateJoin(sfuCommand SFUCommand, meeting *Meeting, clientID string) (*JoinTokenClaims, bool) {
+	if !joinTokensEnabled() {
+		return nil, true
+	}
+
+	token, _ := sfuCommand.Payload["token"].(string)
+	if token == "" {
+		sfuLogger.Warn("AUTH", "clientJoined without join token", map[string]interface{}{
+			"clientID":  clientID,
+			"meetingID": meeting.ID,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		rejectMeetingCommand(sfuCommand, meeting, "", "missing_join_token")
+		return nil, false
+	}
+
+	// A client moved by a migration reuses the token it joined the source SFU with
+	var expiredGrace time.Duration
+	if verifiedMigratedFrom(sfuCommand) != "" {
+		expiredGrace = C.JoinTokenMigrationGrace
+	}
+
+	claims, err := verifyJoinToken(token, expiredGrace)
+	if err != nil {
+		sfuLogger.Warn("AUTH", "Rejected join token", map[string]interface{}{
+			"clientID":  clientID,
+			"meetingID": meeting.ID,
+			"error":     err.Error(),
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		rejectMeetingCommand(sfuCommand, meeting, "", "invalid_join_token")
+		return nil, false
+	}
+
+	if claims.MeetingID != meeting.ID || claims.Subject != clientID {
+		sfuLogger.Warn("AUTH", "Join token issued for another meeting or user", map[string]interface{}{
+			"clientID":       clientID,
+			"meetingID":      meeting.ID,
+			"tokenMeetingID": claims.MeetingID,
+			"tokenSubject":   claims.Subject,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		rejectMeetingCommand(sfuCommand, meeting, "", "join_token_mismatch")
+		return nil, false
+	}
+	return claims, true
+}
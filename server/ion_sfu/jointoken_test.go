@@ -0,0 +1,412 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// joinTokenTestKeys are the signing halves of the keys installed by setupJoinTokenKeys
+type joinTokenTestKeys struct {
+	secret       []byte
+	rsaKey       *rsa.PrivateKey
+	edKey        ed25519.PrivateKey
+	rsaPublicPEM []byte
+}
+
+func b64(data []byte) string { return base64.RawURLEncoding.EncodeToString(data) }
+
+// setupJoinTokenKeys writes a JWK set with an HS256, an RS256 and an EdDSA key and loads it
+// the way initJoinTokens does
+func setupJoinTokenKeys(t *testing.T) joinTokenTestKeys {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublic, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := joinTokenTestKeys{
+		secret:       []byte("join-token-test-secret"),
+		rsaKey:       rsaKey,
+		edKey:        edKey,
+		rsaPublicPEM: pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}),
+	}
+
+	keySet := map[string][]map[string]string{"keys": {
+		{"kty": "oct", "kid": "hs", "alg": "HS256", "k": b64(keys.secret)},
+		{"kty": "RSA", "kid": "rsa", "alg": "RS256", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": b64(edPublic)},
+	}}
+	data, err := json.Marshal(keySet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := C
+	t.Cleanup(func() {
+		C = previous
+		joinTokenKeys = nil
+	})
+	C.JoinTokenSecret = ""
+	C.JoinTokenKeysFile = path
+	C.JoinTokenIssuer = "videochat-auth"
+	C.JoinTokenAudience = "sfu"
+	C.JoinTokenMigrationGrace = 5 * time.Minute
+
+	joinTokenKeys, err = loadJoinTokenKeys()
+	if err != nil {
+		t.Fatalf("loading key set: %v", err)
+	}
+	return keys
+}
+
+// signJoinToken builds a compact JWS with the given header and claims
+func signJoinToken(t *testing.T, header, claims map[string]interface{}, sign func(signingInput []byte) []byte) string {
+	t.Helper()
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingInput := b64(headerJSON) + "." + b64(claimsJSON)
+	return signingInput + "." + b64(sign([]byte(signingInput)))
+}
+
+func hs256(secret []byte) func([]byte) []byte {
+	return func(input []byte) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(input)
+		return mac.Sum(nil)
+	}
+}
+
+func rs256(t *testing.T, key *rsa.PrivateKey) func([]byte) []byte {
+	return func(input []byte) []byte {
+		digest := sha256.Sum256(input)
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signature
+	}
+}
+
+func eddsa(key ed25519.PrivateKey) func([]byte) []byte {
+	return func(input []byte) []byte { return ed25519.Sign(key, input) }
+}
+
+// validClaims are the claims of a token for client-1 in meeting-1, valid for an hour
+func validClaims() map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"meetingId": "meeting-1",
+		"sub":       "client-1",
+		"role":      roleAttendee,
+		"iss":       "videochat-auth",
+		"aud":       "sfu",
+		"iat":       now.Unix(),
+		"exp":       now.Add(time.Hour).Unix(),
+	}
+}
+
+func withClaims(update func(claims map[string]interface{})) map[string]interface{} {
+	claims := validClaims()
+	update(claims)
+	return claims
+}
+
+func TestVerifyJoinToken(t *testing.T) {
+	keys := setupJoinTokenKeys(t)
+	now := time.Now()
+
+	hsHeader := map[string]interface{}{"alg": "HS256", "kid": "hs", "typ": "JWT"}
+	rsHeader := map[string]interface{}{"alg": "RS256", "kid": "rsa", "typ": "JWT"}
+	edHeader := map[string]interface{}{"alg": "EdDSA", "kid": "ed", "typ": "JWT"}
+
+	tests := []struct {
+		name    string
+		token   string
+		grace   time.Duration
+		wantErr string
+	}{
+		{
+			name:  "HS256",
+			token: signJoinToken(t, hsHeader, validClaims(), hs256(keys.secret)),
+		},
+		{
+			name:  "RS256",
+			token: signJoinToken(t, rsHeader, validClaims(), rs256(t, keys.rsaKey)),
+		},
+		{
+			name:  "EdDSA",
+			token: signJoinToken(t, edHeader, validClaims(), eddsa(keys.edKey)),
+		},
+		{
+			name: "audience array",
+			token: signJoinToken(t, edHeader, withClaims(func(c map[string]interface{}) {
+				c["aud"] = []string{"recorder", "sfu"}
+			}), eddsa(keys.edKey)),
+		},
+		{
+			name: "audience array without this SFU",
+			token: signJoinToken(t, edHeader, withClaims(func(c map[string]interface{}) {
+				c["aud"] = []string{"recorder", "chat"}
+			}), eddsa(keys.edKey)),
+			wantErr: "audience",
+		},
+		{
+			name: "other audience string",
+			token: signJoinToken(t, edHeader, withClaims(func(c map[string]interface{}) {
+				c["aud"] = "recorder"
+			}), eddsa(keys.edKey)),
+			wantErr: "audience",
+		},
+		{
+			name: "other issuer",
+			token: signJoinToken(t, edHeader, withClaims(func(c map[string]interface{}) {
+				c["iss"] = "someone-else"
+			}), eddsa(keys.edKey)),
+			wantErr: "issuer",
+		},
+		{
+			// The RSA public key is known to everyone; as an HMAC secret it must not be accepted
+			name:    "HS256 signed with the RSA public key",
+			token:   signJoinToken(t, map[string]interface{}{"alg": "HS256", "kid": "rsa"}, validClaims(), hs256(keys.rsaPublicPEM)),
+			wantErr: "not allowed",
+		},
+		{
+			name:    "alg none",
+			token:   signJoinToken(t, map[string]interface{}{"alg": "none", "kid": "hs"}, validClaims(), func([]byte) []byte { return nil }),
+			wantErr: "not allowed",
+		},
+		{
+			name:    "EdDSA token claiming the HS256 key",
+			token:   signJoinToken(t, map[string]interface{}{"alg": "EdDSA", "kid": "hs"}, validClaims(), eddsa(keys.edKey)),
+			wantErr: "not allowed",
+		},
+		{
+			name:    "unknown kid",
+			token:   signJoinToken(t, map[string]interface{}{"alg": "HS256", "kid": "retired"}, validClaims(), hs256(keys.secret)),
+			wantErr: "unknown key ID",
+		},
+		{
+			name:    "signed with another key",
+			token:   signJoinToken(t, hsHeader, validClaims(), hs256([]byte("another-secret"))),
+			wantErr: "invalid signature",
+		},
+		{
+			name: "expired",
+			token: signJoinToken(t, hsHeader, withClaims(func(c map[string]interface{}) {
+				c["exp"] = now.Add(-time.Hour).Unix()
+			}), hs256(keys.secret)),
+			wantErr: "expired",
+		},
+		{
+			name: "expired within leeway",
+			token: signJoinToken(t, hsHeader, withClaims(func(c map[string]interface{}) {
+				c["exp"] = now.Add(-joinTokenLeeway / 2).Unix()
+			}), hs256(keys.secret)),
+		},
+		{
+			name: "expired within migration grace",
+			token: signJoinToken(t, hsHeader, withClaims(func(c map[string]interface{}) {
+				c["exp"] = now.Add(-time.Hour).Unix()
+			}), hs256(keys.secret)),
+			grace: 12 * time.Hour,
+		},
+		{
+			name: "expired beyond migration grace",
+			token: signJoinToken(t, hsHeader, withClaims(func(c map[string]interface{}) {
+				c["exp"] = now.Add(-13 * time.Hour).Unix()
+			}), hs256(keys.secret)),
+			grace:   12 * time.Hour,
+			wantErr: "expired",
+		},
+		{
+			name:    "no expiry",
+			token:   signJoinToken(t, hsHeader, withClaims(func(c map[string]interface{}) { delete(c, "exp") }), hs256(keys.secret)),
+			wantErr: "no expiry",
+		},
+		{
+			name: "not before in the future",
+			token: signJoinToken(t, hsHeader, withClaims(func(c map[string]interface{}) {
+				c["nbf"] = now.Add(10 * time.Minute).Unix()
+			}), hs256(keys.secret)),
+			wantErr: "not valid yet",
+		},
+		{
+			name: "not before within leeway",
+			token: signJoinToken(t, hsHeader, withClaims(func(c map[string]interface{}) {
+				c["nbf"] = now.Add(joinTokenLeeway / 2).Unix()
+			}), hs256(keys.secret)),
+		},
+		{
+			name:    "malformed",
+			token:   "not-a-token",
+			wantErr: "malformed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := verifyJoinToken(tt.token, tt.grace)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if claims.MeetingID != "meeting-1" || claims.Subject != "client-1" {
+					t.Fatalf("claims = %+v", claims)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthenticateJoin(t *testing.T) {
+	keys := setupJoinTokenKeys(t)
+	header := map[string]interface{}{"alg": "EdDSA", "kid": "ed"}
+	expired := withClaims(func(c map[string]interface{}) {
+		c["exp"] = time.Now().Add(-time.Hour).Unix()
+	})
+	recentlyExpired := withClaims(func(c map[string]interface{}) {
+		c["exp"] = time.Now().Add(-2 * time.Minute).Unix()
+	})
+	migrated := func(claims map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"token":        signJoinToken(t, header, claims, eddsa(keys.edKey)),
+			"migratedFrom": "sfu-source",
+		}
+	}
+
+	tests := []struct {
+		name     string
+		payload  map[string]interface{}
+		issuer   string // Verified envelope issuer
+		clientID string
+		want     bool
+	}{
+		{
+			name:     "valid",
+			payload:  map[string]interface{}{"token": signJoinToken(t, header, validClaims(), eddsa(keys.edKey))},
+			clientID: "client-1",
+			want:     true,
+		},
+		{
+			name:     "missing token",
+			payload:  map[string]interface{}{},
+			clientID: "client-1",
+		},
+		{
+			name: "other meeting",
+			payload: map[string]interface{}{"token": signJoinToken(t, header, withClaims(func(c map[string]interface{}) {
+				c["meetingId"] = "meeting-2"
+			}), eddsa(keys.edKey))},
+			clientID: "client-1",
+		},
+		{
+			name:     "other subject",
+			payload:  map[string]interface{}{"token": signJoinToken(t, header, validClaims(), eddsa(keys.edKey))},
+			clientID: "client-2",
+		},
+		{
+			name:     "expired",
+			payload:  map[string]interface{}{"token": signJoinToken(t, header, expired, eddsa(keys.edKey))},
+			clientID: "client-1",
+		},
+		{
+			name:     "expired token of a client migrated by a signed command",
+			payload:  migrated(recentlyExpired),
+			issuer:   "sfu-source",
+			clientID: "client-1",
+			want:     true,
+		},
+		{
+			name:     "token of a migrated client expired beyond the grace",
+			payload:  migrated(expired),
+			issuer:   "sfu-source",
+			clientID: "client-1",
+		},
+		{
+			name:     "unsigned migratedFrom",
+			payload:  migrated(recentlyExpired),
+			clientID: "client-1",
+		},
+		{
+			name:     "migratedFrom signed by a service other than an SFU",
+			payload:  migrated(recentlyExpired),
+			issuer:   "signaling-server",
+			clientID: "client-1",
+		},
+		{
+			name:     "migratedFrom signed by another SFU than the source",
+			payload:  migrated(recentlyExpired),
+			issuer:   "sfu-other",
+			clientID: "client-1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meeting := &Meeting{ID: "meeting-1"}
+			command := SFUCommand{Type: "clientJoined", Payload: tt.payload, issuer: tt.issuer}
+			claims, ok := authenticateJoin(command, meeting, tt.clientID)
+			if ok != tt.want {
+				t.Fatalf("authenticateJoin = %v, want %v", ok, tt.want)
+			}
+			if ok && (claims == nil || claims.Role != roleAttendee) {
+				t.Fatalf("claims = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestParseJSONWebKeyRejectsShortRSAKeys(t *testing.T) {
+	for _, bits := range []int{1024, 2047} {
+		key, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		jwk := jsonWebKey{Kty: "RSA", Kid: "short", N: b64(key.N.Bytes()), E: b64(big.NewInt(int64(key.E)).Bytes())}
+		if _, err := parseJSONWebKey(jwk); err == nil {
+			t.Errorf("%d-bit RSA key accepted", bits)
+		}
+	}
+}
+
+func TestParseJSONWebKeyRejectsAlgorithmMismatch(t *testing.T) {
+	jwk := jsonWebKey{Kty: "oct", Kid: "hs", Alg: "RS256", K: b64([]byte("secret"))}
+	if _, err := parseJSONWebKey(jwk); err == nil {
+		t.Fatal("symmetric key declared as RS256 accepted")
+	}
+}
@@ -65,6 +65,12 @@ func setupKafkaConsumer() ([]sarama.PartitionConsumer, error) {
 	config := sarama.NewConfig()
 	config.Consumer.Group.Rebalance.Strategy = sarama.BalanceStrategyRoundRobin
 	config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	if err := applyKafkaSecurity(config); err != nil {
+		sfuLogger.Error("KAFKA", "Invalid Kafka security configuration", err, map[string]interface{}{
+			"sfuID": sfuID,
+		})
+		return nil, err
+	}
 
 	sfuLogger.Debug("KAFKA", "Kafka consumer configuration", map[string]interface{}{
 		"rebalanceStrategy": config.Consumer.Group.Rebalance.Strategy,
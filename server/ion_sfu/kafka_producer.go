@@ -1,6 +1,8 @@
 package main
 
 import (
+	"encoding/json"
+
 	"github.com/IBM/sarama"
 )
 
@@ -15,6 +17,14 @@ func initKafka() {
 	config.Producer.RequiredAcks = sarama.WaitForAll
 	config.Producer.Retry.Max = C.KafkaRetryMax
 	config.Producer.Return.Successes = true
+	if err := applyKafkaSecurity(config); err != nil {
+		sfuLogger.Error("KAFKA", "Invalid Kafka security configuration", err, map[string]interface{}{
+			"sfuID": sfuID,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		sfuState.UpdateConnections(false, true, false)
+		return
+	}
 
 	sfuLogger.Debug("KAFKA", "Kafka configuration", map[string]interface{}{
 		"requiredAcks":    config.Producer.RequiredAcks,
@@ -38,3 +48,64 @@ func initKafka() {
 	})
 	sfuState.UpdateConnections(true, true, false) // Kafka success, Redis assumed true
 }
+
+// sendKafkaMessage marshals a message and publishes it to the given topic, keyed by key
+func sendKafkaMessage(topic, key string, message WSMessage) error {
+	return publishKafkaJSON(topic, key, message.Type, message)
+}
+
+// sendSFUCommand publishes a command to another SFU on the sfu_commands topic, signed when a signing key is configured
+func sendSFUCommand(targetSFUID string, command SFUCommand) error {
+	msgJSON, err := sealCommand(targetSFUID, command)
+	if err != nil {
+		sfuLogger.Error("KAFKA", "Error marshalling Kafka message", err, map[string]interface{}{
+			"topic":       "sfu_commands",
+			"messageType": command.Type,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return err
+	}
+	return publishKafka("sfu_commands", targetSFUID, command.Type, msgJSON)
+}
+
+// publishKafkaJSON marshals value and publishes it to the given topic, keyed by key
+func publishKafkaJSON(topic, key, messageType string, value interface{}) error {
+	msgJSON, err := json.Marshal(value)
+	if err != nil {
+		sfuLogger.Error("KAFKA", "Error marshalling Kafka message", err, map[string]interface{}{
+			"topic":       topic,
+			"messageType": messageType,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return err
+	}
+	return publishKafka(topic, key, messageType, msgJSON)
+}
+
+// publishKafka publishes an encoded message to the given topic, keyed by key
+func publishKafka(topic, key, messageType string, msgJSON []byte) error {
+	partition, offset, err := producer.SendMessage(&sarama.ProducerMessage{
+		Topic: topic,
+		Key:   sarama.StringEncoder(key),
+		Value: sarama.ByteEncoder(msgJSON),
+	})
+	if err != nil {
+		sfuLogger.Error("KAFKA", "Error sending Kafka message", err, map[string]interface{}{
+			"topic":       topic,
+			"key":         key,
+			"messageType": messageType,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return err
+	}
+
+	sfuLogger.Debug("KAFKA", "Kafka message sent", map[string]interface{}{
+		"topic":       topic,
+		"key":         key,
+		"messageType": messageType,
+		"partition":   partition,
+		"offset":      offset,
+		"messageSize": len(msgJSON),
+	})
+	return nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/IBM/sarama"
+)
+
+// applyKafkaSecurity configures TLS and SASL for a Sarama consumer or producer
+func applyKafkaSecurity(config *sarama.Config) error {
+	if C.KafkaTLSEnabled {
+		tlsConfig, err := kafkaTLSConfig()
+		if err != nil {
+			return err
+		}
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = tlsConfig
+	}
+
+	switch C.KafkaSASLMechanism {
+	case "":
+		return nil
+	case sarama.SASLTypePlaintext:
+		config.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+	case sarama.SASLTypeSCRAMSHA256:
+		config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+		config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &scramClient{hash: sha256.New} }
+	case sarama.SASLTypeSCRAMSHA512:
+		config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+		config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &scramClient{hash: sha512.New} }
+	default:
+		return fmt.Errorf("unsupported SASL mechanism %q", C.KafkaSASLMechanism)
+	}
+
+	config.Net.SASL.Enable = true
+	config.Net.SASL.Handshake = true
+	config.Net.SASL.User = C.KafkaSASLUser
+	config.Net.SASL.Password = C.KafkaSASLPassword
+	return nil
+}
+
+func kafkaTLSConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: C.KafkaTLSInsecureSkipVerify,
+	}
+
+	if C.KafkaTLSCAFile != "" {
+		caPEM, err := os.ReadFile(C.KafkaTLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in %s", C.KafkaTLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if C.KafkaTLSCertFile != "" || C.KafkaTLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(C.KafkaTLSCertFile, C.KafkaTLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// scramClient implements the client side of SCRAM (RFC 5802) for Sarama
+type scramClient struct {
+	hash func() hash.Hash
+
+	step            int
+	user            string
+	password        string
+	authzID         string
+	clientNonce     string
+	clientFirstBare string
+	serverSignature []byte
+	done            bool
+}
+
+func (c *scramClient) Begin(userName, password, authzID string) error {
+	nonce := make([]byte, 24)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	c.user = userName
+	c.password = password
+	c.authzID = authzID
+	c.clientNonce = base64.RawStdEncoding.EncodeToString(nonce)
+	c.step = 0
+	c.done = false
+	return nil
+}
+
+func (c *scramClient) Step(challenge string) (string, error) {
+	c.step++
+	switch c.step {
+	case 1:
+		c.clientFirstBare = "n=" + scramEscape(c.user) + ",r=" + c.clientNonce
+		return c.gs2Header() + c.clientFirstBare, nil
+	case 2:
+		return c.clientFinal(challenge)
+	case 3:
+		c.done = true
+		attributes := scramAttributes(challenge)
+		if serverError, ok := attributes["e"]; ok {
+			return "", fmt.Errorf("SCRAM server error: %s", serverError)
+		}
+		signature, err := base64.StdEncoding.DecodeString(attributes["v"])
+		if err != nil || !hmac.Equal(signature, c.serverSignature) {
+			return "", fmt.Errorf("SCRAM server signature mismatch")
+		}
+		return "", nil
+	default:
+		return "", fmt.Errorf("unexpected SCRAM step %d", c.step)
+	}
+}
+
+func (c *scramClient) Done() bool {
+	return c.done
+}
+
+func (c *scramClient) gs2Header() string {
+	if c.authzID == "" {
+		return "n,,"
+	}
+	return "n,a=" + scramEscape(c.authzID) + ","
+}
+
+// clientFinal answers the server-first message with the client proof
+func (c *scramClient) clientFinal(serverFirst string) (string, error) {
+	attributes := scramAttributes(serverFirst)
+	nonce, encodedSalt, encodedIterations := attributes["r"], attributes["s"], attributes["i"]
+	if !strings.HasPrefix(nonce, c.clientNonce) || len(nonce) == len(c.clientNonce) {
+		return "", fmt.Errorf("SCRAM server nonce does not extend the client nonce")
+	}
+	salt, err := base64.StdEncoding.DecodeString(encodedSalt)
+	if err != nil {
+		return "", fmt.Errorf("invalid SCRAM salt")
+	}
+	iterations, err := strconv.Atoi(encodedIterations)
+	if err != nil || iterations < 1 {
+		return "", fmt.Errorf("invalid SCRAM iteration count")
+	}
+
+	saltedPassword := pbkdf2Key(c.hash, []byte(c.password), salt, iterations)
+	clientKey := scramHMAC(c.hash, saltedPassword, []byte("Client Key"))
+	storedKeyHash := c.hash()
+	storedKeyHash.Write(clientKey)
+	storedKey := storedKeyHash.Sum(nil)
+
+	clientFinalWithoutProof := "c=" + base64.StdEncoding.EncodeToString([]byte(c.gs2Header())) + ",r=" + nonce
+	authMessage := []byte(c.clientFirstBare + "," + serverFirst + "," + clientFinalWithoutProof)
+
+	clientSignature := scramHMAC(c.hash, storedKey, authMessage)
+	proof := make([]byte, len(clientKey))
+	for i := range clientKey {
+		proof[i] = clientKey[i] ^ clientSignature[i]
+	}
+	c.serverSignature = scramHMAC(c.hash, scramHMAC(c.hash, saltedPassword, []byte("Server Key")), authMessage)
+
+	return clientFinalWithoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof), nil
+}
+
+func scramHMAC(h func() hash.Hash, key, message []byte) []byte {
+	mac := hmac.New(h, key)
+	mac.Write(message)
+	return mac.Sum(nil)
+}
+
+// pbkdf2Key derives the SCRAM salted password (PBKDF2 with a single output block)
+func pbkdf2Key(h func() hash.Hash, password, salt []byte, iterations int) []byte {
+	mac := hmac.New(h, password)
+	mac.Write(salt)
+	mac.Write([]byte{0, 0, 0, 1})
+	u := mac.Sum(nil)
+	key := append([]byte(nil), u...)
+	for i := 1; i < iterations; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for j := range key {
+			key[j] ^= u[j]
+		}
+	}
+	return key
+}
+
+func scramAttributes(message string) map[string]string {
+	attributes := make(map[string]string)
+	for _, part := range strings.Split(message, ",") {
+		if len(part) >= 2 && part[1] == '=' {
+			attributes[part[:1]] = part[2:]
+		}
+	}
+	return attributes
+}
+
+func scramEscape(name string) string {
+	return strings.NewReplacer("=", "=3D", ",", "=2C").Replace(name)
+}
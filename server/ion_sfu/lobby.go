@@ -0,0 +1,220 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// Meetings prepared with "lobby": true hold joining participants in a lobby until a host
+// admits them. Waiting participants have no PeerConnection; hosts learn about them through
+// lobbyUpdated meeting events. Hosts and migrated clients skip the lobby, and so do
+// participants with a verified join token when LobbyAutoAdmitAuthenticated is set.
+
+// applyMeetingLobby turns the lobby on when a command asks for it
+func applyMeetingLobby(sfuCommand SFUCommand, meeting *Meeting) {
+	if lobby, _ := sfuCommand.Payload["lobby"].(bool); lobby {
+		meeting.mu.Lock()
+		meeting.lobbyEnabled = true
+		meeting.mu.Unlock()
+	}
+}
+
+// holdInLobby reports whether a joining client has to wait for a host, and if so adds it
+// to the lobby. A client that joins again while waiting keeps its place.
+func holdInLobby(meeting *Meeting, entry *LobbyEntry) bool {
+	if entry.options.migratedFrom != "" || rolePermissions[entry.options.role].manageRoles {
+		return false
+	}
+	if entry.authenticated && C.LobbyAutoAdmitAuthenticated {
+		return false
+	}
+
+	meeting.mu.Lock()
+	if _, joined := meeting.clients[entry.ClientID]; joined || !meeting.lobbyEnabled {
+		// Rejoining participants were admitted before
+		meeting.mu.Unlock()
+		return false
+	}
+	if previous, waiting := meeting.lobby[entry.ClientID]; waiting {
+		previous.timer.Stop()
+		entry.requestedAt = previous.requestedAt
+	}
+	entry.timer = time.AfterFunc(C.LobbyTimeout, func() {
+		expireLobbyEntry(meeting, entry)
+	})
+	meeting.lobby[entry.ClientID] = entry
+	waiting := len(meeting.lobby)
+	meeting.mu.Unlock()
+
+	sfuLogger.Info("KAFKA", "Client waiting in meeting lobby", map[string]interface{}{
+		"clientID":      entry.ClientID,
+		"meetingID":     meeting.ID,
+		"role":          entry.options.role,
+		"authenticated": entry.authenticated,
+		"waiting":       waiting,
+	})
+	announceLobby(meeting)
+	return true
+}
+
+// takeFromLobby removes a waiting client from the lobby and stops its timeout
+func takeFromLobby(meeting *Meeting, clientID string) *LobbyEntry {
+	meeting.mu.Lock()
+	defer meeting.mu.Unlock()
+
+	entry, ok := meeting.lobby[clientID]
+	if !ok {
+		return nil
+	}
+	delete(meeting.lobby, clientID)
+	entry.timer.Stop()
+	return entry
+}
+
+// expireLobbyEntry turns a client away that waited longer than the lobby timeout
+func expireLobbyEntry(meeting *Meeting, entry *LobbyEntry) {
+	meeting.mu.Lock()
+	if meeting.lobby[entry.ClientID] != entry {
+		meeting.mu.Unlock()
+		return
+	}
+	delete(meeting.lobby, entry.ClientID)
+	meeting.mu.Unlock()
+
+	sfuLogger.Info("KAFKA", "Lobby wait timed out", map[string]interface{}{
+		"clientID":  entry.ClientID,
+		"meetingID": meeting.ID,
+		"waited":    time.Since(entry.requestedAt).Round(time.Second).String(),
+	})
+	sendLobbyRejection(meeting, entry, "lobby_timeout")
+	announceLobby(meeting)
+}
+
+// handleAdmitParticipant lets a waiting client into the meeting and sets up its PeerConnection.
+// Payload: clientId, optional requestedBy (must be a host).
+func handleAdmitParticipant(sfuCommand SFUCommand, meeting *Meeting) {
+	entry, requestedBy := takeLobbyEntry(sfuCommand, meeting)
+	if entry == nil {
+		return
+	}
+
+	sfuLogger.Info("KAFKA", "Client admitted from lobby", map[string]interface{}{
+		"clientID":    entry.ClientID,
+		"meetingID":   meeting.ID,
+		"requestedBy": requestedBy,
+		"waited":      time.Since(entry.requestedAt).Round(time.Second).String(),
+	})
+	admitClient(meeting, entry.ClientID, entry.options)
+	announceLobby(meeting)
+}
+
+// handleDenyParticipant turns a waiting client away.
+// Payload: clientId, optional requestedBy (must be a host), optional reason.
+func handleDenyParticipant(sfuCommand SFUCommand, meeting *Meeting) {
+	entry, requestedBy := takeLobbyEntry(sfuCommand, meeting)
+	if entry == nil {
+		return
+	}
+
+	reason, _ := sfuCommand.Payload["reason"].(string)
+	if reason == "" {
+		reason = "lobby_denied"
+	}
+
+	sfuLogger.Info("KAFKA", "Client denied from lobby", map[string]interface{}{
+		"clientID":    entry.ClientID,
+		"meetingID":   meeting.ID,
+		"requestedBy": requestedBy,
+		"reason":      reason,
+	})
+	sendLobbyRejection(meeting, entry, reason)
+	announceLobby(meeting)
+}
+
+// takeLobbyEntry validates an admit or deny command and takes its client out of the lobby
+func takeLobbyEntry(sfuCommand SFUCommand, meeting *Meeting) (*LobbyEntry, string) {
+	clientID, ok := sfuCommand.Payload["clientId"].(string)
+	if !ok {
+		sfuLogger.Error("KAFKA", "Missing or invalid clientId in lobby command", nil, map[string]interface{}{
+			"commandType": sfuCommand.Type,
+			"payload":     sfuCommand.Payload,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return nil, ""
+	}
+	requestedBy, _ := sfuCommand.Payload["requestedBy"].(string)
+
+	meeting.mu.RLock()
+	authorized := mayManageMeeting(meeting, requestedBy)
+	meeting.mu.RUnlock()
+	if !authorized {
+		sfuLogger.Warn("KAFKA", "Lobby command requested by a participant who may not manage the meeting", map[string]interface{}{
+			"commandType": sfuCommand.Type,
+			"clientID":    clientID,
+			"meetingID":   meeting.ID,
+			"requestedBy": requestedBy,
+		})
+		return nil, ""
+	}
+
+	entry := takeFromLobby(meeting, clientID)
+	if entry == nil {
+		sfuLogger.Warn("KAFKA", "Lobby command for client not waiting in lobby", map[string]interface{}{
+			"commandType": sfuCommand.Type,
+			"clientID":    clientID,
+			"meetingID":   meeting.ID,
+		})
+		return nil, ""
+	}
+	return entry, requestedBy
+}
+
+// sendLobbyRejection tells the signaling server of a waiting client that it will not be admitted
+func sendLobbyRejection(meeting *Meeting, entry *LobbyEntry, reason string) {
+	if entry.options.replyTo == "" {
+		return
+	}
+
+	err := sendKafkaMessage(entry.options.replyTo, meeting.ID, WSMessage{
+		Type:     "sfuCommandRejected",
+		SenderID: sfuID,
+		Payload: map[string]interface{}{
+			"commandType": "clientJoined",
+			"meetingId":   meeting.ID,
+			"clientId":    entry.ClientID,
+			"reason":      reason,
+		},
+	})
+	if err != nil {
+		sfuLogger.Error("KAFKA", "Error sending lobby rejection", err, map[string]interface{}{
+			"clientID":  entry.ClientID,
+			"meetingID": meeting.ID,
+			"replyTo":   entry.options.replyTo,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+	}
+}
+
+// announceLobby tells the meeting who is waiting in the lobby, oldest first
+func announceLobby(meeting *Meeting) {
+	meeting.mu.RLock()
+	entries := make([]*LobbyEntry, 0, len(meeting.lobby))
+	for _, entry := range meeting.lobby {
+		entries = append(entries, entry)
+	}
+	meeting.mu.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].requestedAt.Before(entries[j].requestedAt) })
+	waiting := make([]map[string]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		waiting = append(waiting, map[string]interface{}{
+			"clientId":      entry.ClientID,
+			"role":          entry.options.role,
+			"authenticated": entry.authenticated,
+			"requestedAt":   entry.requestedAt.UnixMilli(),
+		})
+	}
+	sendMeetingEvent(meeting, "lobbyUpdated", map[string]interface{}{
+		"waiting": waiting,
+	})
+}
@@ -28,7 +28,9 @@ var (
 	signalingURL string
 )
 
-func init() {
+// initSFU sets up configuration and every external connection. It runs at the start of
+// main rather than in init so tests can load the package without Redis or Kafka.
+func initSFU() {
 	// Initialize logger first, with a temporary configuration
 	initLogger()
 
@@ -54,6 +56,18 @@ func init() {
 	sfuLogger.Info("INIT", "Initializing Redis connection", nil)
 	initRedis()
 
+	sfuLogger.Info("INIT", "Initializing WebRTC transport", nil)
+	initWebRTC()
+
+	sfuLogger.Info("INIT", "Loading join token keys", nil)
+	initJoinTokens()
+
+	sfuLogger.Info("INIT", "Loading command authentication keys", nil)
+	initCommandAuth()
+
+	sfuLogger.Info("INIT", "Initializing embedded TURN server", nil)
+	initTURN()
+
 	sfuLogger.Info("INIT", "Initializing Kafka connection", nil)
 	initKafka()
 
@@ -65,6 +79,8 @@ func init() {
 }
 
 func main() {
+	initSFU()
+
 	sfuLogger.Info("MAIN", "SFU main function started", map[string]interface{}{
 		"sfuID": sfuID,
 	})
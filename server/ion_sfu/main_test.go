@@ -0,0 +1,21 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+// TestMain loads the configuration and logger the way initSFU does, without
+// connecting to Redis, Kafka or the signaling server.
+func TestMain(m *testing.M) {
+	if os.Getenv("SFU_LOG_LEVEL") == "" {
+		os.Setenv("SFU_LOG_LEVEL", "ERROR")
+	}
+	initLogger()
+	sfuLogger.SetLevel(ERROR)
+	initConfig()
+	reinitLogger()
+	meetings = make(map[string]*Meeting)
+
+	os.Exit(m.Run())
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// Payload types are fixed for audio and handed out from 96 upwards for video
+const (
+	opusPayloadType       = 111
+	redPayloadType        = 63
+	firstVideoPayloadType = 96
+	lastDynamicPayload    = 127
+)
+
+// videoRTCPFeedback is advertised for every video codec
+var videoRTCPFeedback = []webrtc.RTCPFeedback{
+	{Type: "goog-remb"},
+	{Type: "ccm", Parameter: "fir"},
+	{Type: "nack"},
+	{Type: "nack", Parameter: "pli"},
+	{Type: "transport-cc"},
+}
+
+// registeredCodecs keeps the codecs of the media engine in preference order,
+// without RTX entries, so per-meeting preferences can be derived from them
+var registeredCodecs = map[webrtc.RTPCodecType][]webrtc.RTPCodecParameters{}
+
+// rtxCodecs maps the payload type of a video codec to its RTX codec
+var rtxCodecs = map[webrtc.PayloadType]webrtc.RTPCodecParameters{}
+
+// newMediaEngine registers the codecs listed in the configuration
+func newMediaEngine() (*webrtc.MediaEngine, error) {
+	mediaEngine := &webrtc.MediaEngine{}
+
+	for _, name := range C.AudioCodecs {
+		var codec webrtc.RTPCodecParameters
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "opus":
+			codec = webrtc.RTPCodecParameters{
+				RTPCodecCapability: webrtc.RTPCodecCapability{
+					MimeType:     webrtc.MimeTypeOpus,
+					ClockRate:    48000,
+					Channels:     2,
+					SDPFmtpLine:  "minptime=10;useinbandfec=1",
+					RTCPFeedback: []webrtc.RTCPFeedback{{Type: "transport-cc"}},
+				},
+				PayloadType: opusPayloadType,
+			}
+		case "red":
+			// RED carries redundant Opus frames for lossy networks
+			codec = webrtc.RTPCodecParameters{
+				RTPCodecCapability: webrtc.RTPCodecCapability{
+					MimeType:    "audio/red",
+					ClockRate:   48000,
+					Channels:    2,
+					SDPFmtpLine: fmt.Sprintf("%d/%d", opusPayloadType, opusPayloadType),
+				},
+				PayloadType: redPayloadType,
+			}
+		default:
+			return nil, fmt.Errorf("unsupported audio codec %q", name)
+		}
+		if err := registerCodec(mediaEngine, codec, webrtc.RTPCodecTypeAudio); err != nil {
+			return nil, err
+		}
+	}
+
+	payloadType := webrtc.PayloadType(firstVideoPayloadType)
+	nextPayloadType := func() (webrtc.PayloadType, error) {
+		for payloadType == opusPayloadType || payloadType == redPayloadType {
+			payloadType++
+		}
+		if payloadType > lastDynamicPayload {
+			return 0, fmt.Errorf("too many video codecs configured")
+		}
+		pt := payloadType
+		payloadType++
+		return pt, nil
+	}
+
+	for _, name := range C.VideoCodecs {
+		var capabilities []webrtc.RTPCodecCapability
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "vp8":
+			capabilities = append(capabilities, webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000})
+		case "vp9":
+			capabilities = append(capabilities, webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP9, ClockRate: 90000, SDPFmtpLine: "profile-id=0"})
+		case "h264":
+			for _, profile := range C.H264Profiles {
+				capabilities = append(capabilities, webrtc.RTPCodecCapability{
+					MimeType:    webrtc.MimeTypeH264,
+					ClockRate:   90000,
+					SDPFmtpLine: "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=" + strings.TrimSpace(profile),
+				})
+			}
+		case "av1":
+			capabilities = append(capabilities, webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeAV1, ClockRate: 90000})
+		default:
+			return nil, fmt.Errorf("unsupported video codec %q", name)
+		}
+
+		for _, capability := range capabilities {
+			capability.RTCPFeedback = videoRTCPFeedback
+			pt, err := nextPayloadType()
+			if err != nil {
+				return nil, err
+			}
+			codec := webrtc.RTPCodecParameters{RTPCodecCapability: capability, PayloadType: pt}
+			if err := registerCodec(mediaEngine, codec, webrtc.RTPCodecTypeVideo); err != nil {
+				return nil, err
+			}
+
+			if !C.VideoRTX {
+				continue
+			}
+			rtxPT, err := nextPayloadType()
+			if err != nil {
+				return nil, err
+			}
+			rtx := webrtc.RTPCodecParameters{
+				RTPCodecCapability: webrtc.RTPCodecCapability{
+					MimeType:    "video/rtx",
+					ClockRate:   90000,
+					SDPFmtpLine: fmt.Sprintf("apt=%d", pt),
+				},
+				PayloadType: rtxPT,
+			}
+			if err := mediaEngine.RegisterCodec(rtx, webrtc.RTPCodecTypeVideo); err != nil {
+				return nil, fmt.Errorf("registering RTX for %s: %w", capability.MimeType, err)
+			}
+			rtxCodecs[pt] = rtx
+		}
+	}
+
+	// Lets SVC tracks read AV1 (and VP9) layer information without parsing payloads
+	if err := mediaEngine.RegisterHeaderExtension(webrtc.RTPHeaderExtensionCapability{URI: av1DependencyDescriptorURI}, webrtc.RTPCodecTypeVideo); err != nil {
+		return nil, fmt.Errorf("registering dependency descriptor extension: %w", err)
+	}
+
+	if len(registeredCodecs[webrtc.RTPCodecTypeAudio]) == 0 || len(registeredCodecs[webrtc.RTPCodecTypeVideo]) == 0 {
+		return nil, fmt.Errorf("at least one audio and one video codec must be configured")
+	}
+	return mediaEngine, nil
+}
+
+func registerCodec(mediaEngine *webrtc.MediaEngine, codec webrtc.RTPCodecParameters, kind webrtc.RTPCodecType) error {
+	if err := mediaEngine.RegisterCodec(codec, kind); err != nil {
+		return fmt.Errorf("registering %s: %w", codec.MimeType, err)
+	}
+	registeredCodecs[kind] = append(registeredCodecs[kind], codec)
+	return nil
+}
+
+// codecName returns the configuration name of a codec ("opus", "vp8", "h264", ...)
+func codecName(mimeType string) string {
+	if i := strings.Index(mimeType, "/"); i >= 0 {
+		mimeType = mimeType[i+1:]
+	}
+	return strings.ToLower(mimeType)
+}
+
+// codecKey identifies a codec variant a client can decode. H.264 profiles are
+// told apart by the profile part of profile-level-id, as pion matches them.
+func codecKey(mimeType, fmtpLine string) string {
+	key := strings.ToLower(mimeType)
+	if codecName(mimeType) != "h264" {
+		return key
+	}
+	for _, param := range strings.Split(fmtpLine, ";") {
+		name, value, found := strings.Cut(strings.TrimSpace(param), "=")
+		if found && strings.EqualFold(name, "profile-level-id") && len(value) >= 4 {
+			return key + "/" + strings.ToLower(value[:4])
+		}
+	}
+	return key
+}
+
+// parseMeetingCodecs reads the optional codec restriction list of prepareMeeting
+func parseMeetingCodecs(value interface{}) (map[string]bool, error) {
+	names, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("codecs must be a list of codec names")
+	}
+
+	allowed := make(map[string]bool, len(names))
+	for _, entry := range names {
+		name, ok := entry.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid codec name %v", entry)
+		}
+		allowed[codecName(name)] = true
+	}
+
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeAudio, webrtc.RTPCodecTypeVideo} {
+		usable := false
+		for _, codec := range registeredCodecs[kind] {
+			if allowed[codecName(codec.MimeType)] {
+				usable = true
+				break
+			}
+		}
+		if !usable {
+			return nil, fmt.Errorf("no configured %s codec allowed by %v", kind, names)
+		}
+	}
+	return allowed, nil
+}
+
+// recordReceiveCodecs remembers which codecs a client offered, i.e. what it can decode
+func recordReceiveCodecs(meeting *Meeting, clientPeer *ClientPeer) {
+	parsed, err := clientPeer.PeerConnection.RemoteDescription().Unmarshal()
+	if err != nil {
+		sfuLogger.Error("WEBRTC", "Error parsing client SDP for codecs", err, map[string]interface{}{
+			"clientID":  clientPeer.ID,
+			"meetingID": meeting.ID,
+		})
+		return
+	}
+
+	receiveCodecs := make(map[string]bool)
+	for _, media := range parsed.MediaDescriptions {
+		kind := media.MediaName.Media
+		if kind != "audio" && kind != "video" {
+			continue
+		}
+		if _, sendOnly := media.Attribute("sendonly"); sendOnly {
+			continue
+		}
+		for _, format := range media.MediaName.Formats {
+			var payloadType uint8
+			if _, err := fmt.Sscanf(format, "%d", &payloadType); err != nil {
+				continue
+			}
+			codec, err := parsed.GetCodecForPayloadType(payloadType)
+			if err != nil {
+				continue
+			}
+			receiveCodecs[codecKey(kind+"/"+codec.Name, codec.Fmtp)] = true
+		}
+	}
+
+	meeting.mu.Lock()
+	clientPeer.receiveCodecs = receiveCodecs
+	meeting.mu.Unlock()
+}
+
+// meetingCodecPreferences lists the codecs a publisher may use: configured,
+// allowed for the meeting and receivable by every other client in it
+func meetingCodecPreferences(meeting *Meeting, kind webrtc.RTPCodecType, publisherID string) []webrtc.RTPCodecParameters {
+	meeting.mu.RLock()
+	defer meeting.mu.RUnlock()
+
+	var allowed []webrtc.RTPCodecParameters
+	for _, codec := range registeredCodecs[kind] {
+		if meeting.allowedCodecs == nil || meeting.allowedCodecs[codecName(codec.MimeType)] {
+			allowed = append(allowed, codec)
+		}
+	}
+
+	var common []webrtc.RTPCodecParameters
+	for _, codec := range allowed {
+		key := codecKey(codec.MimeType, codec.SDPFmtpLine)
+		receivable := true
+		for clientID, clientPeer := range meeting.clients {
+			if clientID == publisherID || clientPeer.receiveCodecs == nil {
+				continue
+			}
+			if kind == webrtc.RTPCodecTypeVideo && clientPeer.mediaMode == mediaModeAudioOnly {
+				continue
+			}
+			if !clientPeer.receiveCodecs[key] {
+				receivable = false
+				break
+			}
+		}
+		if receivable {
+			common = append(common, codec)
+		}
+	}
+
+	if len(common) == 0 {
+		// Nothing works for everyone; let the publisher pick and affected subscribers miss the track
+		sfuLogger.Warn("WEBRTC", "No codec receivable by every client in meeting", map[string]interface{}{
+			"meetingID":   meeting.ID,
+			"kind":        kind.String(),
+			"publisherID": publisherID,
+		})
+		common = allowed
+	}
+
+	preferences := make([]webrtc.RTPCodecParameters, 0, len(common)*2)
+	for _, codec := range common {
+		preferences = append(preferences, codec)
+		if rtx, ok := rtxCodecs[codec.PayloadType]; ok {
+			preferences = append(preferences, rtx)
+		}
+	}
+	return preferences
+}
+
+// applyCodecPreferences restricts the codecs of a client's transceivers before answering its offer
+func applyCodecPreferences(meeting *Meeting, clientPeer *ClientPeer) {
+	for _, transceiver := range clientPeer.PeerConnection.GetTransceivers() {
+		kind := transceiver.Kind()
+		if kind != webrtc.RTPCodecTypeAudio && kind != webrtc.RTPCodecTypeVideo {
+			continue
+		}
+
+		preferences := meetingCodecPreferences(meeting, kind, clientPeer.ID)
+		if err := transceiver.SetCodecPreferences(preferences); err != nil {
+			sfuLogger.Error("WEBRTC", "Error setting codec preferences", err, map[string]interface{}{
+				"clientID":  clientPeer.ID,
+				"meetingID": meeting.ID,
+				"kind":      kind.String(),
+			})
+			sfuState.IncrementCounters(0, 0, 1)
+		}
+	}
+}
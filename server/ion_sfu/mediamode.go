@@ -0,0 +1,120 @@
+package main
+
+import (
+	"github.com/pion/webrtc/v3"
+)
+
+// Media modes a client can join with or switch to via setMediaMode
+const (
+	mediaModeFull      = "full"
+	mediaModeAudioOnly = "audio-only" // No video transceivers, no video forwarding
+	mediaModeThumbnail = "thumbnail"  // Video at the lowest spatial and temporal layer
+)
+
+// Layers forwarded to thumbnail clients: the base layer at the lowest frame rate
+const (
+	thumbnailSpatialLayer  = 0
+	thumbnailTemporalLayer = 0
+)
+
+// parseMediaMode validates a requested media mode; an empty mode means full
+func parseMediaMode(value interface{}) (string, bool) {
+	mode, _ := value.(string)
+	switch mode {
+	case "":
+		return mediaModeFull, true
+	case mediaModeFull, mediaModeAudioOnly, mediaModeThumbnail:
+		return mode, true
+	default:
+		return "", false
+	}
+}
+
+// applyMediaMode configures a client's video down track for the client's media mode.
+// Thumbnails need temporal layers, so non-SVC video is forwarded unchanged;
+// full mode lifts any layer limits set earlier.
+func applyMediaMode(mode string, downTrack *DownTrack) {
+	if downTrack.Kind() != webrtc.RTPCodecTypeVideo {
+		return
+	}
+
+	switch mode {
+	case mediaModeAudioOnly:
+		downTrack.SetSuspended(true)
+	case mediaModeThumbnail:
+		downTrack.SetSuspended(false)
+		if isScreenShareVideo(downTrack.router) {
+			// Shared screens are unreadable at thumbnail size; keep the resolution, lower the frame rate
+			downTrack.SetLayerLimits(-1, thumbnailTemporalLayer, 0)
+		} else {
+			downTrack.SetLayerLimits(thumbnailSpatialLayer, thumbnailTemporalLayer, 0)
+		}
+	default:
+		downTrack.SetSuspended(false)
+		downTrack.SetLayerLimits(-1, -1, 0)
+	}
+}
+
+// handleSetMediaMode switches a client between full, audio-only and thumbnail video.
+// Payload: clientId, mode.
+func handleSetMediaMode(sfuCommand SFUCommand, meeting *Meeting) {
+	clientID, ok := sfuCommand.Payload["clientId"].(string)
+	if !ok {
+		sfuLogger.Error("KAFKA", "Missing or invalid clientId in setMediaMode command", nil, map[string]interface{}{
+			"payload": sfuCommand.Payload,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return
+	}
+	mode, ok := parseMediaMode(sfuCommand.Payload["mode"])
+	if !ok {
+		sfuLogger.Error("KAFKA", "Invalid mode in setMediaMode command", nil, map[string]interface{}{
+			"clientID": clientID,
+			"payload":  sfuCommand.Payload,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return
+	}
+
+	if forwardToMigrationTarget(sfuCommand, meeting, clientID) {
+		return
+	}
+
+	meeting.mu.Lock()
+	clientPeer, exists := meeting.clients[clientID]
+	previous := ""
+	if exists {
+		previous = clientPeer.mediaMode
+		clientPeer.mediaMode = mode
+	}
+	meeting.mu.Unlock()
+
+	if !exists {
+		sfuLogger.Warn("KAFKA", "setMediaMode for client not in meeting", map[string]interface{}{
+			"clientID":  clientID,
+			"meetingID": meeting.ID,
+		})
+		return
+	}
+
+	meeting.mu.RLock()
+	for trackID, router := range meeting.routers {
+		if router.Kind() != webrtc.RTPCodecTypeVideo || meeting.trackPublishers[trackID] == clientID {
+			continue
+		}
+		if downTrack := router.DownTrack(clientID); downTrack != nil {
+			applyMediaMode(mode, downTrack)
+		} else if mode != mediaModeAudioOnly {
+			// Video published while the client was audio-only was never added to its PeerConnection
+			addTrackToPeer(meeting, clientPeer, router)
+		}
+	}
+	meeting.mu.RUnlock()
+
+	sfuLogger.Info("WEBRTC", "Client media mode changed", map[string]interface{}{
+		"clientID":  clientID,
+		"meetingID": meeting.ID,
+		"previous":  previous,
+		"mode":      mode,
+	})
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const meetingMigrationKeyFormat = "meeting:%s:migration"
+
+func meetingMigrationKey(meetingID string) string {
+	return fmt.Sprintf(meetingMigrationKeyFormat, meetingID)
+}
+
+// handleMigrateMeeting moves a running meeting from this SFU to another one without ending it.
+// The target is prepared as an edge of this SFU and both directions are relayed, so clients
+// that have already moved and clients that have not yet moved keep seeing each other.
+func handleMigrateMeeting(sfuCommand SFUCommand, meeting *Meeting) {
+	targetSFUID, ok := sfuCommand.Payload["targetSfuId"].(string)
+	if !ok || targetSFUID == "" || targetSFUID == sfuID {
+		sfuLogger.Error("MIGRATION", "Missing or invalid targetSfuId in migrateMeeting command", nil, map[string]interface{}{
+			"payload": sfuCommand.Payload,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return
+	}
+
+	meeting.mu.Lock()
+	if !meeting.leaseHeld || meeting.migration != nil {
+		meeting.mu.Unlock()
+		sfuLogger.Warn("MIGRATION", "Meeting cannot be migrated from this SFU", map[string]interface{}{
+			"meetingID":    meeting.ID,
+			"leaseHeld":    meeting.leaseHeld,
+			"alreadyMoved": meeting.migration != nil,
+		})
+		return
+	}
+
+	migration := &MeetingMigration{
+		TargetSFUID:    targetSFUID,
+		StartedAt:      time.Now(),
+		movedClients:   make(map[string]bool),
+		pendingClients: make(map[string]bool),
+		replyTopics:    make(map[string]bool),
+	}
+	clients := make([]*ClientPeer, 0, len(meeting.clients))
+	for clientID, clientPeer := range meeting.clients {
+		migration.movedClients[clientID] = true
+		migration.pendingClients[clientID] = true
+		if clientPeer.ReplyTo != "" {
+			migration.replyTopics[clientPeer.ReplyTo] = true
+		}
+		clients = append(clients, clientPeer)
+	}
+	meeting.migration = migration
+	meeting.status = "migrating"
+	e2ee, lobby := meeting.e2ee, meeting.lobbyEnabled
+	mode := ""
+	if meeting.webinar {
+		mode = meetingModeWebinar
+	}
+	meeting.mu.Unlock()
+
+	sfuLogger.Info("MIGRATION", "Starting meeting migration", map[string]interface{}{
+		"meetingID":   meeting.ID,
+		"targetSFUID": targetSFUID,
+		"clients":     len(clients),
+	})
+
+	if err := writeMigrationSnapshot(meeting, targetSFUID); err != nil {
+		sfuLogger.Error("MIGRATION", "Error writing migration snapshot to Redis", err, map[string]interface{}{
+			"meetingID": meeting.ID,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+	}
+
+	// Prepare the target as an edge of this SFU, then relay tracks in both directions
+	sendSFUCommand(targetSFUID, SFUCommand{
+		Type:    "prepareMeeting",
+		Payload: map[string]interface{}{"meetingId": meeting.ID, "originSfuId": sfuID, "e2ee": e2ee, "lobby": lobby, "mode": mode},
+	})
+	handleStartRelay(SFUCommand{
+		Type:    "startRelay",
+		Payload: map[string]interface{}{"meetingId": meeting.ID, "targetSfuId": targetSFUID},
+	}, meeting)
+	sendSFUCommand(targetSFUID, SFUCommand{
+		Type:    "startRelay",
+		Payload: map[string]interface{}{"meetingId": meeting.ID, "targetSfuId": sfuID},
+	})
+
+	// Move each client: the target sets up a peer, then sfuMigration makes the client open a
+	// new PeerConnection whose offer is forwarded to the target. Media keeps flowing through
+	// this SFU until the target reports the client connected.
+	for _, clientPeer := range clients {
+		moveClientToTarget(meeting, clientPeer, targetSFUID)
+		sendSFUSignalToClient(clientPeer.ID, "sfuMigration", "", nil, meeting.ID, clientPeer.ReplyTo)
+	}
+
+	meeting.mu.Lock()
+	migration.timer = time.AfterFunc(C.MigrationTimeout, func() {
+		finishMigration(meeting, true)
+	})
+	meeting.mu.Unlock()
+
+	if len(clients) == 0 {
+		finishMigration(meeting, false)
+	}
+}
+
+// moveClientToTarget asks the target SFU to create a peer for a client of this meeting
+func moveClientToTarget(meeting *Meeting, clientPeer *ClientPeer, targetSFUID string) {
+	payload := map[string]interface{}{
+		"meetingId":    meeting.ID,
+		"clientId":     clientPeer.ID,
+		"migratedFrom": sfuID,
+		"mediaMode":    clientPeer.mediaMode,
+		"role":         clientPeer.role,
+	}
+	if clientPeer.joinToken != "" {
+		payload["token"] = clientPeer.joinToken
+	}
+
+	sendSFUCommand(targetSFUID, SFUCommand{
+		Type:    "clientJoined",
+		ReplyTo: clientPeer.ReplyTo,
+		Payload: payload,
+	})
+}
+
+// verifiedMigratedFrom returns the SFU a clientJoined moved the client from, or "" for a
+// fresh join. The command must come in an envelope verified as signed by that SFU.
+func verifiedMigratedFrom(sfuCommand SFUCommand) string {
+	migratedFrom, _ := sfuCommand.Payload["migratedFrom"].(string)
+	if migratedFrom == "" || !isSFUIssuer(sfuCommand.issuer) || sfuCommand.issuer != migratedFrom {
+		return ""
+	}
+	return migratedFrom
+}
+
+// forwardToMigrationTarget hands a client command to the target SFU once the client has
+// been moved. It returns true when the command was forwarded and must not be handled here.
+func forwardToMigrationTarget(sfuCommand SFUCommand, meeting *Meeting, clientID string) bool {
+	meeting.mu.Lock()
+	migration := meeting.migration
+	if migration == nil {
+		meeting.mu.Unlock()
+		return false
+	}
+
+	switch sfuCommand.Type {
+	case "clientJoined":
+		// New joiners go straight to the target SFU
+		migration.movedClients[clientID] = true
+		if sfuCommand.ReplyTo != "" {
+			migration.replyTopics[sfuCommand.ReplyTo] = true
+		}
+	case "clientLeft":
+		if !migration.movedClients[clientID] && !migration.completed {
+			meeting.mu.Unlock()
+			return false
+		}
+		delete(migration.pendingClients, clientID)
+	default:
+		if !migration.movedClients[clientID] && !migration.completed {
+			meeting.mu.Unlock()
+			return false
+		}
+	}
+	targetSFUID := migration.TargetSFUID
+	pending := len(migration.pendingClients)
+	meeting.mu.Unlock()
+
+	if sfuCommand.Type == "clientJoined" {
+		// The forward is signed by this SFU, which only vouches for the fields it sets itself
+		sfuCommand = withoutMigrationFields(sfuCommand)
+	}
+
+	sfuLogger.Debug("MIGRATION", "Forwarding client command to migration target", map[string]interface{}{
+		"commandType": sfuCommand.Type,
+		"clientID":    clientID,
+		"meetingID":   meeting.ID,
+		"targetSFUID": targetSFUID,
+	})
+	sendSFUCommand(targetSFUID, sfuCommand)
+
+	if sfuCommand.Type == "clientLeft" {
+		detachMigratedClient(meeting, clientID)
+		if pending == 0 {
+			finishMigration(meeting, false)
+		}
+	}
+	return true
+}
+
+// withoutMigrationFields copies a clientJoined without the fields a signing SFU vouches for
+func withoutMigrationFields(sfuCommand SFUCommand) SFUCommand {
+	payload := make(map[string]interface{}, len(sfuCommand.Payload))
+	for key, value := range sfuCommand.Payload {
+		if key != "migratedFrom" && key != "role" {
+			payload[key] = value
+		}
+	}
+	sfuCommand.Payload = payload
+	return sfuCommand
+}
+
+// handleMigrationClientConnected runs on the source SFU when a moved client is connected to the target
+func handleMigrationClientConnected(sfuCommand SFUCommand, meeting *Meeting) {
+	clientID, ok := sfuCommand.Payload["clientId"].(string)
+	if !ok {
+		sfuLogger.Error("MIGRATION", "Missing or invalid clientId in migrationClientConnected command", nil, map[string]interface{}{
+			"payload": sfuCommand.Payload,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return
+	}
+
+	meeting.mu.Lock()
+	if meeting.migration == nil {
+		meeting.mu.Unlock()
+		return
+	}
+	delete(meeting.migration.pendingClients, clientID)
+	pending := len(meeting.migration.pendingClients)
+	meeting.mu.Unlock()
+
+	sfuLogger.Info("MIGRATION", "Client reconnected to migration target", map[string]interface{}{
+		"clientID":       clientID,
+		"meetingID":      meeting.ID,
+		"pendingClients": pending,
+	})
+
+	detachMigratedClient(meeting, clientID)
+
+	if pending == 0 {
+		finishMigration(meeting, false)
+	}
+}
+
+// detachMigratedClient closes the local peer of a client that now lives on the target SFU
+func detachMigratedClient(meeting *Meeting, clientID string) {
+	meeting.mu.Lock()
+	clientPeer, ok := meeting.clients[clientID]
+	// Remove before closing so the connection state handler does not treat it as a leave
+	delete(meeting.clients, clientID)
+	meeting.mu.Unlock()
+
+	if !ok {
+		return
+	}
+	removeDownTracks(meeting, clientID)
+
+	if err := clientPeer.PeerConnection.Close(); err != nil {
+		sfuLogger.Error("MIGRATION", "Error closing migrated client PeerConnection", err, map[string]interface{}{
+			"clientID":  clientID,
+			"meetingID": meeting.ID,
+		})
+	}
+
+	metricsMu.Lock()
+	sfuMetrics.ConnectedClients--
+	metricsMu.Unlock()
+	sfuState.UpdateMetrics(sfuMetrics.ConnectedClients, sfuMetrics.ActiveMeetings)
+}
+
+// finishMigration hands the meeting lease to the target SFU and tears the meeting down locally.
+// Clients that did not reconnect before the timeout are disconnected.
+func finishMigration(meeting *Meeting, timedOut bool) {
+	meeting.mu.Lock()
+	migration := meeting.migration
+	if migration == nil || migration.completed {
+		meeting.mu.Unlock()
+		return
+	}
+	migration.completed = true
+	if migration.timer != nil {
+		migration.timer.Stop()
+	}
+	remaining := make([]string, 0, len(migration.pendingClients))
+	for clientID := range migration.pendingClients {
+		remaining = append(remaining, clientID)
+	}
+	relays := make([]*RelayPeer, 0, len(meeting.relays))
+	for _, relay := range meeting.relays {
+		relays = append(relays, relay)
+	}
+	meeting.leaseHeld = false
+	meeting.status = "migrated"
+	meeting.mu.Unlock()
+
+	targetSFUID := migration.TargetSFUID
+
+	transferred, err := takeoverLeaseScript.Run(ctx, redisClient, []string{meetingSFUKey(meeting.ID)}, sfuID, targetSFUID, C.MeetingLeaseTTL.Milliseconds()).Int()
+	if err != nil || transferred == 0 {
+		sfuLogger.Error("MIGRATION", "Error transferring meeting lease to target SFU", err, map[string]interface{}{
+			"meetingID":   meeting.ID,
+			"targetSFUID": targetSFUID,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+	}
+
+	sendSFUCommand(targetSFUID, SFUCommand{
+		Type:    "migrationCompleted",
+		Payload: map[string]interface{}{"meetingId": meeting.ID, "sourceSfuId": sfuID},
+	})
+
+	for _, relay := range relays {
+		closeRelay(meeting, relay, true)
+	}
+
+	for _, clientID := range remaining {
+		detachMigratedClient(meeting, clientID)
+	}
+
+	// Let signaling servers route the meeting to the target from now on
+	for replyTo := range migration.replyTopics {
+		sendKafkaMessage(replyTo, meeting.ID, WSMessage{
+			Type:     "meetingMigrated",
+			SenderID: sfuID,
+			Payload: map[string]interface{}{
+				"meetingId":     meeting.ID,
+				"sfuId":         targetSFUID,
+				"previousSfuId": sfuID,
+			},
+		})
+	}
+
+	metricsMu.Lock()
+	sfuMetrics.ActiveMeetings--
+	metricsMu.Unlock()
+	sfuState.UpdateMetrics(sfuMetrics.ConnectedClients, sfuMetrics.ActiveMeetings)
+
+	sfuLogger.Info("MIGRATION", "Meeting migration finished", map[string]interface{}{
+		"meetingID":           meeting.ID,
+		"targetSFUID":         targetSFUID,
+		"timedOut":            timedOut,
+		"disconnectedClients": len(remaining),
+		"duration":            time.Since(migration.StartedAt).String(),
+	})
+}
+
+// handleMigrationCompleted runs on the target SFU once the source has handed over the lease
+func handleMigrationCompleted(sfuCommand SFUCommand, meeting *Meeting) {
+	sourceSFUID, _ := sfuCommand.Payload["sourceSfuId"].(string)
+
+	snapshot, err := readMigrationSnapshot(meeting.ID)
+	if err != nil {
+		sfuLogger.Error("MIGRATION", "Error reading migration snapshot from Redis", err, map[string]interface{}{
+			"meetingID": meeting.ID,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+	}
+
+	meeting.mu.Lock()
+	meeting.leaseHeld = true
+	meeting.originSFUID = ""
+	meeting.status = "active"
+	if snapshot != nil {
+		meeting.createdAt = snapshot.Roster.CreatedAt
+		meeting.maxParticipants = snapshot.Roster.MaxParticipants
+	}
+	meeting.mu.Unlock()
+
+	sfuLogger.Info("MIGRATION", "Meeting migration completed, this SFU now owns the meeting", map[string]interface{}{
+		"meetingID":   meeting.ID,
+		"sourceSFUID": sourceSFUID,
+	})
+
+	publishMeetingRoster(meeting)
+}
+
+// notifyMigrationSource tells the source SFU that a moved client is connected here
+func notifyMigrationSource(meeting *Meeting, clientPeer *ClientPeer) {
+	clientPeer.mu.Lock()
+	sourceSFUID := clientPeer.MigratedFrom
+	clientPeer.MigratedFrom = ""
+	clientPeer.mu.Unlock()
+
+	if sourceSFUID == "" {
+		return
+	}
+
+	sendSFUCommand(sourceSFUID, SFUCommand{
+		Type:    "migrationClientConnected",
+		Payload: map[string]interface{}{"meetingId": meeting.ID, "clientId": clientPeer.ID},
+	})
+}
+
+// isClientMigrating reports whether a client has been moved to another SFU.
+// Caller must hold meeting.mu.
+func isClientMigrating(meeting *Meeting, clientID string) bool {
+	return meeting.migration != nil && meeting.migration.movedClients[clientID]
+}
+
+// writeMigrationSnapshot stores the meeting roster and track metadata for the target SFU
+func writeMigrationSnapshot(meeting *Meeting, targetSFUID string) error {
+	snapshot := MeetingMigrationSnapshot{
+		MeetingID:   meeting.ID,
+		SourceSFUID: sfuID,
+		TargetSFUID: targetSFUID,
+		StartedAt:   time.Now(),
+		Roster:      meetingMetadata(meeting),
+	}
+
+	meeting.mu.RLock()
+	for trackID, router := range meeting.routers {
+		snapshot.Tracks = append(snapshot.Tracks, TrackMetadata{
+			TrackID:     trackID,
+			StreamID:    router.StreamID(),
+			Kind:        router.Kind().String(),
+			MimeType:    router.Codec().MimeType,
+			PublisherID: meeting.trackPublishers[trackID],
+			Source:      router.Source(),
+		})
+	}
+	meeting.mu.RUnlock()
+
+	snapshotJSON, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	return redisClient.Set(ctx, meetingMigrationKey(meeting.ID), snapshotJSON, 2*C.MigrationTimeout).Err()
+}
+
+// readMigrationSnapshot loads the snapshot written by the source SFU
+func readMigrationSnapshot(meetingID string) (*MeetingMigrationSnapshot, error) {
+	snapshotJSON, err := redisClient.Get(ctx, meetingMigrationKey(meetingID)).Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot MeetingMigrationSnapshot
+	if err := json.Unmarshal(snapshotJSON, &snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
@@ -0,0 +1,491 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+	"github.com/pion/webrtc/v3/pkg/media/ivfreader"
+	"github.com/pion/webrtc/v3/pkg/media/oggreader"
+)
+
+// Playback plays a media file from PlaybackDir into a meeting as the track of a synthetic
+// participant, e.g. hold music or a welcome message. Samples are paced in real time into a
+// TrackLocalStaticSample whose packets feed a TrackRouter, so the track reaches clients,
+// relays and egresses like any published track.
+// OGG files must hold Opus with one packet per page (ffmpeg -page_duration 20000); IVF files
+// hold VP8, VP9 or AV1. Video cannot produce keyframes on request, so clients joining during
+// playback see video from the next keyframe in the file.
+type Playback struct {
+	ID            string
+	MeetingID     string
+	ParticipantID string // Publisher ID of the played track
+	ReplyTo       string // Kafka topic playback status is reported to
+	File          string // Path relative to PlaybackDir
+	Loop          bool
+	router        *TrackRouter
+	track         *webrtc.TrackLocalStaticSample
+	startedAt     time.Time
+	stop          chan struct{}
+	stopOnce      sync.Once
+	status        string // Final status, set under meeting.mu when the playback is removed
+}
+
+// routerWriter feeds the packets of a TrackLocalStaticSample into a router
+type routerWriter struct {
+	router *TrackRouter
+}
+
+func (w *routerWriter) WriteRTP(header *rtp.Header, payload []byte) (int, error) {
+	packet := rtp.Packet{Header: *header, Payload: payload}
+	fp := getForwardPacket()
+	defer fp.release()
+
+	n, err := packet.MarshalTo(fp.buf[:])
+	if err != nil {
+		return 0, err
+	}
+	if err := fp.packet.Unmarshal(fp.buf[:n]); err != nil {
+		return 0, err
+	}
+	w.router.WriteRTP(fp)
+	return n, nil
+}
+
+func (w *routerWriter) Write(b []byte) (int, error) {
+	var header rtp.Header
+	n, err := header.Unmarshal(b)
+	if err != nil {
+		return 0, err
+	}
+	return w.WriteRTP(&header, b[n:])
+}
+
+// routerBinding binds a TrackLocalStaticSample to a router instead of a PeerConnection
+type routerBinding struct {
+	id     string
+	codec  webrtc.RTPCodecParameters
+	ssrc   webrtc.SSRC
+	writer *routerWriter
+}
+
+func (b *routerBinding) CodecParameters() []webrtc.RTPCodecParameters {
+	return []webrtc.RTPCodecParameters{b.codec}
+}
+
+func (b *routerBinding) HeaderExtensions() []webrtc.RTPHeaderExtensionParameter { return nil }
+
+func (b *routerBinding) SSRC() webrtc.SSRC { return b.ssrc }
+
+func (b *routerBinding) WriteStream() webrtc.TrackLocalWriter { return b.writer }
+
+func (b *routerBinding) ID() string { return b.id }
+
+func (b *routerBinding) RTCPReader() interceptor.RTCPReader { return nil }
+
+// mediaFileReader reads the samples of an OGG/Opus or IVF file
+type mediaFileReader struct {
+	file  *os.File
+	codec string // Configuration name of the file's codec
+
+	ogg         *oggreader.OggReader
+	lastGranule uint64
+
+	ivf           *ivfreader.IVFReader
+	timebase      float64 // Seconds per IVF timestamp unit
+	lastTimestamp uint64
+}
+
+func openMediaFile(path string) (*mediaFileReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	reader := &mediaFileReader{file: file}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ogg", ".opus":
+		reader.codec = "opus"
+		reader.ogg, _, err = oggreader.NewWith(file)
+	case ".ivf":
+		var header *ivfreader.IVFFileHeader
+		reader.ivf, header, err = ivfreader.NewWith(file)
+		if err == nil {
+			switch header.FourCC {
+			case "VP80":
+				reader.codec = "vp8"
+			case "VP90":
+				reader.codec = "vp9"
+			case "AV01":
+				reader.codec = "av1"
+			default:
+				err = errors.New("unsupported IVF codec " + header.FourCC)
+			}
+			if header.TimebaseDenominator > 0 {
+				reader.timebase = float64(header.TimebaseNumerator) / float64(header.TimebaseDenominator)
+			}
+		}
+	default:
+		err = errors.New("unsupported media file type, expected .ogg, .opus or .ivf")
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return reader, nil
+}
+
+// nextSample returns the next sample of the file, or io.EOF
+func (r *mediaFileReader) nextSample() (media.Sample, error) {
+	if r.ogg != nil {
+		for {
+			page, header, err := r.ogg.ParseNextPage()
+			if err != nil {
+				return media.Sample{}, err
+			}
+			if bytes.HasPrefix(page, []byte("OpusTags")) || header.GranulePosition <= r.lastGranule {
+				continue
+			}
+			samples := header.GranulePosition - r.lastGranule
+			r.lastGranule = header.GranulePosition
+			return media.Sample{Data: page, Duration: time.Duration(samples) * time.Second / 48000}, nil
+		}
+	}
+
+	frame, header, err := r.ivf.ParseNextFrame()
+	if err != nil {
+		return media.Sample{}, err
+	}
+	// IVF frames carry timestamps; the gap to the previous frame paces this one
+	ticks := header.Timestamp - r.lastTimestamp
+	if ticks == 0 || header.Timestamp < r.lastTimestamp {
+		ticks = 1
+	}
+	r.lastTimestamp = header.Timestamp
+	return media.Sample{Data: frame, Duration: time.Duration(float64(ticks) * r.timebase * float64(time.Second))}, nil
+}
+
+func (r *mediaFileReader) Close() error {
+	return r.file.Close()
+}
+
+// handlePlayMedia starts playing a media file into the meeting.
+// Payload: file (relative to PlaybackDir), optional loop, playbackId, participantId, trackId,
+// streamId and requestedBy (must be a host).
+func handlePlayMedia(sfuCommand SFUCommand, meeting *Meeting) {
+	name, _ := sfuCommand.Payload["file"].(string)
+	requestedBy, _ := sfuCommand.Payload["requestedBy"].(string)
+	loop, _ := sfuCommand.Payload["loop"].(bool)
+
+	playbackID, _ := sfuCommand.Payload["playbackId"].(string)
+	if playbackID == "" {
+		playbackID = uuid.New().String()
+	}
+	playback := &Playback{
+		ID:        playbackID,
+		MeetingID: meeting.ID,
+		ReplyTo:   sfuCommand.ReplyTo,
+		File:      name,
+		Loop:      loop,
+		startedAt: time.Now(),
+		stop:      make(chan struct{}),
+	}
+
+	meeting.mu.RLock()
+	authorized := mayManageMeeting(meeting, requestedBy)
+	meeting.mu.RUnlock()
+	if !authorized {
+		failPlayback(playback, "Playback requested by a participant who may not manage the meeting", errors.New("not allowed"))
+		return
+	}
+	if C.PlaybackDir == "" {
+		failPlayback(playback, "Media playback is disabled", errors.New("playback disabled"))
+		return
+	}
+	if !filepath.IsLocal(name) {
+		failPlayback(playback, "Invalid media file in playMedia command", errors.New("invalid file name: "+name))
+		return
+	}
+
+	reader, err := openMediaFile(filepath.Join(C.PlaybackDir, name))
+	if err != nil {
+		failPlayback(playback, "Error opening media file", err)
+		return
+	}
+	kind, capability, ok := meetingCodec(meeting, reader.codec)
+	if !ok {
+		reader.Close()
+		failPlayback(playback, "Codec not available for playback", errors.New("codec not configured or not allowed in this meeting: "+reader.codec))
+		return
+	}
+
+	playback.ParticipantID, _ = sfuCommand.Payload["participantId"].(string)
+	if playback.ParticipantID == "" {
+		playback.ParticipantID = "playback:" + playbackID
+	}
+	trackID, _ := sfuCommand.Payload["trackId"].(string)
+	if trackID == "" {
+		trackID = uuid.New().String()
+	}
+	streamID, _ := sfuCommand.Payload["streamId"].(string)
+	if streamID == "" {
+		streamID = playback.ParticipantID
+	}
+
+	track, err := webrtc.NewTrackLocalStaticSample(capability, trackID, streamID)
+	if err == nil {
+		playback.router = newRouter(trackID, streamID, kind, capability, false, defaultTrackSource(kind, streamID, trackID))
+		_, err = track.Bind(&routerBinding{
+			id:     playbackID,
+			codec:  webrtc.RTPCodecParameters{RTPCodecCapability: capability, PayloadType: egressPayloadType(kind)},
+			ssrc:   webrtc.SSRC(rand.Uint32()),
+			writer: &routerWriter{router: playback.router},
+		})
+	}
+	if err != nil {
+		reader.Close()
+		failPlayback(playback, "Error creating playback track", err)
+		return
+	}
+	playback.track = track
+
+	meeting.mu.Lock()
+	var refused error
+	if _, exists := meeting.playbacks[playbackID]; exists {
+		refused = errors.New("playback already running")
+	} else if _, exists := meeting.routers[trackID]; exists {
+		refused = errors.New("track already published: " + trackID)
+	} else if meeting.e2ee {
+		// Clients would fail to decrypt the played frames
+		refused = errors.New("meeting is end-to-end encrypted")
+	}
+	if refused == nil {
+		meeting.playbacks[playbackID] = playback
+		meeting.routers[trackID] = playback.router
+		meeting.trackPublishers[trackID] = playback.ParticipantID
+	}
+	meeting.mu.Unlock()
+
+	if refused != nil {
+		reader.Close()
+		failPlayback(playback, "Playback refused", refused)
+		return
+	}
+
+	playback.router.attachSource(playback.ParticipantID, nil, nil)
+	routeToSubscribers(meeting, playback.router, playback.ParticipantID)
+	publishLifecycleEvent(meeting.ID, "trackPublished", trackEventData(playback.router, playback.ParticipantID))
+
+	sfuLogger.Info("PLAYBACK", "Media playback started", map[string]interface{}{
+		"playbackID":    playbackID,
+		"meetingID":     meeting.ID,
+		"participantID": playback.ParticipantID,
+		"trackID":       trackID,
+		"file":          name,
+		"codec":         capability.MimeType,
+		"loop":          loop,
+		"requestedBy":   requestedBy,
+	})
+	sendPlaybackStatus(playback, "started", nil)
+
+	go playback.play(meeting, reader)
+}
+
+// handleStopMedia stops a playback and unpublishes its track.
+// Payload: playbackId, optional requestedBy (must be a host).
+func handleStopMedia(sfuCommand SFUCommand, meeting *Meeting) {
+	playbackID, _ := sfuCommand.Payload["playbackId"].(string)
+	requestedBy, _ := sfuCommand.Payload["requestedBy"].(string)
+
+	meeting.mu.RLock()
+	playback, ok := meeting.playbacks[playbackID]
+	authorized := mayManageMeeting(meeting, requestedBy)
+	meeting.mu.RUnlock()
+	if !ok || !authorized {
+		sfuLogger.Warn("PLAYBACK", "Ignoring stopMedia command", map[string]interface{}{
+			"playbackID":  playbackID,
+			"meetingID":   meeting.ID,
+			"requestedBy": requestedBy,
+			"found":       ok,
+			"authorized":  authorized,
+		})
+		return
+	}
+
+	if sfuCommand.ReplyTo != "" {
+		playback.ReplyTo = sfuCommand.ReplyTo
+	}
+	stopPlayback(meeting, playback, "stopped")
+}
+
+// stopPlayback ends a playback; its play loop then unpublishes the track
+func stopPlayback(meeting *Meeting, playback *Playback, status string) {
+	meeting.mu.Lock()
+	_, exists := meeting.playbacks[playback.ID]
+	if exists {
+		delete(meeting.playbacks, playback.ID)
+		playback.status = status
+	}
+	meeting.mu.Unlock()
+
+	if exists {
+		playback.stopOnce.Do(func() { close(playback.stop) })
+	}
+}
+
+// stopMeetingPlaybacks stops every playback of a meeting
+func stopMeetingPlaybacks(meeting *Meeting) {
+	meeting.mu.RLock()
+	playbacks := make([]*Playback, 0, len(meeting.playbacks))
+	for _, playback := range meeting.playbacks {
+		playbacks = append(playbacks, playback)
+	}
+	meeting.mu.RUnlock()
+
+	for _, playback := range playbacks {
+		stopPlayback(meeting, playback, "stopped")
+	}
+}
+
+// play writes the file's samples in real time until it ends, fails or is stopped
+func (playback *Playback) play(meeting *Meeting, reader *mediaFileReader) {
+	path := filepath.Join(C.PlaybackDir, playback.File)
+	status, samples := "finished", 0
+	var cause error
+	next := time.Now()
+
+	defer func() { reader.Close() }()
+playing:
+	for {
+		sample, err := reader.nextSample()
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			if !playback.Loop {
+				break
+			}
+			if samples == 0 {
+				status, cause = "failed", errors.New("media file has no samples")
+				break
+			}
+			// Start the file over; the track's timestamps continue
+			reopened, err := openMediaFile(path)
+			if err != nil {
+				status, cause = "failed", err
+				break
+			}
+			reader.Close()
+			reader, samples = reopened, 0
+			continue
+		}
+		if err != nil {
+			status, cause = "failed", err
+			break
+		}
+
+		if err := playback.track.WriteSample(sample); err != nil {
+			sfuLogger.Debug("PLAYBACK", "Error writing playback sample", map[string]interface{}{
+				"playbackID": playback.ID,
+				"error":      err.Error(),
+			})
+		}
+		samples++
+
+		next = next.Add(sample.Duration)
+		select {
+		case <-playback.stop:
+			break playing
+		case <-time.After(time.Until(next)):
+		}
+	}
+
+	// Stopped playbacks already left the meeting's playbacks; anything else ended on its own
+	trackID := playback.router.ID()
+	meeting.mu.Lock()
+	if _, running := meeting.playbacks[playback.ID]; running {
+		delete(meeting.playbacks, playback.ID)
+		playback.status = status
+	} else {
+		cause = nil
+	}
+	status = playback.status
+	unpublished := meeting.routers[trackID] == playback.router
+	if unpublished {
+		delete(meeting.routers, trackID)
+		delete(meeting.trackPublishers, trackID)
+	}
+	meeting.mu.Unlock()
+
+	if unpublished {
+		playback.router.Close()
+		removeTrackFromRelays(meeting, trackID)
+		publishLifecycleEvent(meeting.ID, "trackUnpublished", trackEventData(playback.router, playback.ParticipantID))
+	}
+
+	sfuLogger.Info("PLAYBACK", "Media playback ended", map[string]interface{}{
+		"playbackID": playback.ID,
+		"meetingID":  meeting.ID,
+		"trackID":    trackID,
+		"status":     status,
+		"duration":   time.Since(playback.startedAt).Round(time.Second).String(),
+	})
+	sendPlaybackStatus(playback, status, cause)
+}
+
+// failPlayback logs a playback that could not start and reports it to the requester
+func failPlayback(playback *Playback, message string, cause error) {
+	sfuLogger.Error("PLAYBACK", message, cause, map[string]interface{}{
+		"playbackID": playback.ID,
+		"meetingID":  playback.MeetingID,
+		"file":       playback.File,
+	})
+	sfuState.IncrementCounters(0, 0, 1)
+	sendPlaybackStatus(playback, "failed", cause)
+}
+
+// sendPlaybackStatus reports a playback's state to its reply topic
+func sendPlaybackStatus(playback *Playback, status string, cause error) {
+	if playback.ReplyTo == "" {
+		return
+	}
+
+	payload := map[string]interface{}{
+		"playbackId":    playback.ID,
+		"meetingId":     playback.MeetingID,
+		"participantId": playback.ParticipantID,
+		"file":          playback.File,
+		"loop":          playback.Loop,
+		"status":        status,
+		"startedAt":     playback.startedAt.UnixMilli(),
+	}
+	if playback.router != nil {
+		payload["trackId"] = playback.router.ID()
+		payload["streamId"] = playback.router.StreamID()
+		payload["kind"] = playback.router.Kind().String()
+		payload["codec"] = strings.ToLower(playback.router.Codec().MimeType)
+	}
+	if cause != nil {
+		payload["error"] = cause.Error()
+	}
+
+	if err := sendKafkaMessage(playback.ReplyTo, playback.MeetingID, WSMessage{
+		Type:     "playbackStatus",
+		SenderID: sfuID,
+		Payload:  payload,
+	}); err != nil {
+		sfuLogger.Error("PLAYBACK", "Error sending playback status", err, map[string]interface{}{
+			"playbackID": playback.ID,
+			"replyTo":    playback.ReplyTo,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// startReconnectGrace gives a disconnected or failed client time to recover before it is evicted.
+// The ClientPeer and its transceivers stay in the meeting meanwhile, so subscriptions survive.
+func startReconnectGrace(meeting *Meeting, clientPeer *ClientPeer) {
+	clientPeer.mu.Lock()
+	defer clientPeer.mu.Unlock()
+
+	if clientPeer.reconnectTimer != nil {
+		return
+	}
+
+	sfuLogger.Warn("WEBRTC", "Client connection interrupted, waiting for reconnection", map[string]interface{}{
+		"clientID":    clientPeer.ID,
+		"meetingID":   meeting.ID,
+		"gracePeriod": C.ReconnectGracePeriod.String(),
+	})
+
+	clientPeer.reconnectTimer = time.AfterFunc(C.ReconnectGracePeriod, func() {
+		if clientPeer.PeerConnection.ConnectionState() == webrtc.PeerConnectionStateConnected {
+			return
+		}
+
+		sfuLogger.Warn("WEBRTC", "Reconnection grace period expired, evicting client", map[string]interface{}{
+			"clientID":  clientPeer.ID,
+			"meetingID": meeting.ID,
+			"state":     clientPeer.PeerConnection.ConnectionState().String(),
+		})
+		evictClient(meeting, clientPeer.ID, "reconnect_timeout")
+
+		if err := clientPeer.PeerConnection.Close(); err != nil {
+			sfuLogger.Error("WEBRTC", "Error closing PeerConnection after grace period", err, map[string]interface{}{
+				"clientID":  clientPeer.ID,
+				"meetingID": meeting.ID,
+			})
+		}
+	})
+}
+
+// cancelReconnectGrace stops the eviction timer once the client is connected again
+func cancelReconnectGrace(clientPeer *ClientPeer) {
+	clientPeer.mu.Lock()
+	defer clientPeer.mu.Unlock()
+
+	if clientPeer.reconnectTimer == nil {
+		return
+	}
+
+	clientPeer.reconnectTimer.Stop()
+	clientPeer.reconnectTimer = nil
+	clientPeer.iceRestarts = 0
+
+	sfuLogger.Info("WEBRTC", "Client reconnected within grace period", map[string]interface{}{
+		"clientID":  clientPeer.ID,
+		"meetingID": clientPeer.MeetingID,
+	})
+}
+
+// restartClientICE sends an ICE restart offer to the client (SFU-initiated restart)
+func restartClientICE(meeting *Meeting, clientPeer *ClientPeer) {
+	clientPeer.mu.Lock()
+	defer clientPeer.mu.Unlock()
+
+	pc := clientPeer.PeerConnection
+	if pc.ConnectionState() == webrtc.PeerConnectionStateClosed {
+		return
+	}
+
+	if clientPeer.iceRestarts >= C.MaxICERestarts {
+		sfuLogger.Warn("WEBRTC", "Maximum ICE restarts reached, waiting for grace period", map[string]interface{}{
+			"clientID":    clientPeer.ID,
+			"meetingID":   meeting.ID,
+			"iceRestarts": clientPeer.iceRestarts,
+		})
+		return
+	}
+
+	if pc.SignalingState() != webrtc.SignalingStateStable {
+		// A negotiation is in flight; the client may restart ICE itself with its next offer
+		sfuLogger.Debug("WEBRTC", "Skipping ICE restart while negotiation is in progress", map[string]interface{}{
+			"clientID":       clientPeer.ID,
+			"meetingID":      meeting.ID,
+			"signalingState": pc.SignalingState().String(),
+		})
+		return
+	}
+
+	offer, err := pc.CreateOffer(&webrtc.OfferOptions{ICERestart: true})
+	if err != nil {
+		sfuLogger.Error("WEBRTC", "Error creating ICE restart offer", err, map[string]interface{}{
+			"clientID":  clientPeer.ID,
+			"meetingID": meeting.ID,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return
+	}
+
+	if err := pc.SetLocalDescription(offer); err != nil {
+		sfuLogger.Error("WEBRTC", "Error setting ICE restart local description", err, map[string]interface{}{
+			"clientID":  clientPeer.ID,
+			"meetingID": meeting.ID,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return
+	}
+	clientPeer.iceRestarts++
+
+	sendSFUSignalToClient(clientPeer.ID, "offer", offer.SDP, nil, meeting.ID, clientPeer.ReplyTo)
+	sfuLogger.Info("WEBRTC", "Sent ICE restart offer to client", map[string]interface{}{
+		"clientID":    clientPeer.ID,
+		"meetingID":   meeting.ID,
+		"iceRestarts": clientPeer.iceRestarts,
+	})
+}
+
+// handleICERestartSignal serves a client's request for an SFU-initiated ICE restart.
+// Clients can also restart ICE themselves by sending an offer with new ICE credentials.
+func handleICERestartSignal(sfuCommand SFUCommand, meeting *Meeting, peer *ClientPeer) {
+	peer.mu.Lock()
+	if sfuCommand.ReplyTo != "" {
+		peer.ReplyTo = sfuCommand.ReplyTo
+	}
+	peer.iceRestarts = 0
+	peer.mu.Unlock()
+
+	sfuLogger.Info("WEBRTC", "Client requested ICE restart", map[string]interface{}{
+		"clientID":  peer.ID,
+		"meetingID": meeting.ID,
+	})
+	restartClientICE(meeting, peer)
+}
+
+// evictClient removes a client from the meeting after it left or could not reconnect
+func evictClient(meeting *Meeting, clientID string, reason string) {
+	meeting.mu.Lock()
+	clientPeer, ok := meeting.clients[clientID]
+	if !ok {
+		meeting.mu.Unlock()
+		return
+	}
+	delete(meeting.clients, clientID)
+	remaining := len(meeting.clients)
+
+	sfuLogger.Info("WEBRTC", "Client removed from meeting", map[string]interface{}{
+		"clientID":         clientID,
+		"meetingID":        meeting.ID,
+		"remainingClients": remaining,
+		"reason":           reason,
+	})
+
+	metricsMu.Lock()
+	sfuMetrics.ConnectedClients--
+	if remaining == 0 {
+		sfuMetrics.ActiveMeetings--
+		sfuLogger.Info("WEBRTC", "Meeting became empty", map[string]interface{}{
+			"meetingID":      meeting.ID,
+			"activeMeetings": sfuMetrics.ActiveMeetings,
+		})
+	}
+	metricsMu.Unlock()
+	meeting.mu.Unlock()
+
+	sfuState.UpdateMetrics(sfuMetrics.ConnectedClients, sfuMetrics.ActiveMeetings)
+	removeDownTracks(meeting, clientID)
+
+	clientPeer.mu.Lock()
+	if clientPeer.reconnectTimer != nil {
+		clientPeer.reconnectTimer.Stop()
+		clientPeer.reconnectTimer = nil
+	}
+	clientPeer.mu.Unlock()
+
+	publishParticipantLeft(meeting, clientPeer, reason)
+	if remaining == 0 {
+		publishMeetingClosed(meeting)
+		releaseMeetingClaim(meeting)
+	} else {
+		publishMeetingRoster(meeting)
+	}
+}
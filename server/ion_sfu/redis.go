@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -89,12 +90,22 @@ func sendHeartbeats() {
 		sfuMetrics.LastHeartbeat = time.Now().UnixMilli()
 		currentMetrics := sfuMetrics // Copy for sending
 		metricsMu.Unlock()
+		collectTURNMetrics(&currentMetrics)
+		currentMetrics.CommandsRejected = atomic.LoadInt64(&commandsRejected)
+		viewers, webinarViewers := webinarViewerCounts()
+		currentMetrics.Viewers = viewers
 
 		// Update metrics in Redis Cluster
 		err := redisClient.HMSet(ctx, fmt.Sprintf("sfu:%s:metrics", sfuID),
 			"connected_clients", currentMetrics.ConnectedClients,
 			"active_meetings", currentMetrics.ActiveMeetings,
 			"last_heartbeat", currentMetrics.LastHeartbeat,
+			"turn_active_allocations", currentMetrics.TURNActiveAllocations,
+			"turn_total_allocations", currentMetrics.TURNTotalAllocations,
+			"turn_auth_failures", currentMetrics.TURNAuthFailures,
+			"turn_bytes_relayed", currentMetrics.TURNBytesRelayed,
+			"commands_rejected", currentMetrics.CommandsRejected,
+			"viewers", currentMetrics.Viewers,
 		).Err()
 		if err != nil {
 			sfuLogger.Error("HEARTBEAT", "Error sending heartbeat to Redis Cluster", err, map[string]interface{}{
@@ -108,8 +119,9 @@ func sendHeartbeats() {
 		heartbeatMsg := WSMessage{
 			Type: "sfuHeartbeat",
 			Payload: map[string]interface{}{
-				"sfuId":   sfuID,
-				"metrics": currentMetrics,
+				"sfuId":          sfuID,
+				"metrics":        currentMetrics,
+				"webinarViewers": webinarViewers, // Map<meetingId, viewers> for spreading viewers over edges
 			},
 		}
 		heartbeatJSON, _ := json.Marshal(heartbeatMsg)
@@ -122,6 +134,9 @@ func sendHeartbeats() {
 			sfuState.IncrementCounters(0, 0, 1)
 		}
 
+		// Keep meeting ownership leases and rosters alive while we host them
+		renewMeetingLeases()
+
 		sfuState.UpdateHeartbeat()
 		// sfuLogger.Debug("HEARTBEAT", "Heartbeat sent successfully", map[string]interface{}{
 		// 	"sfuID":            sfuID,
@@ -0,0 +1,551 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/google/uuid"
+	"github.com/pion/webrtc/v3"
+)
+
+// handleStartRelay opens an outbound relay from this (origin) SFU to another SFU
+func handleStartRelay(sfuCommand SFUCommand, meeting *Meeting) {
+	targetSFUID, ok := sfuCommand.Payload["targetSfuId"].(string)
+	if !ok || targetSFUID == "" || targetSFUID == sfuID {
+		sfuLogger.Error("RELAY", "Missing or invalid targetSfuId in startRelay command", nil, map[string]interface{}{
+			"payload": sfuCommand.Payload,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return
+	}
+
+	relay := &RelayPeer{
+		ID:             uuid.New().String(),
+		MeetingID:      meeting.ID,
+		RemoteSFUID:    targetSFUID,
+		Outbound:       true,
+		selectedTracks: make(map[string]bool),
+		senders:        make(map[string]*webrtc.RTPSender),
+	}
+
+	if trackIDs, ok := sfuCommand.Payload["trackIds"].([]interface{}); ok && len(trackIDs) > 0 {
+		for _, trackID := range trackIDs {
+			if id, ok := trackID.(string); ok {
+				relay.selectedTracks[id] = true
+			}
+		}
+	} else {
+		relay.forwardAll = true
+	}
+
+	sfuLogger.Info("RELAY", "Starting outbound relay", map[string]interface{}{
+		"relayID":        relay.ID,
+		"meetingID":      meeting.ID,
+		"targetSFUID":    targetSFUID,
+		"forwardAll":     relay.forwardAll,
+		"selectedTracks": len(relay.selectedTracks),
+	})
+
+	if err := newRelayPeerConnection(meeting, relay); err != nil {
+		return
+	}
+
+	meeting.mu.Lock()
+	meeting.relays[relay.ID] = relay
+	routers := make([]*TrackRouter, 0, len(meeting.routers))
+	for trackID, router := range meeting.routers {
+		if relayWantsTrack(meeting, relay, trackID) {
+			routers = append(routers, router)
+		}
+	}
+	meeting.mu.Unlock()
+
+	for _, router := range routers {
+		addTrackToRelay(relay, router)
+	}
+
+	negotiateRelay(relay)
+}
+
+// handleStopRelay closes a relay and tells the remote SFU to do the same
+func handleStopRelay(sfuCommand SFUCommand, meeting *Meeting) {
+	relay := lookupRelay(sfuCommand, meeting)
+	if relay == nil {
+		return
+	}
+	closeRelay(meeting, relay, true)
+}
+
+// handleRelayClosed tears down a relay that the remote SFU has closed
+func handleRelayClosed(sfuCommand SFUCommand, meeting *Meeting) {
+	relay := lookupRelay(sfuCommand, meeting)
+	if relay == nil {
+		return
+	}
+	closeRelay(meeting, relay, false)
+}
+
+// handleRelayOffer answers an offer from an origin SFU, creating the inbound relay on first use
+func handleRelayOffer(sfuCommand SFUCommand, meeting *Meeting) {
+	relayID, _ := sfuCommand.Payload["relayId"].(string)
+	originSFUID, _ := sfuCommand.Payload["originSfuId"].(string)
+	sdpStr, _ := sfuCommand.Payload["sdp"].(string)
+	if relayID == "" || originSFUID == "" || sdpStr == "" {
+		sfuLogger.Error("RELAY", "Missing relayId, originSfuId or sdp in relayOffer command", nil, map[string]interface{}{
+			"payload": sfuCommand.Payload,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return
+	}
+
+	// Edges must not parse payloads the origin's clients encrypt, and serve webinar viewers like the origin
+	applyMeetingE2EE(sfuCommand, meeting)
+	applyMeetingMode(sfuCommand, meeting)
+
+	meeting.mu.Lock()
+	relay, exists := meeting.relays[relayID]
+	if !meeting.leaseHeld && meeting.originSFUID == "" {
+		// Clients assigned to this SFU for the meeting are served as an edge of the origin
+		meeting.originSFUID = originSFUID
+	}
+	for trackID, source := range parseTrackSources(sfuCommand.Payload["trackSources"]) {
+		meeting.relayedSources[trackID] = source
+	}
+	meeting.mu.Unlock()
+
+	if !exists {
+		relay = &RelayPeer{
+			ID:          relayID,
+			MeetingID:   meeting.ID,
+			RemoteSFUID: originSFUID,
+			Outbound:    false,
+		}
+		if err := newRelayPeerConnection(meeting, relay); err != nil {
+			return
+		}
+
+		meeting.mu.Lock()
+		meeting.relays[relayID] = relay
+		meeting.mu.Unlock()
+
+		sfuLogger.Info("RELAY", "Accepted inbound relay", map[string]interface{}{
+			"relayID":     relayID,
+			"meetingID":   meeting.ID,
+			"originSFUID": originSFUID,
+		})
+	}
+
+	relay.mu.Lock()
+	defer relay.mu.Unlock()
+
+	offer := webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: sdpStr}
+	if err := relay.PeerConnection.SetRemoteDescription(offer); err != nil {
+		sfuLogger.Error("RELAY", "Error setting relay remote description", err, map[string]interface{}{
+			"relayID":   relayID,
+			"meetingID": meeting.ID,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return
+	}
+	addPendingRelayCandidates(relay)
+
+	answer, err := relay.PeerConnection.CreateAnswer(nil)
+	if err != nil {
+		sfuLogger.Error("RELAY", "Error creating relay answer", err, map[string]interface{}{
+			"relayID":   relayID,
+			"meetingID": meeting.ID,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return
+	}
+
+	if err := relay.PeerConnection.SetLocalDescription(answer); err != nil {
+		sfuLogger.Error("RELAY", "Error setting relay local description", err, map[string]interface{}{
+			"relayID":   relayID,
+			"meetingID": meeting.ID,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return
+	}
+
+	sendSFUCommand(relay.RemoteSFUID, SFUCommand{
+		Type: "relayAnswer",
+		Payload: map[string]interface{}{
+			"meetingId": meeting.ID,
+			"relayId":   relayID,
+			"sdp":       answer.SDP,
+		},
+	})
+}
+
+// handleRelayAnswer completes a negotiation started by this (origin) SFU
+func handleRelayAnswer(sfuCommand SFUCommand, meeting *Meeting) {
+	relay := lookupRelay(sfuCommand, meeting)
+	if relay == nil {
+		return
+	}
+
+	sdpStr, ok := sfuCommand.Payload["sdp"].(string)
+	if !ok {
+		sfuLogger.Error("RELAY", "Missing or invalid sdp in relayAnswer command", nil, map[string]interface{}{
+			"payload": sfuCommand.Payload,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return
+	}
+
+	relay.mu.Lock()
+	answer := webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: sdpStr}
+	if err := relay.PeerConnection.SetRemoteDescription(answer); err != nil {
+		sfuLogger.Error("RELAY", "Error setting relay remote description", err, map[string]interface{}{
+			"relayID":   relay.ID,
+			"meetingID": meeting.ID,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+	}
+	addPendingRelayCandidates(relay)
+	relay.negotiating = false
+	renegotiate := relay.renegotiate
+	relay.renegotiate = false
+	relay.mu.Unlock()
+
+	sfuLogger.Debug("RELAY", "Relay negotiation completed", map[string]interface{}{
+		"relayID":     relay.ID,
+		"meetingID":   meeting.ID,
+		"renegotiate": renegotiate,
+	})
+
+	if renegotiate {
+		negotiateRelay(relay)
+	}
+}
+
+// handleRelayCandidate adds a trickled ICE candidate from the remote SFU
+func handleRelayCandidate(sfuCommand SFUCommand, meeting *Meeting) {
+	relay := lookupRelay(sfuCommand, meeting)
+	if relay == nil {
+		return
+	}
+
+	candidate, err := decodeICECandidateInit(sfuCommand.Payload["candidate"])
+	if err != nil {
+		sfuLogger.Error("RELAY", "Error decoding relay ICE candidate", err, map[string]interface{}{
+			"relayID": relay.ID,
+			"payload": sfuCommand.Payload,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return
+	}
+
+	relay.mu.Lock()
+	defer relay.mu.Unlock()
+
+	if relay.PeerConnection.RemoteDescription() == nil {
+		relay.pendingCandidates = append(relay.pendingCandidates, candidate)
+		return
+	}
+
+	if err := relay.PeerConnection.AddICECandidate(candidate); err != nil {
+		sfuLogger.Error("RELAY", "Error adding relay ICE candidate", err, map[string]interface{}{
+			"relayID":   relay.ID,
+			"candidate": candidate.Candidate,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+	}
+}
+
+// newRelayPeerConnection creates the PeerConnection of a relay and wires its callbacks
+func newRelayPeerConnection(meeting *Meeting, relay *RelayPeer) error {
+	peerConnection, err := newPeerConnection()
+	if err != nil {
+		sfuLogger.Error("RELAY", "Error creating relay PeerConnection", err, map[string]interface{}{
+			"relayID":   relay.ID,
+			"meetingID": meeting.ID,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return err
+	}
+	relay.PeerConnection = peerConnection
+
+	peerConnection.OnICECandidate(func(c *webrtc.ICECandidate) {
+		if c == nil {
+			return
+		}
+		sendSFUCommand(relay.RemoteSFUID, SFUCommand{
+			Type: "relayCandidate",
+			Payload: map[string]interface{}{
+				"meetingId": meeting.ID,
+				"relayId":   relay.ID,
+				"candidate": c.ToJSON(),
+			},
+		})
+	})
+
+	peerConnection.OnConnectionStateChange(func(s webrtc.PeerConnectionState) {
+		sfuLogger.Info("RELAY", "Relay connection state changed", map[string]interface{}{
+			"relayID":     relay.ID,
+			"meetingID":   meeting.ID,
+			"remoteSFUID": relay.RemoteSFUID,
+			"state":       s.String(),
+		})
+
+		if s == webrtc.PeerConnectionStateFailed {
+			closeRelay(meeting, relay, false)
+		}
+	})
+
+	peerConnection.OnTrack(func(remoteTrack *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+		meeting.mu.Lock()
+		meeting.relayedTracks[remoteTrack.ID()] = relay.ID
+		source, ok := meeting.relayedSources[remoteTrack.ID()]
+		meeting.mu.Unlock()
+		if !ok {
+			source = defaultTrackSource(remoteTrack.Kind(), remoteTrack.StreamID(), remoteTrack.ID())
+		}
+
+		// Relayed tracks are published exactly like tracks from local clients
+		publishTrack(meeting, relay.ID, peerConnection, remoteTrack, receiver, source)
+	})
+
+	return nil
+}
+
+// negotiateRelay sends a (re)offer to the remote SFU, or defers it while an offer is outstanding
+func negotiateRelay(relay *RelayPeer) {
+	e2ee := meetingE2EE(relay.MeetingID)
+	mode := meetingMode(relay.MeetingID)
+	trackSources := meetingTrackSources(relay.MeetingID)
+
+	relay.mu.Lock()
+	defer relay.mu.Unlock()
+
+	if relay.negotiating {
+		relay.renegotiate = true
+		return
+	}
+
+	offer, err := relay.PeerConnection.CreateOffer(nil)
+	if err != nil {
+		sfuLogger.Error("RELAY", "Error creating relay offer", err, map[string]interface{}{
+			"relayID": relay.ID,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return
+	}
+
+	if err := relay.PeerConnection.SetLocalDescription(offer); err != nil {
+		sfuLogger.Error("RELAY", "Error setting relay local description", err, map[string]interface{}{
+			"relayID": relay.ID,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return
+	}
+	relay.negotiating = true
+
+	sendSFUCommand(relay.RemoteSFUID, SFUCommand{
+		Type: "relayOffer",
+		Payload: map[string]interface{}{
+			"meetingId":    relay.MeetingID,
+			"relayId":      relay.ID,
+			"originSfuId":  sfuID,
+			"sdp":          offer.SDP,
+			"e2ee":         e2ee,
+			"mode":         mode,
+			"trackSources": trackSources,
+		},
+	})
+
+	sfuLogger.Debug("RELAY", "Sent relay offer", map[string]interface{}{
+		"relayID":     relay.ID,
+		"meetingID":   relay.MeetingID,
+		"remoteSFUID": relay.RemoteSFUID,
+	})
+}
+
+// relayWantsTrack reports whether an outbound relay should forward a track.
+// Tracks received from another SFU are only forwarded when explicitly selected,
+// and never back to the SFU they came from. Caller must hold meeting.mu.
+func relayWantsTrack(meeting *Meeting, relay *RelayPeer, trackID string) bool {
+	if !relay.Outbound {
+		return false
+	}
+
+	if sourceRelayID, relayed := meeting.relayedTracks[trackID]; relayed {
+		if source, ok := meeting.relays[sourceRelayID]; ok && source.RemoteSFUID == relay.RemoteSFUID {
+			return false
+		}
+		return relay.selectedTracks[trackID]
+	}
+
+	return relay.forwardAll || relay.selectedTracks[trackID]
+}
+
+// addTrackToRelay attaches the relay's down track of a router to an outbound relay without renegotiating
+func addTrackToRelay(relay *RelayPeer, router *TrackRouter) bool {
+	relay.mu.Lock()
+	defer relay.mu.Unlock()
+
+	if _, exists := relay.senders[router.ID()]; exists {
+		return false
+	}
+
+	downTrack := router.AddDownTrack(relay.ID)
+	sender, err := relay.PeerConnection.AddTrack(downTrack)
+	if err != nil {
+		router.RemoveDownTrack(relay.ID)
+		sfuLogger.Error("RELAY", "Error adding track to relay", err, map[string]interface{}{
+			"relayID": relay.ID,
+			"trackID": router.ID(),
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return false
+	}
+	relay.senders[router.ID()] = sender
+
+	go readSenderRTCP(sender, downTrack)
+
+	sfuLogger.Debug("RELAY", "Track added to relay", map[string]interface{}{
+		"relayID":   relay.ID,
+		"trackID":   router.ID(),
+		"trackKind": router.Kind().String(),
+	})
+	return true
+}
+
+// addTrackToRelays forwards a newly published track over every outbound relay that selects it
+func addTrackToRelays(meeting *Meeting, router *TrackRouter) {
+	meeting.mu.RLock()
+	relays := make([]*RelayPeer, 0, len(meeting.relays))
+	for _, relay := range meeting.relays {
+		if relayWantsTrack(meeting, relay, router.ID()) {
+			relays = append(relays, relay)
+		}
+	}
+	meeting.mu.RUnlock()
+
+	for _, relay := range relays {
+		if addTrackToRelay(relay, router) {
+			negotiateRelay(relay)
+		}
+	}
+}
+
+// removeTrackFromRelays stops forwarding an unpublished track over outbound relays
+func removeTrackFromRelays(meeting *Meeting, trackID string) {
+	meeting.mu.RLock()
+	relays := make([]*RelayPeer, 0, len(meeting.relays))
+	for _, relay := range meeting.relays {
+		if relay.Outbound {
+			relays = append(relays, relay)
+		}
+	}
+	meeting.mu.RUnlock()
+
+	for _, relay := range relays {
+		relay.mu.Lock()
+		sender, ok := relay.senders[trackID]
+		if ok {
+			delete(relay.senders, trackID)
+			if err := relay.PeerConnection.RemoveTrack(sender); err != nil {
+				sfuLogger.Error("RELAY", "Error removing track from relay", err, map[string]interface{}{
+					"relayID": relay.ID,
+					"trackID": trackID,
+				})
+				sfuState.IncrementCounters(0, 0, 1)
+			}
+		}
+		relay.mu.Unlock()
+
+		if ok {
+			negotiateRelay(relay)
+		}
+	}
+}
+
+// closeRelay removes a relay from its meeting, closes it and optionally notifies the remote SFU
+func closeRelay(meeting *Meeting, relay *RelayPeer, notifyRemote bool) {
+	meeting.mu.Lock()
+	_, exists := meeting.relays[relay.ID]
+	delete(meeting.relays, relay.ID)
+	meeting.mu.Unlock()
+
+	if !exists {
+		return
+	}
+	removeDownTracks(meeting, relay.ID)
+
+	if err := relay.PeerConnection.Close(); err != nil {
+		sfuLogger.Error("RELAY", "Error closing relay PeerConnection", err, map[string]interface{}{
+			"relayID": relay.ID,
+		})
+	}
+
+	if notifyRemote {
+		sendSFUCommand(relay.RemoteSFUID, SFUCommand{
+			Type: "relayClosed",
+			Payload: map[string]interface{}{
+				"meetingId": meeting.ID,
+				"relayId":   relay.ID,
+			},
+		})
+	}
+
+	sfuLogger.Info("RELAY", "Relay closed", map[string]interface{}{
+		"relayID":      relay.ID,
+		"meetingID":    meeting.ID,
+		"remoteSFUID":  relay.RemoteSFUID,
+		"notifyRemote": notifyRemote,
+	})
+}
+
+// lookupRelay finds the relay referenced by a command's relayId
+func lookupRelay(sfuCommand SFUCommand, meeting *Meeting) *RelayPeer {
+	relayID, ok := sfuCommand.Payload["relayId"].(string)
+	if !ok {
+		sfuLogger.Error("RELAY", "Missing or invalid relayId in relay command", nil, map[string]interface{}{
+			"commandType": sfuCommand.Type,
+			"payload":     sfuCommand.Payload,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return nil
+	}
+
+	meeting.mu.RLock()
+	relay, ok := meeting.relays[relayID]
+	meeting.mu.RUnlock()
+
+	if !ok {
+		sfuLogger.Warn("RELAY", "Relay not found in meeting", map[string]interface{}{
+			"commandType": sfuCommand.Type,
+			"relayID":     relayID,
+			"meetingID":   meeting.ID,
+		})
+		return nil
+	}
+	return relay
+}
+
+// addPendingRelayCandidates applies candidates that arrived before the remote description.
+// Caller must hold relay.mu.
+func addPendingRelayCandidates(relay *RelayPeer) {
+	for _, candidate := range relay.pendingCandidates {
+		if err := relay.PeerConnection.AddICECandidate(candidate); err != nil {
+			sfuLogger.Error("RELAY", "Error adding pending relay ICE candidate", err, map[string]interface{}{
+				"relayID":   relay.ID,
+				"candidate": candidate.Candidate,
+			})
+			sfuState.IncrementCounters(0, 0, 1)
+		}
+	}
+	relay.pendingCandidates = nil
+}
+
+// decodeICECandidateInit converts a JSON-decoded candidate object into an ICECandidateInit
+func decodeICECandidateInit(value interface{}) (webrtc.ICECandidateInit, error) {
+	var candidate webrtc.ICECandidateInit
+	candidateJSON, err := json.Marshal(value)
+	if err != nil {
+		return candidate, err
+	}
+	err = json.Unmarshal(candidateJSON, &candidate)
+	return candidate, err
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"github.com/pion/webrtc/v3"
+)
+
+// Participant roles, from the join token or the clientJoined command
+const (
+	roleHost      = "host"      // Publishes anything and manages other participants' roles
+	rolePresenter = "presenter" // Publishes audio, camera and screen share
+	roleAttendee  = "attendee"  // Publishes audio and camera
+	roleViewer    = "viewer"    // Receives only
+)
+
+// rolePermission lists what a role may publish
+type rolePermission struct {
+	publishAudio  bool
+	publishVideo  bool
+	publishScreen bool
+	manageRoles   bool
+}
+
+var rolePermissions = map[string]rolePermission{
+	roleHost:      {publishAudio: true, publishVideo: true, publishScreen: true, manageRoles: true},
+	rolePresenter: {publishAudio: true, publishVideo: true, publishScreen: true},
+	roleAttendee:  {publishAudio: true, publishVideo: true},
+	roleViewer:    {},
+}
+
+// parseRole validates a role; an empty role means the configured default
+func parseRole(value interface{}) (string, bool) {
+	role, _ := value.(string)
+	if role == "" {
+		return C.DefaultRole, true
+	}
+	if _, ok := rolePermissions[role]; !ok {
+		return "", false
+	}
+	return role, true
+}
+
+// joinRole picks the requested role of a client joining with verified token claims. The role
+// comes from the claims: a command may only carry a role over when a migration signed by the
+// source SFU moved the client here, since its role may have changed after the token was issued.
+// It returns false when the command sets a role it may not set.
+func joinRole(sfuCommand SFUCommand, claims *JoinTokenClaims, migratedFrom string) (interface{}, bool) {
+	carried, ok := sfuCommand.Payload["role"]
+	if !ok {
+		return claims.Role, true
+	}
+	if migratedFrom == "" {
+		return nil, false
+	}
+	return carried, true
+}
+
+// roleCanPublish reports whether a role may publish a track of this kind and source
+func roleCanPublish(role string, kind webrtc.RTPCodecType, source string) bool {
+	permission := rolePermissions[role]
+	switch {
+	case kind == webrtc.RTPCodecTypeAudio:
+		return permission.publishAudio
+	case source == trackSourceScreen:
+		return permission.publishScreen
+	default:
+		return permission.publishVideo
+	}
+}
+
+// publisherAllowed reports whether the local client publishing a router's track may still
+// publish it; relayed tracks were checked by the SFU they were published on.
+// The caller holds meeting.mu.
+func publisherAllowed(meeting *Meeting, router *TrackRouter) bool {
+	publisher, ok := meeting.clients[meeting.trackPublishers[router.ID()]]
+	if !ok {
+		return true
+	}
+	return roleCanPublish(publisher.role, router.Kind(), router.Source())
+}
+
+// rejectPublish stops receiving a track the client may not publish, e.g. because of its role
+func rejectPublish(meeting *Meeting, clientPeer *ClientPeer, remoteTrack *webrtc.TrackRemote, receiver *webrtc.RTPReceiver, reason string) {
+	sfuLogger.Warn("WEBRTC", "Ignoring track the client may not publish", map[string]interface{}{
+		"clientID":  clientPeer.ID,
+		"meetingID": meeting.ID,
+		"role":      clientPeer.role,
+		"trackID":   remoteTrack.ID(),
+		"trackKind": remoteTrack.Kind().String(),
+		"streamID":  remoteTrack.StreamID(),
+		"reason":    reason,
+	})
+
+	if err := receiver.Stop(); err != nil {
+		sfuLogger.Debug("WEBRTC", "Error stopping rejected receiver", map[string]interface{}{
+			"clientID": clientPeer.ID,
+			"trackID":  remoteTrack.ID(),
+			"error":    err.Error(),
+		})
+	}
+	sendDataChannelError(clientPeer, reason)
+}
+
+// revokeTrack unpublishes a track its publisher may no longer send: subscribers and relays
+// drop it with a renegotiation, and the publisher's receiver is stopped
+func revokeTrack(meeting *Meeting, router *TrackRouter) {
+	meeting.mu.Lock()
+	if meeting.routers[router.ID()] != router {
+		meeting.mu.Unlock()
+		return
+	}
+	publisherID := meeting.trackPublishers[router.ID()]
+	delete(meeting.routers, router.ID())
+	delete(meeting.relayedTracks, router.ID())
+	delete(meeting.trackPublishers, router.ID())
+	meeting.mu.Unlock()
+
+	downTracks := router.DownTracks()
+	router.Close()
+	removeTrackFromRelays(meeting, router.ID())
+
+	for _, downTrack := range downTracks {
+		meeting.mu.RLock()
+		clientPeer, ok := meeting.clients[downTrack.subscriberID]
+		meeting.mu.RUnlock()
+		if ok {
+			removeTrackFromPeer(clientPeer, downTrack)
+		}
+	}
+
+	// The publish loop fails to read, finds the router no longer routed and returns without
+	// announcing anything, so the track's end is announced here
+	router.stopSource()
+	announceScreenShare(meeting, router, publisherID, false)
+	publishLifecycleEvent(meeting.ID, "trackUnpublished", trackEventData(router, publisherID))
+}
+
+// removeTrackFromPeer removes a down track's sender from a subscriber and renegotiates
+func removeTrackFromPeer(clientPeer *ClientPeer, downTrack *DownTrack) {
+	if detachTrackFromPeer(clientPeer, downTrack) {
+		renegotiateClient(clientPeer, downTrack.ID())
+	}
+}
+
+// detachTrackFromPeer removes a down track's sender from a subscriber without renegotiating.
+// It reports whether a sender was removed.
+func detachTrackFromPeer(clientPeer *ClientPeer, downTrack *DownTrack) bool {
+	pc := clientPeer.PeerConnection
+	for _, sender := range pc.GetSenders() {
+		if sender.Track() != downTrack {
+			continue
+		}
+		if err := pc.RemoveTrack(sender); err != nil {
+			sfuLogger.Error("WEBRTC", "Error removing track from peer connection", err, map[string]interface{}{
+				"clientID": clientPeer.ID,
+				"trackID":  downTrack.ID(),
+			})
+			sfuState.IncrementCounters(0, 0, 1)
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+// mayManageMeeting reports whether a request may manage other participants: requests from
+// the signaling server itself (no requester) or from a participant whose role manages roles.
+// The caller holds meeting.mu.
+func mayManageMeeting(meeting *Meeting, requestedBy string) bool {
+	if requestedBy == "" {
+		return true
+	}
+	requester, ok := meeting.clients[requestedBy]
+	return ok && rolePermissions[requester.role].manageRoles
+}
+
+// handleSetParticipantRole promotes or demotes a participant mid-meeting. Tracks the new role
+// may not publish are unpublished, and the meeting is told about the change.
+// Payload: clientId, role, optional requestedBy (must be a host of the meeting).
+func handleSetParticipantRole(sfuCommand SFUCommand, meeting *Meeting) {
+	clientID, ok := sfuCommand.Payload["clientId"].(string)
+	if !ok {
+		sfuLogger.Error("KAFKA", "Missing or invalid clientId in setParticipantRole command", nil, map[string]interface{}{
+			"payload": sfuCommand.Payload,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return
+	}
+	role, ok := sfuCommand.Payload["role"].(string)
+	if _, known := rolePermissions[role]; !ok || !known {
+		sfuLogger.Error("KAFKA", "Missing or invalid role in setParticipantRole command", nil, map[string]interface{}{
+			"clientID": clientID,
+			"payload":  sfuCommand.Payload,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return
+	}
+
+	if forwardToMigrationTarget(sfuCommand, meeting, clientID) {
+		return
+	}
+
+	requestedBy, _ := sfuCommand.Payload["requestedBy"].(string)
+
+	meeting.mu.Lock()
+	clientPeer, exists := meeting.clients[clientID]
+	authorized := mayManageMeeting(meeting, requestedBy)
+	previous := ""
+	if exists && authorized {
+		previous = clientPeer.role
+		clientPeer.role = role
+	}
+	meeting.mu.Unlock()
+
+	if !exists {
+		sfuLogger.Warn("KAFKA", "setParticipantRole for client not in meeting", map[string]interface{}{
+			"clientID":  clientID,
+			"meetingID": meeting.ID,
+		})
+		return
+	}
+	if !authorized {
+		sfuLogger.Warn("KAFKA", "setParticipantRole requested by a participant who may not manage roles", map[string]interface{}{
+			"clientID":    clientID,
+			"meetingID":   meeting.ID,
+			"requestedBy": requestedBy,
+		})
+		return
+	}
+
+	// Unpublish what the new role no longer allows
+	meeting.mu.RLock()
+	var revoked []*TrackRouter
+	for trackID, router := range meeting.routers {
+		if meeting.trackPublishers[trackID] == clientID && !roleCanPublish(role, router.Kind(), router.Source()) {
+			revoked = append(revoked, router)
+		}
+	}
+	meeting.mu.RUnlock()
+
+	for _, router := range revoked {
+		revokeTrack(meeting, router)
+	}
+
+	sfuLogger.Info("WEBRTC", "Participant role changed", map[string]interface{}{
+		"clientID":      clientID,
+		"meetingID":     meeting.ID,
+		"previous":      previous,
+		"role":          role,
+		"revokedTracks": len(revoked),
+		"requestedBy":   requestedBy,
+	})
+
+	sendMeetingEvent(meeting, "roleChanged", map[string]interface{}{
+		"clientId": clientID,
+		"role":     role,
+		"previous": previous,
+	})
+}
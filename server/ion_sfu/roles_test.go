@@ -0,0 +1,125 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestJoinRole(t *testing.T) {
+	claims := &JoinTokenClaims{Subject: "client-1", MeetingID: "meeting-1", Role: roleAttendee}
+
+	tests := []struct {
+		name    string
+		payload map[string]interface{}
+		issuer  string // Verified envelope issuer
+		want    interface{}
+		ok      bool
+	}{
+		{
+			name:    "role from the token",
+			payload: map[string]interface{}{"clientId": "client-1"},
+			want:    roleAttendee,
+			ok:      true,
+		},
+		{
+			name:    "role carried over by a migration signed by the source SFU",
+			payload: map[string]interface{}{"clientId": "client-1", "migratedFrom": "sfu-source", "role": roleHost},
+			issuer:  "sfu-source",
+			want:    roleHost,
+			ok:      true,
+		},
+		{
+			name:    "role on a fresh join",
+			payload: map[string]interface{}{"clientId": "client-1", "role": roleHost},
+			issuer:  "signaling-server",
+		},
+		{
+			name:    "forged role on an unsigned migration",
+			payload: map[string]interface{}{"clientId": "client-1", "migratedFrom": "sfu-source", "role": roleHost},
+		},
+		{
+			name:    "forged role on a migration signed by a service other than an SFU",
+			payload: map[string]interface{}{"clientId": "client-1", "migratedFrom": "sfu-source", "role": roleHost},
+			issuer:  "signaling-server",
+		},
+		{
+			name:    "forged role on a migration signed by another SFU than the source",
+			payload: map[string]interface{}{"clientId": "client-1", "migratedFrom": "sfu-source", "role": roleHost},
+			issuer:  "sfu-other",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			command := SFUCommand{Type: "clientJoined", Payload: tt.payload, issuer: tt.issuer}
+			role, ok := joinRole(command, claims, verifiedMigratedFrom(command))
+			if ok != tt.ok || ok && role != tt.want {
+				t.Fatalf("joinRole = %v, %v, want %v, %v", role, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestForwardedJoinDropsMigrationFields(t *testing.T) {
+	command := SFUCommand{Type: "clientJoined", Payload: map[string]interface{}{
+		"meetingId":    "meeting-1",
+		"clientId":     "client-1",
+		"token":        "token",
+		"migratedFrom": "sfu-source",
+		"role":         roleHost,
+	}}
+
+	forwarded := withoutMigrationFields(command)
+	if _, ok := forwarded.Payload["role"]; ok {
+		t.Fatal("forwarded clientJoined keeps the role")
+	}
+	if _, ok := forwarded.Payload["migratedFrom"]; ok {
+		t.Fatal("forwarded clientJoined keeps migratedFrom")
+	}
+	if forwarded.Payload["token"] != "token" || command.Payload["role"] != roleHost {
+		t.Fatalf("forwarded payload %v, original %v", forwarded.Payload, command.Payload)
+	}
+}
+
+func TestRevokeTrackPublishesTrackUnpublished(t *testing.T) {
+	// Keep the events in the queue instead of handing them to the Kafka publisher
+	meetingEventPublisher.Do(func() {})
+	previousTopic := C.MeetingEventsTopic
+	C.MeetingEventsTopic = "meeting_events"
+	t.Cleanup(func() { C.MeetingEventsTopic = previousTopic })
+
+	router := newRouter("screen-1", "stream-1", webrtc.RTPCodecTypeVideo, testVP8, false, trackSourceScreen)
+	defer router.Close()
+	meeting := &Meeting{
+		ID:              "meeting-1",
+		clients:         map[string]*ClientPeer{"client-1": {ID: "client-1", MeetingID: "meeting-1", role: roleViewer}},
+		routers:         map[string]*TrackRouter{router.ID(): router},
+		relayedTracks:   make(map[string]string),
+		trackPublishers: map[string]string{router.ID(): "client-1"},
+		relays:          make(map[string]*RelayPeer),
+	}
+
+	revokeTrack(meeting, router)
+	if _, ok := meeting.routers[router.ID()]; ok {
+		t.Fatal("revoked track still routed")
+	}
+
+	select {
+	case event := <-meetingEventQueue:
+		data := event.EventData.(map[string]interface{})
+		if event.EventType != "trackUnpublished" || event.MeetingID != "meeting-1" || data["trackId"] != "screen-1" || data["publisherId"] != "client-1" || data["source"] != trackSourceScreen {
+			t.Fatalf("lifecycle event = %+v", event)
+		}
+	default:
+		t.Fatal("no trackUnpublished event for the revoked track")
+	}
+
+	// A track revoked already is not announced twice
+	revokeTrack(meeting, router)
+	select {
+	case event := <-meetingEventQueue:
+		t.Fatalf("second revoke published %+v", event)
+	default:
+	}
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// keyframeRequestInterval limits how often subscribers can make a publisher send a keyframe
+const keyframeRequestInterval = time.Second
+
+// TrackRouter receives one published track and dispatches its RTP to a DownTrack per
+// subscriber (client or relay). The router outlives its source: when the same track is
+// published again (e.g. a local publisher replacing a relayed copy after a migration)
+// the down tracks are re-based onto the new source without renegotiation.
+type TrackRouter struct {
+	id        string
+	streamID  string
+	kind      webrtc.RTPCodecType
+	codec     webrtc.RTPCodecCapability
+	encrypted bool       // Payloads are end-to-end encrypted and must not be parsed
+	source    string     // trackSourceCamera, trackSourceMicrophone or trackSourceScreen
+	svc       *svcLayers // nil unless the codec supports SVC layer dropping
+
+	mu              sync.RWMutex
+	downTracks      map[string]*DownTrack // Map<subscriberID, *DownTrack>
+	publisherID     string
+	receiver        *webrtc.RTPReceiver
+	generation      uint64 // Incremented on every source switch
+	requestKeyframe func()
+
+	keyframePending int32 // Set by subscribers, cleared when the PLI is sent
+	lastKeyframeReq int64 // Unix nanoseconds
+}
+
+// newTrackRouter creates a router for a remote track; encrypted tracks are routed from RTP headers only
+func newTrackRouter(remoteTrack *webrtc.TrackRemote, encrypted bool, source string) *TrackRouter {
+	return newRouter(remoteTrack.ID(), remoteTrack.StreamID(), remoteTrack.Kind(), remoteTrack.Codec().RTPCodecCapability, encrypted, source)
+}
+
+// newRouter creates a router for a track fed by any source, e.g. a remote track or an RTP ingest
+func newRouter(id, streamID string, kind webrtc.RTPCodecType, codec webrtc.RTPCodecCapability, encrypted bool, source string) *TrackRouter {
+	router := &TrackRouter{
+		id:         id,
+		streamID:   streamID,
+		kind:       kind,
+		codec:      codec,
+		encrypted:  encrypted,
+		source:     source,
+		downTracks: make(map[string]*DownTrack),
+	}
+	if isSVCCodec(router.codec.MimeType) {
+		router.svc = newSVCLayers(router.codec.MimeType, encrypted)
+	}
+	return router
+}
+
+// ID is the track ID shared by the published track and all its down tracks
+func (r *TrackRouter) ID() string { return r.id }
+
+// StreamID is the stream the track belongs to
+func (r *TrackRouter) StreamID() string { return r.streamID }
+
+// Kind is audio or video
+func (r *TrackRouter) Kind() webrtc.RTPCodecType { return r.kind }
+
+// Codec is the codec of the published track
+func (r *TrackRouter) Codec() webrtc.RTPCodecCapability { return r.codec }
+
+// Encrypted reports whether the track's payloads are end-to-end encrypted
+func (r *TrackRouter) Encrypted() bool { return r.encrypted }
+
+// Source is what the publisher captures: camera, microphone or screen
+func (r *TrackRouter) Source() string { return r.source }
+
+// canRoute reports whether a newly published remote track can take over this router
+func (r *TrackRouter) canRoute(remoteTrack *webrtc.TrackRemote) bool {
+	return r.kind == remoteTrack.Kind() && strings.EqualFold(r.codec.MimeType, remoteTrack.Codec().MimeType)
+}
+
+// attachSource makes a remote track the source of this router and returns its generation.
+// Sources outside a PeerConnection, such as an RTP ingest, have no receiver.
+func (r *TrackRouter) attachSource(publisherID string, receiver *webrtc.RTPReceiver, requestKeyframe func()) uint64 {
+	r.mu.Lock()
+	r.publisherID = publisherID
+	r.receiver = receiver
+	r.requestKeyframe = requestKeyframe
+	r.generation++
+	generation := r.generation
+	downTracks := r.downTracksLocked()
+	r.mu.Unlock()
+
+	if r.svc != nil && receiver != nil {
+		r.svc.setExtensionID(headerExtensionID(receiver.GetParameters().HeaderExtensions, av1DependencyDescriptorURI))
+	}
+	if generation > 1 {
+		for _, downTrack := range downTracks {
+			downTrack.switchSource()
+		}
+	}
+	r.RequestKeyframe()
+	return generation
+}
+
+// isSource reports whether the source with this generation still feeds the router
+func (r *TrackRouter) isSource(generation uint64) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.generation == generation
+}
+
+// Publisher returns the client or relay currently publishing the track
+func (r *TrackRouter) Publisher() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.publisherID
+}
+
+// stopSource stops receiving the current source, which ends its publish loop
+func (r *TrackRouter) stopSource() {
+	r.mu.RLock()
+	receiver := r.receiver
+	r.mu.RUnlock()
+
+	if receiver == nil {
+		return
+	}
+	if err := receiver.Stop(); err != nil {
+		sfuLogger.Debug("WEBRTC", "Error stopping track receiver", map[string]interface{}{
+			"trackID": r.id,
+			"error":   err.Error(),
+		})
+	}
+}
+
+// AddDownTrack creates the down track of a subscriber, replacing any previous one
+func (r *TrackRouter) AddDownTrack(subscriberID string) *DownTrack {
+	downTrack := newDownTrack(r, subscriberID)
+
+	r.mu.Lock()
+	previous := r.downTracks[subscriberID]
+	r.downTracks[subscriberID] = downTrack
+	r.mu.Unlock()
+
+	if previous != nil {
+		previous.Close()
+	}
+	return downTrack
+}
+
+// RemoveDownTrack stops forwarding to a subscriber
+func (r *TrackRouter) RemoveDownTrack(subscriberID string) *DownTrack {
+	r.mu.Lock()
+	downTrack, ok := r.downTracks[subscriberID]
+	if ok {
+		delete(r.downTracks, subscriberID)
+	}
+	r.mu.Unlock()
+
+	if ok {
+		downTrack.Close()
+	}
+	return downTrack
+}
+
+// Close stops every down track; the router must no longer be routed by its meeting
+func (r *TrackRouter) Close() {
+	r.mu.Lock()
+	downTracks := r.downTracksLocked()
+	r.downTracks = make(map[string]*DownTrack)
+	r.mu.Unlock()
+
+	for _, downTrack := range downTracks {
+		downTrack.Close()
+	}
+}
+
+// DownTrack returns the down track of a subscriber, or nil
+func (r *TrackRouter) DownTrack(subscriberID string) *DownTrack {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.downTracks[subscriberID]
+}
+
+// DownTracks returns all down tracks of the router
+func (r *TrackRouter) DownTracks() []*DownTrack {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.downTracksLocked()
+}
+
+func (r *TrackRouter) downTracksLocked() []*DownTrack {
+	downTracks := make([]*DownTrack, 0, len(r.downTracks))
+	for _, downTrack := range r.downTracks {
+		downTracks = append(downTracks, downTrack)
+	}
+	return downTracks
+}
+
+// WriteRTP queues one packet of the source on every down track without waiting for
+// subscribers. Each down track takes its own reference; the caller keeps (and releases) its own.
+func (r *TrackRouter) WriteRTP(fp *forwardPacket) {
+	fp.info = svcPacketInfo{startOfFrame: true, endOfFrame: fp.packet.Marker, keyframe: true}
+	fp.ddExtID = 0
+	reselect := false
+	if r.svc != nil {
+		fp.info, reselect = r.svc.parse(&fp.packet)
+		fp.ddExtID = r.svc.extensionID()
+	}
+
+	r.mu.RLock()
+	fp.retain(len(r.downTracks))
+	for _, downTrack := range r.downTracks {
+		if reselect {
+			atomic.StoreInt32(&downTrack.reselect, 1)
+		}
+		downTrack.enqueue(fp)
+	}
+	requestKeyframe := r.requestKeyframe
+	r.mu.RUnlock()
+
+	if atomic.LoadInt32(&r.keyframePending) == 1 && requestKeyframe != nil {
+		now := time.Now().UnixNano()
+		if now-atomic.LoadInt64(&r.lastKeyframeReq) >= int64(keyframeRequestInterval) {
+			atomic.StoreInt64(&r.lastKeyframeReq, now)
+			atomic.StoreInt32(&r.keyframePending, 0)
+			go requestKeyframe()
+		}
+	}
+}
+
+// RequestKeyframe asks the publisher for a keyframe; requests are coalesced and rate limited
+func (r *TrackRouter) RequestKeyframe() {
+	if r.kind == webrtc.RTPCodecTypeVideo {
+		atomic.StoreInt32(&r.keyframePending, 1)
+	}
+}
+
+// lookupRouter returns the router of a track in a meeting, or nil
+func lookupRouter(meeting *Meeting, trackID string) *TrackRouter {
+	meeting.mu.RLock()
+	defer meeting.mu.RUnlock()
+	return meeting.routers[trackID]
+}
+
+// lookupDownTrack returns a subscriber's down track of a track, or nil
+func lookupDownTrack(meeting *Meeting, trackID, subscriberID string) *DownTrack {
+	router := lookupRouter(meeting, trackID)
+	if router == nil {
+		return nil
+	}
+	return router.DownTrack(subscriberID)
+}
+
+// removeDownTracks stops forwarding every track of the meeting to a subscriber that left
+func removeDownTracks(meeting *Meeting, subscriberID string) {
+	meeting.mu.RLock()
+	routers := make([]*TrackRouter, 0, len(meeting.routers))
+	for _, router := range meeting.routers {
+		routers = append(routers, router)
+	}
+	meeting.mu.RUnlock()
+
+	for _, router := range routers {
+		router.RemoveDownTrack(subscriberID)
+	}
+}
+
+// meetingForwardStats collects the per-subscriber forwarding statistics of a meeting
+func meetingForwardStats(meeting *Meeting) []DownTrackStats {
+	meeting.mu.RLock()
+	routers := make([]*TrackRouter, 0, len(meeting.routers))
+	for _, router := range meeting.routers {
+		routers = append(routers, router)
+	}
+	meeting.mu.RUnlock()
+
+	var stats []DownTrackStats
+	for _, router := range routers {
+		for _, downTrack := range router.DownTracks() {
+			stats = append(stats, downTrack.Stats())
+		}
+	}
+	return stats
+}
+
+// handleGetForwardStats replies with the per-subscriber forwarding statistics of a meeting
+func handleGetForwardStats(sfuCommand SFUCommand, meeting *Meeting) {
+	if sfuCommand.ReplyTo == "" {
+		sfuLogger.Warn("KAFKA", "getForwardStats command without replyTo", map[string]interface{}{
+			"meetingID": meeting.ID,
+		})
+		return
+	}
+
+	stats := meetingForwardStats(meeting)
+	if err := sendKafkaMessage(sfuCommand.ReplyTo, meeting.ID, WSMessage{
+		Type:     "forwardStats",
+		SenderID: sfuID,
+		Payload: map[string]interface{}{
+			"meetingId":  meeting.ID,
+			"sfuId":      sfuID,
+			"downTracks": stats,
+		},
+	}); err != nil {
+		sfuLogger.Error("KAFKA", "Error sending forward stats", err, map[string]interface{}{
+			"meetingID": meeting.ID,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+	}
+}
+
+// handleSetTrackPaused pauses or resumes forwarding of one track to one subscriber without renegotiation.
+// Payload: clientId, trackId, paused.
+func handleSetTrackPaused(sfuCommand SFUCommand, meeting *Meeting) {
+	clientID, ok := sfuCommand.Payload["clientId"].(string)
+	if !ok {
+		sfuLogger.Error("KAFKA", "Missing or invalid clientId in setTrackPaused command", nil, map[string]interface{}{
+			"payload": sfuCommand.Payload,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return
+	}
+	trackID, ok := sfuCommand.Payload["trackId"].(string)
+	if !ok {
+		sfuLogger.Error("KAFKA", "Missing or invalid trackId in setTrackPaused command", nil, map[string]interface{}{
+			"payload": sfuCommand.Payload,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return
+	}
+	paused, _ := sfuCommand.Payload["paused"].(bool)
+
+	downTrack := lookupDownTrack(meeting, trackID, clientID)
+	if downTrack == nil {
+		sfuLogger.Warn("KAFKA", "setTrackPaused for unknown subscriber or track", map[string]interface{}{
+			"clientID":  clientID,
+			"trackID":   trackID,
+			"meetingID": meeting.ID,
+		})
+		return
+	}
+
+	downTrack.SetPaused(paused)
+	sfuLogger.Info("WEBRTC", "Subscriber track paused state changed", map[string]interface{}{
+		"clientID":  clientID,
+		"trackID":   trackID,
+		"meetingID": meeting.ID,
+		"paused":    paused,
+	})
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+// discardWriter accepts and drops every packet, like a subscriber with unlimited bandwidth
+type discardWriter struct{}
+
+func (discardWriter) WriteRTP(header *rtp.Header, payload []byte) (int, error) {
+	return len(payload), nil
+}
+
+func (discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+
+// BenchmarkTrackRouterWriteRTP measures the forwarding path of a meeting with 10 published
+// tracks and 50 subscribers: one received packet per track is parsed into a pooled buffer
+// and queued on every down track, whose writers rewrite and send it.
+func BenchmarkTrackRouterWriteRTP(b *testing.B) {
+	const (
+		routerCount     = 10
+		subscriberCount = 50
+	)
+
+	routers := make([]*TrackRouter, routerCount)
+	for i := range routers {
+		routers[i] = newRouter(fmt.Sprintf("track-%d", i), "stream", webrtc.RTPCodecTypeVideo, testVP8, false, trackSourceCamera)
+		for s := 0; s < subscriberCount; s++ {
+			routers[i].AddDownTrack(fmt.Sprintf("subscriber-%d", s)).bindWriter(webrtc.SSRC(s+1), 96, discardWriter{})
+		}
+	}
+	defer func() {
+		for _, router := range routers {
+			router.Close()
+		}
+	}()
+
+	packet := &rtp.Packet{
+		Header:  rtp.Header{Version: 2, PayloadType: 96, SSRC: 1111, Marker: true},
+		Payload: make([]byte, 1200),
+	}
+
+	b.ReportAllocs()
+	b.SetBytes(int64(routerCount * len(packet.Payload)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		packet.SequenceNumber = uint16(i)
+		packet.Timestamp = uint32(i) * 3000
+		for _, router := range routers {
+			fp := getForwardPacket()
+			n, err := packet.MarshalTo(fp.buf[:])
+			if err != nil {
+				b.Fatal(err)
+			}
+			if err := fp.packet.Unmarshal(fp.buf[:n]); err != nil {
+				b.Fatal(err)
+			}
+			router.WriteRTP(fp)
+			fp.release()
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// Track sources publishers announce in the trackSources map of their offers, keyed by track or stream ID
+const (
+	trackSourceCamera     = "camera"
+	trackSourceMicrophone = "microphone"
+	trackSourceScreen     = "screen" // Screen share video, or the audio captured with it
+)
+
+// parseTrackSources validates the trackSources map of an offer; unknown sources are ignored
+func parseTrackSources(value interface{}) map[string]string {
+	announced, _ := value.(map[string]interface{})
+	sources := make(map[string]string, len(announced))
+	for id, source := range announced {
+		switch source {
+		case trackSourceCamera, trackSourceMicrophone, trackSourceScreen:
+			sources[id] = source.(string)
+		}
+	}
+	return sources
+}
+
+// recordTrackSources remembers the sources a client announced with its offer, before its tracks arrive
+func recordTrackSources(sfuCommand SFUCommand, meeting *Meeting, peer *ClientPeer) {
+	sources := parseTrackSources(sfuCommand.Payload["trackSources"])
+	if len(sources) == 0 {
+		return
+	}
+
+	meeting.mu.Lock()
+	if peer.trackSources == nil {
+		peer.trackSources = make(map[string]string, len(sources))
+	}
+	for id, source := range sources {
+		peer.trackSources[id] = source
+	}
+	meeting.mu.Unlock()
+}
+
+// publisherTrackSource returns the announced source of a client's track.
+// The caller holds meeting.mu.
+func publisherTrackSource(clientPeer *ClientPeer, remoteTrack *webrtc.TrackRemote) string {
+	if source, ok := clientPeer.trackSources[remoteTrack.ID()]; ok {
+		return source
+	}
+	if source, ok := clientPeer.trackSources[remoteTrack.StreamID()]; ok {
+		return source
+	}
+
+	source := defaultTrackSource(remoteTrack.Kind(), remoteTrack.StreamID(), remoteTrack.ID())
+	sfuLogger.Warn("WEBRTC", "Publisher announced no source for track, guessing from its IDs", map[string]interface{}{
+		"clientID": clientPeer.ID,
+		"trackID":  remoteTrack.ID(),
+		"streamID": remoteTrack.StreamID(),
+		"source":   source,
+	})
+	return source
+}
+
+// defaultTrackSource guesses the source of a track nobody announced a source for, e.g. from
+// clients that send no trackSources with their offers. A stream or track ID containing
+// "screen" is taken for a screen share.
+func defaultTrackSource(kind webrtc.RTPCodecType, streamID, trackID string) string {
+	switch {
+	case strings.Contains(strings.ToLower(streamID), "screen") || strings.Contains(strings.ToLower(trackID), "screen"):
+		return trackSourceScreen
+	case kind == webrtc.RTPCodecTypeAudio:
+		return trackSourceMicrophone
+	default:
+		return trackSourceCamera
+	}
+}
+
+// isScreenShareVideo reports whether a router forwards screen share video
+func isScreenShareVideo(router *TrackRouter) bool {
+	return router.Source() == trackSourceScreen && router.Kind() == webrtc.RTPCodecTypeVideo
+}
+
+// screenShareLimitReached reports whether a new screen share would exceed the meeting's limit.
+// The caller holds meeting.mu.
+func screenShareLimitReached(meeting *Meeting, remoteTrack *webrtc.TrackRemote, source string) bool {
+	if source != trackSourceScreen || remoteTrack.Kind() != webrtc.RTPCodecTypeVideo {
+		return false
+	}
+	limit := C.MaxScreenShares
+	if meeting.maxScreenShares > 0 {
+		limit = meeting.maxScreenShares
+	}
+	if limit <= 0 {
+		return false
+	}
+
+	shares := 0
+	for trackID, router := range meeting.routers {
+		// A publisher re-sending the same track does not start another share
+		if trackID != remoteTrack.ID() && isScreenShareVideo(router) {
+			shares++
+		}
+	}
+	return shares >= limit
+}
+
+// meetingTrackSources returns the sources of the tracks routed in a meeting, for relay offers
+func meetingTrackSources(meetingID string) map[string]string {
+	meetingsMu.RLock()
+	meeting, ok := meetings[meetingID]
+	meetingsMu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	meeting.mu.RLock()
+	defer meeting.mu.RUnlock()
+	sources := make(map[string]string, len(meeting.routers))
+	for trackID, router := range meeting.routers {
+		sources[trackID] = router.Source()
+	}
+	return sources
+}
+
+// announceScreenShare tells the meeting that a local participant started or stopped sharing its screen
+func announceScreenShare(meeting *Meeting, router *TrackRouter, publisherID string, started bool) {
+	if !isScreenShareVideo(router) {
+		return
+	}
+
+	eventType, message := "screenShareStopped", "Screen share stopped"
+	if started {
+		eventType, message = "screenShareStarted", "Screen share started"
+	}
+	sfuLogger.Info("WEBRTC", message, map[string]interface{}{
+		"publisherID": publisherID,
+		"meetingID":   meeting.ID,
+		"trackID":     router.ID(),
+	})
+	sendMeetingEvent(meeting, eventType, map[string]interface{}{
+		"publisherId": publisherID,
+		"trackId":     router.ID(),
+		"streamId":    router.StreamID(),
+	})
+}
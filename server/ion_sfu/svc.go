@@ -0,0 +1,514 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v3"
+)
+
+// av1DependencyDescriptorURI is the RTP header extension carrying AV1 (and optionally VP9) layer information
+const av1DependencyDescriptorURI = "https://aomediacodec.github.io/av1-rtp-spec/#dependency-descriptor-rtp-header-extension"
+
+const (
+	maxSVCSpatialLayers  = 4
+	maxSVCTemporalLayers = 4
+
+	svcBitrateWindow        = time.Second
+	svcLossDecreaseFraction = 25 // RTCP fraction lost (out of 256, ~10%) above which we step down
+	svcLossIncreaseFraction = 5  // ... and below which the estimate may grow again
+)
+
+// isSVCCodec reports whether layers of this codec can be dropped by the SFU
+func isSVCCodec(mimeType string) bool {
+	return strings.EqualFold(mimeType, webrtc.MimeTypeVP9) || strings.EqualFold(mimeType, webrtc.MimeTypeAV1)
+}
+
+// svcPacketInfo is the layer information of one RTP packet
+type svcPacketInfo struct {
+	spatial      int
+	temporal     int
+	startOfFrame bool
+	endOfFrame   bool
+	keyframe     bool // A subscriber may start decoding or switch spatial layers here
+	switchUp     bool // Temporal layer switching point
+}
+
+// svcLayers parses the layer information of an SVC stream and measures the bitrate of each layer.
+// It belongs to a TrackRouter; the per-subscriber choice is made by each DownTrack's svcSelector.
+type svcLayers struct {
+	mimeType  string
+	encrypted bool // Only the dependency descriptor may be read, payloads are end-to-end encrypted
+
+	mu            sync.RWMutex
+	ddExtID       uint8 // Dependency descriptor extension ID negotiated with the publisher (0 = none)
+	av1Structure  *av1TemplateStructure
+	layerHeights  []int // Frame height per spatial layer, when the publisher signals it
+	layerBytes    [maxSVCSpatialLayers][maxSVCTemporalLayers]int
+	layerBitrates [maxSVCSpatialLayers][maxSVCTemporalLayers]uint64
+	windowStart   time.Time
+}
+
+func newSVCLayers(mimeType string, encrypted bool) *svcLayers {
+	return &svcLayers{mimeType: mimeType, encrypted: encrypted, windowStart: time.Now()}
+}
+
+// setExtensionID records the dependency descriptor ID negotiated with the current publisher
+func (l *svcLayers) setExtensionID(ddExtID uint8) {
+	l.mu.Lock()
+	l.ddExtID = ddExtID
+	l.av1Structure = nil
+	l.mu.Unlock()
+}
+
+// extensionID returns the dependency descriptor ID of the current publisher
+func (l *svcLayers) extensionID() uint8 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.ddExtID
+}
+
+// headerExtensionID finds the negotiated ID of a header extension
+func headerExtensionID(extensions []webrtc.RTPHeaderExtensionParameter, uri string) uint8 {
+	for _, extension := range extensions {
+		if extension.URI == uri {
+			return uint8(extension.ID)
+		}
+	}
+	return 0
+}
+
+// parse extracts layer information from the dependency descriptor or the VP9 payload descriptor
+// and accounts the packet to its layer. It reports whether a new bitrate measurement is available.
+// Packets without layer information are treated as base layer packets. Encrypted payloads are
+// never parsed, so encrypted VP9 without a dependency descriptor is forwarded as a single layer.
+func (l *svcLayers) parse(p *rtp.Packet) (svcPacketInfo, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	info := l.parseLocked(p)
+	l.layerBytes[info.spatial][info.temporal] += len(p.Payload)
+
+	elapsed := time.Since(l.windowStart)
+	if elapsed < svcBitrateWindow {
+		return info, false
+	}
+	for s := range l.layerBytes {
+		for t := range l.layerBytes[s] {
+			l.layerBitrates[s][t] = uint64(float64(l.layerBytes[s][t]*8) / elapsed.Seconds())
+			l.layerBytes[s][t] = 0
+		}
+	}
+	l.windowStart = time.Now()
+	return info, true
+}
+
+func (l *svcLayers) parseLocked(p *rtp.Packet) svcPacketInfo {
+	info := svcPacketInfo{startOfFrame: true, endOfFrame: p.Marker}
+
+	if l.ddExtID != 0 {
+		if payload := p.GetExtension(l.ddExtID); payload != nil {
+			descriptor, err := parseDependencyDescriptor(payload, l.av1Structure)
+			if err == nil {
+				if descriptor.structure != nil {
+					l.av1Structure = descriptor.structure
+					if len(descriptor.structure.heights) > 0 {
+						l.layerHeights = descriptor.structure.heights
+					}
+				}
+				info.spatial = descriptor.spatial
+				info.temporal = descriptor.temporal
+				info.startOfFrame = descriptor.startOfFrame
+				info.endOfFrame = descriptor.endOfFrame
+				info.keyframe = descriptor.structure != nil
+				info.switchUp = descriptor.temporal == 0
+				return clampLayers(info)
+			}
+		}
+	}
+
+	if strings.EqualFold(l.mimeType, webrtc.MimeTypeVP9) && !l.encrypted {
+		vp9 := codecs.VP9Packet{}
+		if _, err := vp9.Unmarshal(p.Payload); err == nil {
+			info.startOfFrame = vp9.B
+			info.endOfFrame = vp9.E
+			info.spatial = int(vp9.SID)
+			info.temporal = int(vp9.TID)
+			info.switchUp = vp9.U || vp9.TID == 0
+			info.keyframe = !vp9.P && vp9.SID == 0
+			if vp9.V && vp9.Y && len(vp9.Height) > 0 {
+				heights := make([]int, len(vp9.Height))
+				for i, height := range vp9.Height {
+					heights[i] = int(height)
+				}
+				l.layerHeights = heights
+			}
+		}
+		return clampLayers(info)
+	}
+
+	// AV1 or encrypted media without a dependency descriptor: every frame is forwarded as base layer
+	info.keyframe = true
+	return info
+}
+
+func clampLayers(info svcPacketInfo) svcPacketInfo {
+	if info.spatial >= maxSVCSpatialLayers {
+		info.spatial = maxSVCSpatialLayers - 1
+	}
+	if info.temporal >= maxSVCTemporalLayers {
+		info.temporal = maxSVCTemporalLayers - 1
+	}
+	return info
+}
+
+// cumulativeBitrate is the bitrate needed to receive layers up to (spatial, temporal)
+func (l *svcLayers) cumulativeBitrate(spatial, temporal int) uint64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var total uint64
+	for s := 0; s <= spatial; s++ {
+		for t := 0; t <= temporal; t++ {
+			total += l.layerBitrates[s][t]
+		}
+	}
+	return total
+}
+
+// spatialLayerHeight returns the frame height of a spatial layer, or 0 if unknown
+func (l *svcLayers) spatialLayerHeight(spatial int) int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if spatial < len(l.layerHeights) {
+		return l.layerHeights[spatial]
+	}
+	return 0
+}
+
+// svcSelector is the layer selection of one subscriber; it is guarded by its DownTrack's mutex
+type svcSelector struct {
+	maxSpatial  int    // Highest spatial layer requested by the subscriber
+	maxTemporal int    // Highest temporal layer requested by the subscriber
+	maxHeight   int    // 0 = no resolution limit
+	bandwidth   uint64 // Estimated available bitrate in bps (0 = unknown)
+
+	targetSpatial   int
+	targetTemporal  int
+	currentSpatial  int // -1 until a keyframe was forwarded
+	currentTemporal int
+}
+
+func newSVCSelector() *svcSelector {
+	return &svcSelector{
+		maxSpatial:      maxSVCSpatialLayers - 1,
+		maxTemporal:     maxSVCTemporalLayers - 1,
+		targetSpatial:   maxSVCSpatialLayers - 1,
+		targetTemporal:  maxSVCTemporalLayers - 1,
+		currentSpatial:  -1,
+		currentTemporal: -1,
+	}
+}
+
+// selectLayers picks the highest layers within the subscriber's limits and bandwidth.
+// It reports whether a keyframe is needed to reach the new target.
+func (s *svcSelector) selectLayers(layers *svcLayers) bool {
+	maxSpatial := s.maxSpatial
+	if s.maxHeight > 0 {
+		for sl := maxSpatial; sl > 0; sl-- {
+			if height := layers.spatialLayerHeight(sl); height > 0 && height <= s.maxHeight {
+				break
+			}
+			maxSpatial = sl - 1
+		}
+	}
+
+	spatial, temporal := 0, 0
+	for sl := 0; sl <= maxSpatial; sl++ {
+		for tl := 0; tl <= s.maxTemporal; tl++ {
+			if s.bandwidth > 0 && layers.cumulativeBitrate(sl, tl) > s.bandwidth && (sl > 0 || tl > 0) {
+				continue
+			}
+			if sl > spatial || (sl == spatial && tl > temporal) {
+				spatial, temporal = sl, tl
+			}
+		}
+	}
+
+	s.targetSpatial = spatial
+	s.targetTemporal = temporal
+	// Moving up a spatial layer needs a keyframe
+	return s.currentSpatial >= 0 && spatial > s.currentSpatial
+}
+
+// accept switches layers at picture boundaries and reports whether the packet is forwarded
+func (s *svcSelector) accept(info svcPacketInfo) bool {
+	if info.startOfFrame && info.spatial == 0 {
+		switch {
+		case s.currentSpatial < 0:
+			if info.keyframe {
+				s.currentSpatial = s.targetSpatial
+				s.currentTemporal = s.targetTemporal
+			}
+		case s.targetSpatial > s.currentSpatial:
+			if info.keyframe {
+				s.currentSpatial = s.targetSpatial
+			}
+		case s.targetSpatial < s.currentSpatial:
+			s.currentSpatial = s.targetSpatial
+		}
+
+		if s.currentSpatial >= 0 {
+			if s.targetTemporal < s.currentTemporal || info.switchUp || info.keyframe {
+				s.currentTemporal = s.targetTemporal
+			}
+		}
+	}
+
+	return s.currentSpatial >= 0 && info.spatial <= s.currentSpatial && info.temporal <= s.currentTemporal
+}
+
+// endsPicture reports whether the packet ends the picture for this subscriber,
+// which is the case for the last packet of the highest forwarded spatial layer
+func (s *svcSelector) endsPicture(info svcPacketInfo) bool {
+	return info.endOfFrame && info.spatial == s.currentSpatial
+}
+
+// adjustForLoss is a loss-based estimate for subscribers that do not send REMB
+func (s *svcSelector) adjustForLoss(layers *svcLayers, fractionLost uint8) bool {
+	if s.currentSpatial < 0 {
+		return false
+	}
+	current := layers.cumulativeBitrate(s.currentSpatial, s.currentTemporal)
+	if current == 0 {
+		return false
+	}
+
+	switch {
+	case fractionLost > svcLossDecreaseFraction:
+		s.bandwidth = current * 85 / 100
+	case fractionLost < svcLossIncreaseFraction && s.bandwidth > 0:
+		s.bandwidth = s.bandwidth * 108 / 100
+	default:
+		return false
+	}
+	return s.selectLayers(layers)
+}
+
+// handleSetVideoLayers applies a subscriber's layer or resolution limits to an SVC track.
+// Payload: clientId, trackId and any of spatialLayer, temporalLayer, maxHeight.
+func handleSetVideoLayers(sfuCommand SFUCommand, meeting *Meeting) {
+	clientID, ok := sfuCommand.Payload["clientId"].(string)
+	if !ok {
+		sfuLogger.Error("KAFKA", "Missing or invalid clientId in setVideoLayers command", nil, map[string]interface{}{
+			"payload": sfuCommand.Payload,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return
+	}
+	trackID, ok := sfuCommand.Payload["trackId"].(string)
+	if !ok {
+		sfuLogger.Error("KAFKA", "Missing or invalid trackId in setVideoLayers command", nil, map[string]interface{}{
+			"payload": sfuCommand.Payload,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
+		return
+	}
+
+	// JSON numbers arrive as float64; a missing limit means "no limit"
+	limit := func(key string, fallback int) int {
+		if value, ok := sfuCommand.Payload[key].(float64); ok {
+			return int(value)
+		}
+		return fallback
+	}
+	spatial := limit("spatialLayer", -1)
+	temporal := limit("temporalLayer", -1)
+	maxHeight := limit("maxHeight", 0)
+
+	downTrack := lookupDownTrack(meeting, trackID, clientID)
+	if downTrack == nil || !downTrack.SetLayerLimits(spatial, temporal, maxHeight) {
+		sfuLogger.Warn("KAFKA", "setVideoLayers for unknown subscriber or non-SVC track", map[string]interface{}{
+			"clientID":  clientID,
+			"trackID":   trackID,
+			"meetingID": meeting.ID,
+		})
+		return
+	}
+
+	sfuLogger.Info("WEBRTC", "Updated subscriber SVC layer limits", map[string]interface{}{
+		"clientID":      clientID,
+		"trackID":       trackID,
+		"meetingID":     meeting.ID,
+		"spatialLayer":  spatial,
+		"temporalLayer": temporal,
+		"maxHeight":     maxHeight,
+	})
+}
+
+func clampLayer(layer, count int) int {
+	if layer < 0 || layer >= count {
+		return count - 1
+	}
+	return layer
+}
+
+// av1TemplateStructure is the part of the dependency descriptor template structure the SFU needs
+type av1TemplateStructure struct {
+	templateIDOffset int
+	spatial          []int // Spatial layer per template
+	temporal         []int // Temporal layer per template
+	heights          []int // Frame height per spatial layer, when present
+}
+
+// dependencyDescriptor holds the parsed fields of one dependency descriptor
+type dependencyDescriptor struct {
+	startOfFrame bool
+	endOfFrame   bool
+	spatial      int
+	temporal     int
+	structure    *av1TemplateStructure // Set when the packet carries a new template structure
+}
+
+var errDependencyDescriptor = errors.New("invalid dependency descriptor")
+
+// parseDependencyDescriptor parses the fields needed for layer selection
+// (AV1 RTP specification, appendix A). The template structure of the stream is
+// needed to map templates to layers; it is sent with keyframes.
+func parseDependencyDescriptor(data []byte, current *av1TemplateStructure) (dependencyDescriptor, error) {
+	r := &bitReader{data: data}
+	descriptor := dependencyDescriptor{
+		startOfFrame: r.readBits(1) == 1,
+		endOfFrame:   r.readBits(1) == 1,
+	}
+	templateID := int(r.readBits(6))
+	r.readBits(16) // frame_number
+
+	structure := current
+	if len(data) > 3 {
+		structurePresent := r.readBits(1) == 1
+		r.readBits(4) // active decode targets, custom dtis/fdiffs/chains flags
+		if structurePresent {
+			parsed, err := parseTemplateStructure(r)
+			if err != nil {
+				return descriptor, err
+			}
+			structure = parsed
+			descriptor.structure = parsed
+		}
+	}
+	if r.err != nil {
+		return descriptor, r.err
+	}
+	if structure == nil {
+		return descriptor, errDependencyDescriptor
+	}
+
+	index := (templateID + 64 - structure.templateIDOffset) % 64
+	if index >= len(structure.spatial) {
+		return descriptor, errDependencyDescriptor
+	}
+	descriptor.spatial = structure.spatial[index]
+	descriptor.temporal = structure.temporal[index]
+	return descriptor, nil
+}
+
+// parseTemplateStructure parses template_dependency_structure()
+func parseTemplateStructure(r *bitReader) (*av1TemplateStructure, error) {
+	structure := &av1TemplateStructure{templateIDOffset: int(r.readBits(6))}
+	decodeTargets := int(r.readBits(5)) + 1
+
+	// template_layers()
+	spatial, temporal, maxSpatial := 0, 0, 0
+	for {
+		structure.spatial = append(structure.spatial, spatial)
+		structure.temporal = append(structure.temporal, temporal)
+		nextLayer := r.readBits(2)
+		if nextLayer == 3 || r.err != nil {
+			break
+		}
+		if nextLayer == 1 {
+			temporal++
+		} else if nextLayer == 2 {
+			temporal = 0
+			spatial++
+			maxSpatial = spatial
+		}
+		if len(structure.spatial) >= 64 {
+			return nil, errDependencyDescriptor
+		}
+	}
+	templates := len(structure.spatial)
+
+	// template_dtis()
+	r.readBits(2 * templates * decodeTargets)
+
+	// template_fdiffs()
+	for i := 0; i < templates; i++ {
+		for r.readBits(1) == 1 && r.err == nil {
+			r.readBits(4)
+		}
+	}
+
+	// template_chains()
+	chains := r.readNonSymmetric(decodeTargets + 1)
+	if chains > 0 {
+		for i := 0; i < decodeTargets; i++ {
+			r.readNonSymmetric(chains)
+		}
+		r.readBits(4 * templates * chains)
+	}
+
+	// resolutions
+	if r.readBits(1) == 1 {
+		for s := 0; s <= maxSpatial; s++ {
+			r.readBits(16) // render_width_minus_1
+			structure.heights = append(structure.heights, int(r.readBits(16))+1)
+		}
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	return structure, nil
+}
+
+// bitReader reads MSB-first bit fields, recording the first overrun
+type bitReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *bitReader) readBits(n int) int {
+	value := 0
+	for i := 0; i < n; i++ {
+		if r.pos >= len(r.data)*8 {
+			r.err = errDependencyDescriptor
+			return 0
+		}
+		bit := (r.data[r.pos/8] >> (7 - uint(r.pos%8))) & 1
+		value = value<<1 | int(bit)
+		r.pos++
+	}
+	return value
+}
+
+// readNonSymmetric reads ns(n), the non-symmetric unsigned encoding of the spec
+func (r *bitReader) readNonSymmetric(n int) int {
+	w := 0
+	for x := n; x != 0; x >>= 1 {
+		w++
+	}
+	m := (1 << w) - n
+	v := r.readBits(w - 1)
+	if v < m {
+		return v
+	}
+	return (v << 1) - m + r.readBits(1)
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+// L1T3 keyframe: template_id 0, frame 1, template structure with offset 0, three decode
+// targets, templates T0 T0 T1 T2 T2, one chain and a 640x360 resolution.
+var ddL1T3Keyframe = []byte{
+	0xc0, 0x00, 0x01, 0x80, 0x02, 0x14, 0xea, 0xa8, 0xa0, 0x41,
+	0x4d, 0x14, 0x10, 0x20, 0x84, 0x27, 0x02, 0x7f, 0x01, 0x67,
+}
+
+// L3T3 keyframe: template_id 60, frame 100, template structure with offset 60, nine
+// decode targets, one template per S0-S2/T0-T2, three chains and 320x180, 640x360 and
+// 1280x720 resolutions.
+var ddL3T3Keyframe = []byte{
+	0xfc, 0x00, 0x64, 0x87, 0x88, 0x59, 0x65, 0xea, 0xaa, 0xa2,
+	0xaa, 0xa8, 0x2a, 0xaa, 0x02, 0xaa, 0x80, 0x2a, 0xa0, 0x02,
+	0xa8, 0x00, 0x2a, 0x00, 0x02, 0x80, 0x00, 0x20, 0x03, 0x15,
+	0x7e, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x10, 0x13, 0xf0, 0x0b, 0x30, 0x27,
+	0xf0, 0x16, 0x70, 0x4f, 0xf0, 0x2c, 0xf0,
+}
+
+func mustParseStructure(t *testing.T, data []byte) *av1TemplateStructure {
+	t.Helper()
+	descriptor, err := parseDependencyDescriptor(data, nil)
+	if err != nil || descriptor.structure == nil {
+		t.Fatalf("keyframe descriptor: structure=%v err=%v", descriptor.structure, err)
+	}
+	return descriptor.structure
+}
+
+func TestParseDependencyDescriptor(t *testing.T) {
+	l1t3 := mustParseStructure(t, ddL1T3Keyframe)
+	l3t3 := mustParseStructure(t, ddL3T3Keyframe)
+
+	tests := []struct {
+		name      string
+		data      []byte
+		current   *av1TemplateStructure
+		want      dependencyDescriptor
+		structure bool
+		heights   []int
+	}{
+		{
+			name:      "L1T3 keyframe with structure",
+			data:      ddL1T3Keyframe,
+			want:      dependencyDescriptor{startOfFrame: true, endOfFrame: true},
+			structure: true,
+			heights:   []int{360},
+		},
+		{
+			name:    "L1T3 T0 delta frame",
+			data:    []byte{0x81, 0x00, 0x02},
+			current: l1t3,
+			want:    dependencyDescriptor{startOfFrame: true, temporal: 0},
+		},
+		{
+			name:    "L1T3 T1 frame",
+			data:    []byte{0x82, 0x00, 0x02},
+			current: l1t3,
+			want:    dependencyDescriptor{startOfFrame: true, temporal: 1},
+		},
+		{
+			name:    "L1T3 T2 frame",
+			data:    []byte{0x83, 0x00, 0x02},
+			current: l1t3,
+			want:    dependencyDescriptor{startOfFrame: true, temporal: 2},
+		},
+		{
+			name:      "L3T3 keyframe with structure",
+			data:      ddL3T3Keyframe,
+			want:      dependencyDescriptor{startOfFrame: true, endOfFrame: true},
+			structure: true,
+			heights:   []int{180, 360, 720},
+		},
+		{
+			name:    "L3T3 S1T2 without structure, template ID wraps around",
+			data:    []byte{0x41, 0x00, 0x65},
+			current: l3t3,
+			want:    dependencyDescriptor{endOfFrame: true, spatial: 1, temporal: 2},
+		},
+		{
+			name:    "L3T3 S2T0 without structure",
+			data:    []byte{0x82, 0x00, 0x65},
+			current: l3t3,
+			want:    dependencyDescriptor{startOfFrame: true, spatial: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDependencyDescriptor(tt.data, tt.current)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (got.structure != nil) != tt.structure {
+				t.Fatalf("structure present = %v, want %v", got.structure != nil, tt.structure)
+			}
+			if got.structure != nil {
+				if len(got.structure.heights) != len(tt.heights) {
+					t.Fatalf("heights = %v, want %v", got.structure.heights, tt.heights)
+				}
+				for i := range tt.heights {
+					if got.structure.heights[i] != tt.heights[i] {
+						t.Fatalf("heights = %v, want %v", got.structure.heights, tt.heights)
+					}
+				}
+			}
+			got.structure = nil
+			if got != tt.want {
+				t.Fatalf("descriptor = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDependencyDescriptorErrors(t *testing.T) {
+	l1t3 := mustParseStructure(t, ddL1T3Keyframe)
+
+	t.Run("delta frame before any structure", func(t *testing.T) {
+		if _, err := parseDependencyDescriptor([]byte{0x83, 0x00, 0x02}, nil); err == nil {
+			t.Fatal("expected an error without a template structure")
+		}
+	})
+
+	t.Run("template outside the structure", func(t *testing.T) {
+		// template_id 9 maps to index 9 of a structure with five templates
+		if _, err := parseDependencyDescriptor([]byte{0x89, 0x00, 0x02}, l1t3); err == nil {
+			t.Fatal("expected an error for an unknown template")
+		}
+	})
+
+	for _, keyframe := range [][]byte{ddL1T3Keyframe, ddL3T3Keyframe} {
+		for n := 0; n < len(keyframe); n++ {
+			if _, err := parseDependencyDescriptor(keyframe[:n], nil); err == nil {
+				t.Errorf("%d of %d keyframe bytes parsed without error", n, len(keyframe))
+			}
+		}
+	}
+}
+
+func TestReadNonSymmetric(t *testing.T) {
+	tests := []struct {
+		n    int
+		data []byte
+		bits int
+	}{
+		// ns(5): 00 01 10 110 111
+		{n: 5, data: []byte{0x1b, 0x70}, bits: 12},
+		// ns(10): 000 001 010 011 100 101 1100 1101 1110 1111
+		{n: 10, data: []byte{0x05, 0x39, 0x73, 0x7b, 0xc0}, bits: 34},
+	}
+
+	for _, tt := range tests {
+		r := &bitReader{data: tt.data}
+		for want := 0; want < tt.n; want++ {
+			if got := r.readNonSymmetric(tt.n); got != want {
+				t.Fatalf("ns(%d) value %d decoded as %d", tt.n, want, got)
+			}
+		}
+		if r.err != nil || r.pos != tt.bits {
+			t.Fatalf("ns(%d) consumed %d bits (err %v), want %d", tt.n, r.pos, r.err, tt.bits)
+		}
+	}
+
+	// ns(1) has a single value and takes no bits
+	r := &bitReader{}
+	if got := r.readNonSymmetric(1); got != 0 || r.err != nil || r.pos != 0 {
+		t.Fatalf("ns(1) = %d, pos %d, err %v", got, r.pos, r.err)
+	}
+}
+
+func TestSVCLayersParseDependencyDescriptor(t *testing.T) {
+	const extID = 5
+	layers := newSVCLayers(webrtc.MimeTypeAV1, false)
+	layers.setExtensionID(extID)
+
+	packet := func(descriptor []byte, marker bool) *rtp.Packet {
+		p := &rtp.Packet{Header: rtp.Header{Marker: marker}, Payload: []byte{0}}
+		if err := p.SetExtension(extID, descriptor); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	info, _ := layers.parse(packet(ddL3T3Keyframe, true))
+	if !info.keyframe || info.spatial != 0 || info.temporal != 0 {
+		t.Fatalf("keyframe info = %+v", info)
+	}
+	if height := layers.spatialLayerHeight(2); height != 720 {
+		t.Fatalf("S2 height = %d, want 720", height)
+	}
+
+	info, _ = layers.parse(packet([]byte{0x41, 0x00, 0x65}, true))
+	if info.keyframe || info.spatial != 1 || info.temporal != 2 || info.startOfFrame || !info.endOfFrame {
+		t.Fatalf("S1T2 info = %+v", info)
+	}
+
+	// A new publisher resets the structure until its next keyframe
+	layers.setExtensionID(extID)
+	info, _ = layers.parse(packet([]byte{0x41, 0x00, 0x65}, true))
+	if info.spatial != 0 || info.temporal != 0 {
+		t.Fatalf("packet without a known structure = %+v, want base layer", info)
+	}
+}
+
+// picture returns the packets of one L3T3 picture up to the given spatial layer
+func picture(spatial, temporal int, keyframe, switchUp bool) []svcPacketInfo {
+	packets := make([]svcPacketInfo, 0, spatial+1)
+	for s := 0; s <= spatial; s++ {
+		packets = append(packets, svcPacketInfo{
+			spatial:      s,
+			temporal:     temporal,
+			startOfFrame: true,
+			endOfFrame:   true,
+			keyframe:     keyframe && s == 0,
+			switchUp:     switchUp,
+		})
+	}
+	return packets
+}
+
+// forwarded returns the spatial layers of a picture the selector lets through
+func forwarded(s *svcSelector, packets []svcPacketInfo) []int {
+	var layers []int
+	for _, info := range packets {
+		if s.accept(info) {
+			layers = append(layers, info.spatial)
+		}
+	}
+	return layers
+}
+
+func equalLayers(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSVCSelectorSpatialSwitching(t *testing.T) {
+	layers := newSVCLayers(webrtc.MimeTypeVP9, false)
+	s := newSVCSelector()
+	s.maxSpatial = 2
+	s.maxTemporal = 2
+	if s.selectLayers(layers) {
+		t.Fatal("no keyframe request expected before the first keyframe")
+	}
+
+	// Nothing is forwarded until a keyframe
+	if got := forwarded(s, picture(2, 0, false, true)); got != nil {
+		t.Fatalf("forwarded %v before a keyframe", got)
+	}
+	if got := forwarded(s, picture(2, 0, true, true)); !equalLayers(got, []int{0, 1, 2}) {
+		t.Fatalf("keyframe forwarded %v, want [0 1 2]", got)
+	}
+
+	// Stepping down takes effect at the next picture, not within the current one
+	s.maxSpatial = 1
+	if s.selectLayers(layers) {
+		t.Fatal("stepping down must not request a keyframe")
+	}
+	midPicture := svcPacketInfo{spatial: 2, temporal: 0, endOfFrame: true}
+	if !s.accept(midPicture) {
+		t.Fatal("rest of the current picture was dropped after stepping down")
+	}
+	if got := forwarded(s, picture(2, 0, false, true)); !equalLayers(got, []int{0, 1}) {
+		t.Fatalf("after stepping down forwarded %v, want [0 1]", got)
+	}
+	if !s.endsPicture(svcPacketInfo{spatial: 1, endOfFrame: true}) || s.endsPicture(svcPacketInfo{spatial: 0, endOfFrame: true}) {
+		t.Fatal("end of picture must follow the highest forwarded spatial layer")
+	}
+
+	// Stepping up waits for a keyframe
+	s.maxSpatial = 2
+	if !s.selectLayers(layers) {
+		t.Fatal("stepping up must request a keyframe")
+	}
+	if got := forwarded(s, picture(2, 0, false, true)); !equalLayers(got, []int{0, 1}) {
+		t.Fatalf("delta frame after stepping up forwarded %v, want [0 1]", got)
+	}
+	if got := forwarded(s, picture(2, 0, true, true)); !equalLayers(got, []int{0, 1, 2}) {
+		t.Fatalf("keyframe after stepping up forwarded %v, want [0 1 2]", got)
+	}
+}
+
+func TestSVCSelectorTemporalSwitching(t *testing.T) {
+	layers := newSVCLayers(webrtc.MimeTypeVP9, false)
+	s := newSVCSelector()
+	s.maxSpatial = 0
+	s.maxTemporal = 2
+	s.selectLayers(layers)
+	forwarded(s, picture(0, 0, true, true))
+
+	if got := forwarded(s, picture(0, 2, false, false)); got == nil {
+		t.Fatal("T2 dropped while receiving all temporal layers")
+	}
+
+	// Stepping down applies at the next picture start
+	s.maxTemporal = 0
+	s.selectLayers(layers)
+	if got := forwarded(s, picture(0, 1, false, false)); got != nil {
+		t.Fatal("T1 forwarded after limiting to T0")
+	}
+	if got := forwarded(s, picture(0, 0, false, false)); got == nil {
+		t.Fatal("T0 dropped after limiting to T0")
+	}
+
+	// Stepping up waits for a switching point
+	s.maxTemporal = 2
+	s.selectLayers(layers)
+	if got := forwarded(s, picture(0, 2, false, false)); got != nil {
+		t.Fatal("T2 forwarded before a switching point")
+	}
+	if got := forwarded(s, picture(0, 1, false, true)); got == nil {
+		t.Fatal("T1 dropped at a switching point")
+	}
+	if got := forwarded(s, picture(0, 2, false, false)); got == nil {
+		t.Fatal("T2 dropped after switching up")
+	}
+}
+
+func TestSVCSelectorAdjustForLoss(t *testing.T) {
+	layers := newSVCLayers(webrtc.MimeTypeVP9, false)
+	for sl := 0; sl < 3; sl++ {
+		for tl := 0; tl < 3; tl++ {
+			layers.layerBitrates[sl][tl] = uint64(100_000 * (sl + 1))
+		}
+	}
+
+	s := newSVCSelector()
+	s.maxSpatial = 2
+	s.maxTemporal = 2
+	if s.adjustForLoss(layers, 255) {
+		t.Fatal("loss before the first keyframe must be ignored")
+	}
+	s.selectLayers(layers)
+	forwarded(s, picture(2, 0, true, true))
+
+	// Heavy loss drops below the current rate
+	full := layers.cumulativeBitrate(2, 2)
+	s.adjustForLoss(layers, 64)
+	if s.bandwidth != full*85/100 {
+		t.Fatalf("bandwidth = %d, want %d", s.bandwidth, full*85/100)
+	}
+	if s.targetSpatial == 2 && s.targetTemporal == 2 {
+		t.Fatal("target layers unchanged after heavy loss")
+	}
+	if layers.cumulativeBitrate(s.targetSpatial, s.targetTemporal) > s.bandwidth {
+		t.Fatalf("target S%dT%d exceeds the estimate", s.targetSpatial, s.targetTemporal)
+	}
+
+	// Moderate loss keeps the estimate, low loss lets it grow
+	bandwidth := s.bandwidth
+	s.adjustForLoss(layers, (svcLossDecreaseFraction+svcLossIncreaseFraction)/2)
+	if s.bandwidth != bandwidth {
+		t.Fatal("moderate loss changed the estimate")
+	}
+	s.adjustForLoss(layers, 0)
+	if s.bandwidth != bandwidth*108/100 {
+		t.Fatalf("bandwidth = %d, want %d", s.bandwidth, bandwidth*108/100)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/pion/ice/v2"
+	"github.com/pion/interceptor"
+	"github.com/pion/webrtc/v3"
+)
+
+// webrtcAPI is shared by every PeerConnection so they all use the same ICE transport settings
+var webrtcAPI *webrtc.API
+
+// initWebRTC builds the SettingEngine from the configuration and creates the shared API
+func initWebRTC() {
+	sfuLogger.Info("WEBRTC", "Configuring ICE transport", map[string]interface{}{
+		"udpMuxPort":    C.ICEUDPMuxPort,
+		"portRange":     []int{C.ICEPortMin, C.ICEPortMax},
+		"tcpPort":       C.ICETCPPort,
+		"nat1To1IPs":    C.NAT1To1IPs,
+		"interfaces":    C.ICEInterfaces,
+		"allowedNets":   C.ICEAllowedNetworks,
+		"mdnsMode":      C.ICEMDNSMode,
+		"stunServerCnt": len(C.ICEServers),
+	})
+
+	settingEngine, err := newSettingEngine()
+	if err != nil {
+		sfuLogger.Error("WEBRTC", "Invalid ICE transport configuration", err, nil)
+		sfuState.IncrementCounters(0, 0, 1)
+		panic(fmt.Sprintf("Invalid ICE transport configuration: %v", err))
+	}
+
+	mediaEngine, err := newMediaEngine()
+	if err != nil {
+		sfuLogger.Error("WEBRTC", "Invalid codec configuration", err, nil)
+		sfuState.IncrementCounters(0, 0, 1)
+		panic(fmt.Sprintf("Invalid codec configuration: %v", err))
+	}
+	sfuLogger.Info("WEBRTC", "Media engine configured", map[string]interface{}{
+		"audioCodecs": len(registeredCodecs[webrtc.RTPCodecTypeAudio]),
+		"videoCodecs": len(registeredCodecs[webrtc.RTPCodecTypeVideo]),
+		"videoRTX":    C.VideoRTX,
+	})
+
+	// Keep the interceptors (NACK, RTCP reports, TWCC) webrtc.NewPeerConnection would register
+	interceptorRegistry := &interceptor.Registry{}
+	if err := webrtc.RegisterDefaultInterceptors(mediaEngine, interceptorRegistry); err != nil {
+		panic(fmt.Sprintf("Error registering default interceptors: %v", err))
+	}
+
+	webrtcAPI = webrtc.NewAPI(
+		webrtc.WithSettingEngine(settingEngine),
+		webrtc.WithMediaEngine(mediaEngine),
+		webrtc.WithInterceptorRegistry(interceptorRegistry),
+	)
+	sfuLogger.Info("WEBRTC", "ICE transport configured", nil)
+}
+
+// newSettingEngine translates the ICE options in Config into a webrtc.SettingEngine
+func newSettingEngine() (webrtc.SettingEngine, error) {
+	settingEngine := webrtc.SettingEngine{}
+
+	networkTypes := []webrtc.NetworkType{webrtc.NetworkTypeUDP4, webrtc.NetworkTypeUDP6}
+
+	if C.ICEUDPMuxPort > 0 {
+		udpConn, err := net.ListenUDP("udp", &net.UDPAddr{Port: C.ICEUDPMuxPort})
+		if err != nil {
+			return settingEngine, fmt.Errorf("listening on ICE UDP mux port %d: %w", C.ICEUDPMuxPort, err)
+		}
+		settingEngine.SetICEUDPMux(webrtc.NewICEUDPMux(nil, udpConn))
+		sfuLogger.Info("WEBRTC", "ICE UDP mux listening", map[string]interface{}{
+			"localAddr": udpConn.LocalAddr().String(),
+		})
+	} else if C.ICEPortMin > 0 || C.ICEPortMax > 0 {
+		if C.ICEPortMin <= 0 || C.ICEPortMax > 65535 || C.ICEPortMin > C.ICEPortMax {
+			return settingEngine, fmt.Errorf("invalid ICE port range %d-%d", C.ICEPortMin, C.ICEPortMax)
+		}
+		if err := settingEngine.SetEphemeralUDPPortRange(uint16(C.ICEPortMin), uint16(C.ICEPortMax)); err != nil {
+			return settingEngine, err
+		}
+	}
+
+	if C.ICETCPPort > 0 {
+		tcpListener, err := net.ListenTCP("tcp", &net.TCPAddr{Port: C.ICETCPPort})
+		if err != nil {
+			return settingEngine, fmt.Errorf("listening on ICE TCP port %d: %w", C.ICETCPPort, err)
+		}
+		settingEngine.SetICETCPMux(webrtc.NewICETCPMux(nil, tcpListener, 8))
+		networkTypes = append(networkTypes, webrtc.NetworkTypeTCP4, webrtc.NetworkTypeTCP6)
+		sfuLogger.Info("WEBRTC", "ICE TCP mux listening", map[string]interface{}{
+			"localAddr": tcpListener.Addr().String(),
+		})
+	}
+	settingEngine.SetNetworkTypes(networkTypes)
+
+	if len(C.NAT1To1IPs) > 0 {
+		candidateType := webrtc.ICECandidateTypeHost
+		switch strings.ToLower(C.NAT1To1CandidateType) {
+		case "host":
+		case "srflx":
+			candidateType = webrtc.ICECandidateTypeSrflx
+		default:
+			return settingEngine, fmt.Errorf("invalid NAT 1:1 candidate type %q", C.NAT1To1CandidateType)
+		}
+		settingEngine.SetNAT1To1IPs(C.NAT1To1IPs, candidateType)
+	}
+
+	if len(C.ICEInterfaces) > 0 {
+		allowed := make(map[string]bool, len(C.ICEInterfaces))
+		for _, name := range C.ICEInterfaces {
+			allowed[name] = true
+		}
+		settingEngine.SetInterfaceFilter(func(name string) bool {
+			return allowed[name]
+		})
+	}
+
+	if len(C.ICEAllowedNetworks) > 0 {
+		networks := make([]*net.IPNet, 0, len(C.ICEAllowedNetworks))
+		for _, cidr := range C.ICEAllowedNetworks {
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return settingEngine, fmt.Errorf("invalid ICE allowed network %q: %w", cidr, err)
+			}
+			networks = append(networks, network)
+		}
+		settingEngine.SetIPFilter(func(ip net.IP) bool {
+			for _, network := range networks {
+				if network.Contains(ip) {
+					return true
+				}
+			}
+			return false
+		})
+	}
+
+	switch strings.ToLower(C.ICEMDNSMode) {
+	case "disabled":
+		settingEngine.SetICEMulticastDNSMode(ice.MulticastDNSModeDisabled)
+	case "query", "":
+		settingEngine.SetICEMulticastDNSMode(ice.MulticastDNSModeQueryOnly)
+	case "gather":
+		settingEngine.SetICEMulticastDNSMode(ice.MulticastDNSModeQueryAndGather)
+	default:
+		return settingEngine, fmt.Errorf("invalid mDNS mode %q", C.ICEMDNSMode)
+	}
+
+	return settingEngine, nil
+}
+
+// peerConnectionConfig returns the configuration used for every PeerConnection
+func peerConnectionConfig() webrtc.Configuration {
+	return webrtc.Configuration{
+		ICEServers: C.ICEServers,
+	}
+}
+
+// newPeerConnection creates a PeerConnection through the shared API
+func newPeerConnection() (*webrtc.PeerConnection, error) {
+	return webrtcAPI.NewPeerConnection(peerConnectionConfig())
+}
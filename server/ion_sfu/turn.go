@@ -0,0 +1,260 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/turn/v2"
+	"github.com/pion/webrtc/v3"
+)
+
+// turnServer is the embedded TURN server, nil when disabled
+var turnServer *turn.Server
+
+// TURN usage counters, copied into SFUMetrics on every heartbeat
+var (
+	turnActiveAllocations int64
+	turnTotalAllocations  int64
+	turnAuthFailures      int64
+	turnBytesRelayed      int64
+)
+
+// initTURN starts the embedded TURN server when it is enabled in the configuration
+func initTURN() {
+	if !C.TURNEnabled {
+		sfuLogger.Info("TURN", "Embedded TURN server disabled", nil)
+		return
+	}
+
+	server, err := newTURNServer()
+	if err != nil {
+		sfuLogger.Error("TURN", "Error starting embedded TURN server", err, nil)
+		sfuState.IncrementCounters(0, 0, 1)
+		panic(fmt.Sprintf("Error starting embedded TURN server: %v", err))
+	}
+	turnServer = server
+
+	sfuLogger.Info("TURN", "Embedded TURN server started", map[string]interface{}{
+		"udpPort":       C.TURNPort,
+		"tcpPort":       C.TURNTCPPort,
+		"tlsPort":       C.TURNTLSPort,
+		"realm":         C.TURNRealm,
+		"relayAddress":  turnRelayAddress(),
+		"relayPorts":    []int{C.TURNRelayPortMin, C.TURNRelayPortMax},
+		"credentialTTL": C.TURNCredentialTTL.String(),
+	})
+}
+
+// newTURNServer opens the configured listeners and creates the pion/turn server
+func newTURNServer() (*turn.Server, error) {
+	if C.TURNSecret == "" {
+		return nil, fmt.Errorf("SFU_TURN_SECRET must be set when the TURN server is enabled")
+	}
+
+	relayIP := net.ParseIP(turnRelayAddress())
+	if relayIP == nil {
+		return nil, fmt.Errorf("invalid TURN relay address %q, set SFU_TURN_PUBLIC_IP", turnRelayAddress())
+	}
+	if C.TURNRelayPortMin <= 0 || C.TURNRelayPortMax > 65535 || C.TURNRelayPortMin > C.TURNRelayPortMax {
+		return nil, fmt.Errorf("invalid TURN relay port range %d-%d", C.TURNRelayPortMin, C.TURNRelayPortMax)
+	}
+
+	newRelayGenerator := func() turn.RelayAddressGenerator {
+		return &countingRelayAddressGenerator{
+			RelayAddressGenerator: &turn.RelayAddressGeneratorPortRange{
+				RelayAddress: relayIP,
+				Address:      "0.0.0.0",
+				MinPort:      uint16(C.TURNRelayPortMin),
+				MaxPort:      uint16(C.TURNRelayPortMax),
+			},
+		}
+	}
+
+	config := turn.ServerConfig{
+		Realm:       C.TURNRealm,
+		AuthHandler: turnAuthHandler,
+	}
+
+	if C.TURNPort > 0 {
+		udpConn, err := net.ListenPacket("udp4", fmt.Sprintf("0.0.0.0:%d", C.TURNPort))
+		if err != nil {
+			return nil, fmt.Errorf("listening on TURN UDP port %d: %w", C.TURNPort, err)
+		}
+		config.PacketConnConfigs = append(config.PacketConnConfigs, turn.PacketConnConfig{
+			PacketConn:            udpConn,
+			RelayAddressGenerator: newRelayGenerator(),
+		})
+	}
+
+	if C.TURNTCPPort > 0 {
+		tcpListener, err := net.Listen("tcp4", fmt.Sprintf("0.0.0.0:%d", C.TURNTCPPort))
+		if err != nil {
+			return nil, fmt.Errorf("listening on TURN TCP port %d: %w", C.TURNTCPPort, err)
+		}
+		config.ListenerConfigs = append(config.ListenerConfigs, turn.ListenerConfig{
+			Listener:              tcpListener,
+			RelayAddressGenerator: newRelayGenerator(),
+		})
+	}
+
+	if C.TURNTLSPort > 0 {
+		cert, err := tls.LoadX509KeyPair(C.TURNTLSCertFile, C.TURNTLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading TURN TLS certificate: %w", err)
+		}
+		tlsListener, err := tls.Listen("tcp4", fmt.Sprintf("0.0.0.0:%d", C.TURNTLSPort), &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{cert},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("listening on TURN TLS port %d: %w", C.TURNTLSPort, err)
+		}
+		config.ListenerConfigs = append(config.ListenerConfigs, turn.ListenerConfig{
+			Listener:              tlsListener,
+			RelayAddressGenerator: newRelayGenerator(),
+		})
+	}
+
+	return turn.NewServer(config)
+}
+
+// turnRelayAddress is the public IP handed out for relayed candidates
+func turnRelayAddress() string {
+	if C.TURNPublicIP != "" {
+		return C.TURNPublicIP
+	}
+	if len(C.NAT1To1IPs) > 0 {
+		return C.NAT1To1IPs[0]
+	}
+	return ""
+}
+
+// turnCredentials issues REST-style ephemeral credentials for a client:
+// the username is "<expiry unix time>:<clientID>" and the password is
+// base64(HMAC-SHA1(secret, username))
+func turnCredentials(clientID string) (string, string) {
+	expiry := time.Now().Add(C.TURNCredentialTTL).Unix()
+	username := strconv.FormatInt(expiry, 10) + ":" + clientID
+	return username, turnPassword(username)
+}
+
+func turnPassword(username string) string {
+	mac := hmac.New(sha1.New, []byte(C.TURNSecret))
+	mac.Write([]byte(username))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// turnAuthHandler validates ephemeral credentials issued by turnCredentials
+func turnAuthHandler(username, realm string, srcAddr net.Addr) ([]byte, bool) {
+	expiryPart := username
+	if i := strings.Index(username, ":"); i >= 0 {
+		expiryPart = username[:i]
+	}
+
+	expiry, err := strconv.ParseInt(expiryPart, 10, 64)
+	if err != nil || time.Now().Unix() > expiry {
+		atomic.AddInt64(&turnAuthFailures, 1)
+		sfuLogger.Warn("TURN", "Rejected TURN credentials", map[string]interface{}{
+			"username": username,
+			"srcAddr":  srcAddr.String(),
+			"expired":  err == nil,
+		})
+		return nil, false
+	}
+
+	return turn.GenerateAuthKey(username, realm, turnPassword(username)), true
+}
+
+// clientICEServers returns the ICE servers a client should use, including
+// TURN with fresh credentials when the embedded server is running
+func clientICEServers(clientID string) []webrtc.ICEServer {
+	iceServers := append([]webrtc.ICEServer{}, C.ICEServers...)
+	if turnServer == nil {
+		return iceServers
+	}
+
+	host := C.TURNHost
+	if host == "" {
+		host = turnRelayAddress()
+	}
+
+	var urls []string
+	if C.TURNPort > 0 {
+		urls = append(urls, fmt.Sprintf("turn:%s:%d?transport=udp", host, C.TURNPort))
+	}
+	if C.TURNTCPPort > 0 {
+		urls = append(urls, fmt.Sprintf("turn:%s:%d?transport=tcp", host, C.TURNTCPPort))
+	}
+	if C.TURNTLSPort > 0 {
+		urls = append(urls, fmt.Sprintf("turns:%s:%d?transport=tcp", host, C.TURNTLSPort))
+	}
+
+	username, password := turnCredentials(clientID)
+	return append(iceServers, webrtc.ICEServer{
+		URLs:           urls,
+		Username:       username,
+		Credential:     password,
+		CredentialType: webrtc.ICECredentialTypePassword,
+	})
+}
+
+// collectTURNMetrics copies the TURN usage counters into the SFU metrics
+func collectTURNMetrics(metrics *SFUMetrics) {
+	metrics.TURNActiveAllocations = atomic.LoadInt64(&turnActiveAllocations)
+	metrics.TURNTotalAllocations = atomic.LoadInt64(&turnTotalAllocations)
+	metrics.TURNAuthFailures = atomic.LoadInt64(&turnAuthFailures)
+	metrics.TURNBytesRelayed = atomic.LoadInt64(&turnBytesRelayed)
+}
+
+// countingRelayAddressGenerator wraps relay sockets so allocations and relayed bytes are counted
+type countingRelayAddressGenerator struct {
+	turn.RelayAddressGenerator
+}
+
+func (g *countingRelayAddressGenerator) AllocatePacketConn(network string, requestedPort int) (net.PacketConn, net.Addr, error) {
+	conn, addr, err := g.RelayAddressGenerator.AllocatePacketConn(network, requestedPort)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	atomic.AddInt64(&turnActiveAllocations, 1)
+	atomic.AddInt64(&turnTotalAllocations, 1)
+	sfuLogger.Debug("TURN", "Relay allocated", map[string]interface{}{
+		"relayAddr": addr.String(),
+	})
+	return &countingPacketConn{PacketConn: conn}, addr, nil
+}
+
+// countingPacketConn counts bytes relayed through an allocation
+type countingPacketConn struct {
+	net.PacketConn
+	closeOnce sync.Once
+}
+
+func (c *countingPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	n, addr, err := c.PacketConn.ReadFrom(p)
+	atomic.AddInt64(&turnBytesRelayed, int64(n))
+	return n, addr, err
+}
+
+func (c *countingPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	n, err := c.PacketConn.WriteTo(p, addr)
+	atomic.AddInt64(&turnBytesRelayed, int64(n))
+	return n, err
+}
+
+func (c *countingPacketConn) Close() error {
+	c.closeOnce.Do(func() {
+		atomic.AddInt64(&turnActiveAllocations, -1)
+	})
+	return c.PacketConn.Close()
+}
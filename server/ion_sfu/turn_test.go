@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/turn/v2"
+)
+
+func TestTURNAuthHandler(t *testing.T) {
+	C.TURNSecret = "turn-test-secret"
+	C.TURNCredentialTTL = time.Hour
+	const realm = "sfu"
+	srcAddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 50000}
+
+	username, password := turnCredentials("client-1")
+
+	t.Run("valid", func(t *testing.T) {
+		key, ok := turnAuthHandler(username, realm, srcAddr)
+		if !ok {
+			t.Fatal("fresh credentials were rejected")
+		}
+		if want := turn.GenerateAuthKey(username, realm, password); string(key) != string(want) {
+			t.Fatal("auth key does not match the issued password")
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		expired := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10) + ":client-1"
+		if _, ok := turnAuthHandler(expired, realm, srcAddr); ok {
+			t.Fatal("expired credentials were accepted")
+		}
+	})
+
+	t.Run("malformed expiry", func(t *testing.T) {
+		for _, name := range []string{"client-1", "soon:client-1", ":client-1", ""} {
+			if _, ok := turnAuthHandler(name, realm, srcAddr); ok {
+				t.Errorf("username %q was accepted", name)
+			}
+		}
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		// Extending the expiry or swapping the client changes the HMAC, so the
+		// issued password no longer produces the key the server expects
+		_, clientID, _ := strings.Cut(username, ":")
+		tampered := []string{
+			strconv.FormatInt(time.Now().Add(48*time.Hour).Unix(), 10) + ":" + clientID,
+			strings.Replace(username, "client-1", "client-2", 1),
+		}
+		for _, name := range tampered {
+			key, ok := turnAuthHandler(name, realm, srcAddr)
+			if !ok {
+				continue
+			}
+			if string(key) == string(turn.GenerateAuthKey(name, realm, password)) {
+				t.Errorf("tampered username %q authenticates with the issued password", name)
+			}
+		}
+	})
+
+	t.Run("other secret", func(t *testing.T) {
+		C.TURNSecret = "rotated-secret"
+		defer func() { C.TURNSecret = "turn-test-secret" }()
+		key, ok := turnAuthHandler(username, realm, srcAddr)
+		if ok && string(key) == string(turn.GenerateAuthKey(username, realm, password)) {
+			t.Fatal("credentials issued under another secret were accepted")
+		}
+	})
+}
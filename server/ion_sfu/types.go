@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"sync"
 	"time"
 
@@ -36,18 +37,21 @@ type WebRTCSignalPayload struct {
 }
 
 type SFUSignalToClientPayload struct {
-	TargetClientID string      `json:"targetClientId"`
-	SignalType     string      `json:"signalType"` // "offer", "answer", "candidate"
-	SDP            string      `json:"sdp,omitempty"`
-	Candidate      interface{} `json:"candidate,omitempty"`
-	MeetingID      string      `json:"meetingId"`
-	ReplyTo        string      `json:"replyTo"`
+	TargetClientID string             `json:"targetClientId"`
+	SignalType     string             `json:"signalType"` // "offer", "answer", "candidate", "iceServers"
+	SDP            string             `json:"sdp,omitempty"`
+	Candidate      interface{}        `json:"candidate,omitempty"`
+	ICEServers     []webrtc.ICEServer `json:"iceServers,omitempty"`
+	MeetingID      string             `json:"meetingId"`
+	ReplyTo        string             `json:"replyTo"`
 }
 
 type SFUMeetingEventPayload struct {
 	MeetingID string      `json:"meetingId"`
 	EventType string      `json:"eventType"`
 	EventData interface{} `json:"eventData"`
+	SFUID     string      `json:"sfuId,omitempty"`     // Set on the meeting events topic
+	Timestamp int64       `json:"timestamp,omitempty"` // Unix milliseconds, set on the meeting events topic
 }
 
 // Command structure for Redis messages from signaling server
@@ -55,6 +59,20 @@ type SFUCommand struct {
 	Type    string                 `json:"type"`
 	ReplyTo string                 `json:"replyTo,omitempty"` // The Kafka topic to send responses to
 	Payload map[string]interface{} `json:"payload"`
+
+	issuer string // Verified issuer of the command's envelope ("" = unsigned or not verified)
+}
+
+// CommandEnvelope wraps an SFUCommand on sfu_commands with its issuer's signature.
+// The signature covers the target SFU, issuer, timestamp, nonce and the exact command bytes.
+type CommandEnvelope struct {
+	Issuer    string          `json:"issuer"`
+	KeyID     string          `json:"kid,omitempty"`
+	Algorithm string          `json:"alg"`       // "HS256", "RS256" or "EdDSA"
+	Timestamp int64           `json:"timestamp"` // Unix milliseconds
+	Nonce     string          `json:"nonce"`
+	Command   json.RawMessage `json:"command"`
+	Signature string          `json:"signature"` // base64url
 }
 
 // SFUMetrics represents the current load/status of this SFU instance
@@ -62,6 +80,15 @@ type SFUMetrics struct {
 	ConnectedClients int64 `json:"connected_clients"`
 	ActiveMeetings   int64 `json:"active_meetings"`
 	LastHeartbeat    int64 `json:"last_heartbeat"` // Unix timestamp
+	// Embedded TURN server usage
+	TURNActiveAllocations int64 `json:"turn_active_allocations"`
+	TURNTotalAllocations  int64 `json:"turn_total_allocations"`
+	TURNAuthFailures      int64 `json:"turn_auth_failures"`
+	TURNBytesRelayed      int64 `json:"turn_bytes_relayed"`
+	// Kafka commands refused by envelope authentication
+	CommandsRejected int64 `json:"commands_rejected"`
+	// Receive-only viewers of webinars on this SFU
+	Viewers int64 `json:"viewers"`
 	// Add more metrics like CPU, memory, bandwidth if needed
 }
 
@@ -69,26 +96,184 @@ type SFUMetrics struct {
 type Meeting struct {
 	ID              string
 	mu              sync.RWMutex
-	clients         map[string]*ClientPeer                 // Map<clientId, *ClientPeer>
-	trackLocals     map[string]*webrtc.TrackLocalStaticRTP // Map<trackID, *TrackLocalStaticRTP>
+	clients         map[string]*ClientPeer  // Map<clientId, *ClientPeer>
+	routers         map[string]*TrackRouter // Map<trackID, *TrackRouter>
 	createdAt       time.Time
 	status          string
 	maxParticipants int
+	leaseHeld       bool                  // True while this SFU owns the meeting:<id>:sfu claim in Redis
+	originSFUID     string                // Set when this SFU is an edge of a meeting owned by another SFU
+	relays          map[string]*RelayPeer // Map<relayId, *RelayPeer>
+	relayedTracks   map[string]string     // Map<trackID, relayId> for tracks received from other SFUs
+	relayedSources  map[string]string     // Map<trackID, source> announced by the SFU relaying the track
+	trackPublishers map[string]string     // Map<trackID, publisherID>
+	migration       *MeetingMigration     // Non-nil while (or after) the meeting moves to another SFU
+	allowedCodecs   map[string]bool       // Codec names allowed by prepareMeeting (nil = all configured)
+	e2ee            bool                  // Clients encrypt their media end to end; payloads are opaque to the SFU
+	breakoutRooms   map[string]string     // Map<roomID, name> of the open breakout rooms
+	roomAssignments map[string]string     // Map<clientID, roomID>; clients without one are in the main room
+	dataMessages    messageDeduper        // Data channel messages relayed here, to drop copies arriving over another relay
+
+	// Lobby
+	lobbyEnabled bool                   // Joining participants wait for a host to admit them
+	lobby        map[string]*LobbyEntry // Map<clientID, *LobbyEntry> of participants waiting to be admitted
+
+	maxScreenShares int  // Concurrent screen shares allowed by prepareMeeting (0 = MaxScreenShares)
+	webinar         bool // Few presenters, many receive-only viewers
+
+	egresses  map[string]*Egress   // Map<egressID, *Egress> of running RTP egresses
+	ingests   map[string]*Ingest   // Map<ingestID, *Ingest> of running RTP ingests
+	playbacks map[string]*Playback // Map<playbackID, *Playback> of media files being played
+}
+
+// joinOptions is how a client joins a meeting, taken from its clientJoined command
+type joinOptions struct {
+	replyTo      string // Kafka topic the client's signals are sent to
+	migratedFrom string // SFU a signed migration moved the client from ("" = fresh join)
+	mediaMode    string
+	role         string
+	joinToken    string // Verified join token, passed on when the meeting migrates
+}
+
+// LobbyEntry is a participant waiting in a meeting's lobby; it has no PeerConnection yet
+type LobbyEntry struct {
+	ClientID      string
+	options       joinOptions
+	authenticated bool // Joined with a verified join token
+	requestedAt   time.Time
+	timer         *time.Timer // Turns the participant away after LobbyTimeout
+}
+
+// DataChannelMessage is the JSON envelope relayed over client data channels.
+// From, MeetingID and Timestamp are always set by the SFU.
+type DataChannelMessage struct {
+	Type      string          `json:"type"` // "chat", "reaction", "app", "e2ee", or "error" from the SFU
+	ID        string          `json:"id,omitempty"`
+	From      string          `json:"from,omitempty"`
+	To        string          `json:"to,omitempty"` // Recipient of a directed message (empty = broadcast)
+	MeetingID string          `json:"meetingId,omitempty"`
+	Timestamp int64           `json:"timestamp,omitempty"` // Unix milliseconds
+	Data      json.RawMessage `json:"data,omitempty"`
+}
+
+// JoinTokenClaims are the claims of a join token issued by the auth service
+type JoinTokenClaims struct {
+	MeetingID string          `json:"meetingId"`
+	Subject   string          `json:"sub"` // User ID, equal to the client ID
+	Role      string          `json:"role"`
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt int64           `json:"exp"`
+	NotBefore int64           `json:"nbf"`
+	IssuedAt  int64           `json:"iat"`
+}
+
+// HistoryEntry is one stored chat or reaction message; ID is its Redis stream ID
+type HistoryEntry struct {
+	ID      string          `json:"id"`
+	Message json.RawMessage `json:"message"`
 }
 
+// MeetingMetadata is the roster snapshot published to Redis so other services can reconstruct meeting state
 type MeetingMetadata struct {
-	ID              string
-	Participants    []string
-	CreatedAt       time.Time
-	Status          string
-	MaxParticipants int
+	ID              string    `json:"id"`
+	SFUID           string    `json:"sfuId"`
+	Participants    []string  `json:"participants"`
+	CreatedAt       time.Time `json:"createdAt"`
+	Status          string    `json:"status"`
+	MaxParticipants int       `json:"maxParticipants"`
 }
 
 // ClientPeer represents a WebRTC peer connection for a client connected to this SFU
 type ClientPeer struct {
 	ID                string
 	MeetingID         string
+	ReplyTo           string // Kafka topic of the signaling server serving this client
+	MigratedFrom      string // Source SFU when this client reconnected here during a migration
 	PeerConnection    *webrtc.PeerConnection
 	mu                sync.Mutex                // Protects PeerConnection state
 	pendingCandidates []webrtc.ICECandidateInit // Buffer for ICE candidates received before remote description is set
+	reconnectTimer    *time.Timer               // Running while the peer is disconnected or failed
+	iceRestarts       int                       // SFU-initiated ICE restarts during the current outage
+	receiveCodecs     map[string]bool           // Codec keys the client offered, guarded by Meeting.mu
+	mediaMode         string                    // mediaModeFull, mediaModeAudioOnly or mediaModeThumbnail, guarded by Meeting.mu
+	dataChannel       *webrtc.DataChannel       // Negotiated "meeting" channel for chat, reactions and app messages
+	dataLimiter       *messageRateLimiter       // Rate limit for messages received on dataChannel
+	dataChannelOpen   chan struct{}             // Closed once dataChannel is open
+	role              string                    // roleHost, rolePresenter, roleAttendee or roleViewer, guarded by Meeting.mu
+	joinToken         string                    // Forwarded to the target SFU when the meeting migrates
+	trackSources      map[string]string         // Sources announced in offers by track or stream ID, guarded by Meeting.mu
+	allocator         *bandwidthAllocator       // Shares the bandwidth estimate among the client's SVC down tracks
+	renegotiate       bool                      // An SFU offer is due once signaling is stable again, guarded by mu
+
+	renegotiationPending int32     // A coalesced renegotiation is scheduled (webinar viewers)
+	joinedAt             time.Time // When the client joined this SFU
+}
+
+// RelayPeer is a server-to-server PeerConnection that forwards meeting tracks between SFUs.
+// The origin side (Outbound) always sends the offers; the edge side answers and publishes
+// the received tracks into its Meeting.routers.
+type RelayPeer struct {
+	ID                string
+	MeetingID         string
+	RemoteSFUID       string
+	Outbound          bool
+	PeerConnection    *webrtc.PeerConnection
+	mu                sync.Mutex
+	forwardAll        bool                         // Forward every local publisher, including future ones
+	selectedTracks    map[string]bool              // Track IDs to forward when forwardAll is false
+	senders           map[string]*webrtc.RTPSender // Map<trackID, *RTPSender> for outbound relays
+	pendingCandidates []webrtc.ICECandidateInit
+	negotiating       bool // An offer is outstanding
+	renegotiate       bool // Another offer is needed once the outstanding answer arrives
+}
+
+// MeetingMigration tracks a live move of a meeting from this SFU to another SFU
+type MeetingMigration struct {
+	TargetSFUID    string
+	StartedAt      time.Time
+	movedClients   map[string]bool // Clients whose signaling is now handled by the target SFU
+	pendingClients map[string]bool // Moved clients that have not yet connected to the target SFU
+	replyTopics    map[string]bool // Signaling reply topics to notify once the meeting has moved
+	completed      bool
+	timer          *time.Timer
+}
+
+// TrackMetadata describes a published track in a meeting snapshot
+type TrackMetadata struct {
+	TrackID     string `json:"trackId"`
+	StreamID    string `json:"streamId"`
+	Kind        string `json:"kind"`
+	MimeType    string `json:"mimeType"`
+	PublisherID string `json:"publisherId"`
+	Source      string `json:"source"`
+}
+
+// DownTrackStats describes the forwarding of one track to one subscriber
+type DownTrackStats struct {
+	SubscriberID  string `json:"subscriberId"`
+	TrackID       string `json:"trackId"`
+	Kind          string `json:"kind"`
+	SSRC          uint32 `json:"ssrc"`
+	Paused        bool   `json:"paused"`
+	Suspended     bool   `json:"suspended"` // Held by the subscriber's media mode
+	Packets       uint64 `json:"packets"`
+	Bytes         uint64 `json:"bytes"`
+	Dropped       uint64 `json:"dropped"`      // Skipped while paused or outside the selected layers
+	QueueDropped  uint64 `json:"queueDropped"` // Dropped because the subscriber could not keep up
+	Queued        int    `json:"queued"`
+	WriteErrors   uint64 `json:"writeErrors"`
+	SpatialLayer  int    `json:"spatialLayer"`  // -1 for non-SVC tracks
+	TemporalLayer int    `json:"temporalLayer"` // -1 for non-SVC tracks
+	Bandwidth     uint64 `json:"bandwidth,omitempty"`
+}
+
+// MeetingMigrationSnapshot is written to Redis when a meeting starts migrating
+type MeetingMigrationSnapshot struct {
+	MeetingID   string          `json:"meetingId"`
+	SourceSFUID string          `json:"sourceSfuId"`
+	TargetSFUID string          `json:"targetSfuId"`
+	StartedAt   time.Time       `json:"startedAt"`
+	Roster      MeetingMetadata `json:"roster"`
+	Tracks      []TrackMetadata `json:"tracks"`
 }
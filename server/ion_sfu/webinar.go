@@ -0,0 +1,121 @@
+package main
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// meetingModeWebinar is the prepareMeeting mode for town halls: a few presenters publish and
+// everyone without a role from their token joins as a receive-only viewer. Viewers only get
+// the SFU's sendonly transceivers; whatever they try to publish is stopped by the role check.
+// New tracks reach viewers with coalesced, staggered renegotiations, and when this SFU has
+// WebinarMaxViewers viewers further viewers are refused with "viewer_capacity" so they can
+// be placed on an edge SFU fed by a relay.
+const meetingModeWebinar = "webinar"
+
+// applyMeetingMode switches a meeting to webinar mode when a command asks for it.
+// Like end-to-end encryption, the mode stays on for the rest of the meeting.
+func applyMeetingMode(sfuCommand SFUCommand, meeting *Meeting) {
+	if mode, _ := sfuCommand.Payload["mode"].(string); mode != meetingModeWebinar {
+		return
+	}
+
+	meeting.mu.Lock()
+	enabled := !meeting.webinar
+	meeting.webinar = true
+	meeting.mu.Unlock()
+
+	if enabled {
+		sfuLogger.Info("WEBRTC", "Webinar mode enabled", map[string]interface{}{
+			"meetingID":   meeting.ID,
+			"commandType": sfuCommand.Type,
+			"maxViewers":  C.WebinarMaxViewers,
+		})
+	}
+}
+
+// meetingMode is the mode relayed to edges and migration targets
+func meetingMode(meetingID string) string {
+	meetingsMu.RLock()
+	meeting, ok := meetings[meetingID]
+	meetingsMu.RUnlock()
+	if !ok {
+		return ""
+	}
+
+	meeting.mu.RLock()
+	defer meeting.mu.RUnlock()
+	if meeting.webinar {
+		return meetingModeWebinar
+	}
+	return ""
+}
+
+// isWebinarViewer reports whether a client receives a webinar without publishing.
+// The caller holds meeting.mu.
+func isWebinarViewer(meeting *Meeting, clientPeer *ClientPeer) bool {
+	return meeting.webinar && clientPeer.role == roleViewer
+}
+
+// webinarViewerCapacityReached reports whether this SFU serves as many viewers of the
+// meeting as it may
+func webinarViewerCapacityReached(meeting *Meeting) bool {
+	if C.WebinarMaxViewers <= 0 {
+		return false
+	}
+
+	meeting.mu.RLock()
+	defer meeting.mu.RUnlock()
+	return meeting.webinar && countViewersLocked(meeting) >= C.WebinarMaxViewers
+}
+
+func countViewersLocked(meeting *Meeting) int {
+	viewers := 0
+	for _, clientPeer := range meeting.clients {
+		if clientPeer.role == roleViewer {
+			viewers++
+		}
+	}
+	return viewers
+}
+
+// webinarViewerCounts returns the viewers this SFU serves per webinar, for heartbeats
+func webinarViewerCounts() (int64, map[string]int) {
+	meetingsMu.RLock()
+	defer meetingsMu.RUnlock()
+
+	var total int64
+	perMeeting := make(map[string]int)
+	for meetingID, meeting := range meetings {
+		meeting.mu.RLock()
+		if meeting.webinar {
+			viewers := countViewersLocked(meeting)
+			perMeeting[meetingID] = viewers
+			total += int64(viewers)
+		}
+		meeting.mu.RUnlock()
+	}
+	return total, perMeeting
+}
+
+// scheduleRenegotiation coalesces the renegotiations of a webinar viewer: tracks added within
+// ViewerRenegotiationDelay share one offer, and the offers to all viewers are spread over that
+// window instead of hitting the signaling servers at once.
+func scheduleRenegotiation(clientPeer *ClientPeer) {
+	if !atomic.CompareAndSwapInt32(&clientPeer.renegotiationPending, 0, 1) {
+		return
+	}
+
+	delay := C.ViewerRenegotiationDelay / 2
+	delay += time.Duration(rand.Int63n(int64(delay) + 1))
+	time.AfterFunc(delay, func() {
+		atomic.StoreInt32(&clientPeer.renegotiationPending, 0)
+		if clientPeer.PeerConnection.ConnectionState() == webrtc.PeerConnectionStateClosed {
+			return
+		}
+		renegotiateClient(clientPeer, "")
+	})
+}
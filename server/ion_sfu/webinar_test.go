@@ -0,0 +1,102 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// useTestWebRTCAPI replaces the shared API with one using the configured codecs, without the ICE transport settings
+func useTestWebRTCAPI(t *testing.T) {
+	t.Helper()
+	mediaEngine, err := newMediaEngine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := webrtcAPI
+	webrtcAPI = webrtc.NewAPI(webrtc.WithMediaEngine(mediaEngine))
+	t.Cleanup(func() { webrtcAPI = previous })
+}
+
+func TestViewerTransceiversAreSendonly(t *testing.T) {
+	useTestWebRTCAPI(t)
+
+	sfuPC, err := newPeerConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sfuPC.Close()
+	viewerPC, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer viewerPC.Close()
+
+	// The viewer offers a camera of its own, which a sendrecv transceiver from the SFU would accept
+	camera, err := webrtc.NewTrackLocalStaticRTP(testVP8, "viewer-camera", "viewer-stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := viewerPC.AddTrack(camera); err != nil {
+		t.Fatal(err)
+	}
+	offer, err := viewerPC.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := viewerPC.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	if err := sfuPC.SetRemoteDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+
+	meeting := &Meeting{
+		ID:              "webinar-1",
+		webinar:         true,
+		clients:         make(map[string]*ClientPeer),
+		trackPublishers: make(map[string]string),
+		roomAssignments: make(map[string]string),
+	}
+	viewer := &ClientPeer{ID: "viewer", MeetingID: meeting.ID, PeerConnection: sfuPC, mediaMode: mediaModeFull, role: roleViewer}
+	meeting.clients[viewer.ID] = viewer
+
+	routers := []*TrackRouter{
+		newRouter("presenter-camera", "presenter", webrtc.RTPCodecTypeVideo, testVP8, false, trackSourceCamera),
+		newRouter("presenter-audio", "presenter", webrtc.RTPCodecTypeAudio, webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus, ClockRate: 48000, Channels: 2}, false, trackSourceMicrophone),
+	}
+	meeting.mu.Lock()
+	for _, router := range routers {
+		defer router.Close()
+		if !attachTrackToPeer(meeting, viewer, router) {
+			t.Fatalf("track %s not attached to the viewer", router.ID())
+		}
+	}
+	meeting.mu.Unlock()
+
+	answer, err := sfuPC.CreateAnswer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sfuPC.SetLocalDescription(answer); err != nil {
+		t.Fatal(err)
+	}
+
+	sending := 0
+	for _, transceiver := range sfuPC.GetTransceivers() {
+		if transceiver.Sender() == nil || transceiver.Sender().Track() == nil {
+			// The transceiver of the viewer's own offer only receives
+			if direction := transceiver.Direction(); direction != webrtc.RTPTransceiverDirectionRecvonly {
+				t.Errorf("transceiver of the viewer's offer is %s, want recvonly", direction)
+			}
+			continue
+		}
+		sending++
+		if direction := transceiver.Direction(); direction != webrtc.RTPTransceiverDirectionSendonly {
+			t.Errorf("transceiver forwarding %s is %s, want sendonly", transceiver.Sender().Track().ID(), direction)
+		}
+	}
+	if sending != len(routers) {
+		t.Fatalf("%d transceivers forward tracks, want %d", sending, len(routers))
+	}
+}
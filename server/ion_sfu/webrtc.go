@@ -1,28 +1,32 @@
 package main
 
 import (
+	"time"
+
+	"github.com/pion/rtcp"
 	"github.com/pion/webrtc/v3"
 )
 
-func setupClientPeerConnection(meeting *Meeting, clientID string, replyTo string) {
+// setupClientPeerConnection creates the PeerConnection of a client admitted to the meeting
+func setupClientPeerConnection(meeting *Meeting, clientID string, options joinOptions) {
 	sfuLogger.Info("WEBRTC", "Setting up client peer connection", map[string]interface{}{
 		"clientID":  clientID,
 		"meetingID": meeting.ID,
 		"sfuID":     sfuID,
+		"mediaMode": options.mediaMode,
+		"role":      options.role,
 	})
 
-	config := webrtc.Configuration{
-		ICEServers: []webrtc.ICEServer{
-			{URLs: []string{"stun:stun.l.google.com:19302"}},
-		},
-	}
-
+	// The client gets the STUN servers plus TURN credentials of the embedded server;
+	// the SFU itself is directly reachable and does not relay through TURN
+	iceServers := clientICEServers(clientID)
 	sfuLogger.Debug("WEBRTC", "WebRTC configuration", map[string]interface{}{
-		"iceServers": config.ICEServers,
-		"clientID":   clientID,
+		"iceServers":       peerConnectionConfig().ICEServers,
+		"clientICEServers": len(iceServers),
+		"clientID":         clientID,
 	})
 
-	peerConnection, err := webrtc.NewPeerConnection(config)
+	peerConnection, err := newPeerConnection()
 	if err != nil {
 		sfuLogger.Error("WEBRTC", "Error creating PeerConnection", err, map[string]interface{}{
 			"clientID":  clientID,
@@ -40,8 +44,25 @@ func setupClientPeerConnection(meeting *Meeting, clientID string, replyTo string
 	clientPeer := &ClientPeer{
 		ID:             clientID,
 		MeetingID:      meeting.ID,
+		ReplyTo:        options.replyTo,
+		MigratedFrom:   options.migratedFrom,
 		PeerConnection: peerConnection,
+		mediaMode:      options.mediaMode,
+		role:           options.role,
+		joinToken:      options.joinToken,
+		allocator:      newBandwidthAllocator(),
+		joinedAt:       time.Now(),
+	}
+
+	if err := setupDataChannel(meeting, clientPeer); err != nil {
+		// Media still works without the data channel
+		sfuLogger.Error("DATACHANNEL", "Error creating meeting data channel", err, map[string]interface{}{
+			"clientID":  clientID,
+			"meetingID": meeting.ID,
+		})
+		sfuState.IncrementCounters(0, 0, 1)
 	}
+	go deliverJoinHistory(meeting, clientPeer)
 
 	meeting.mu.Lock()
 	meeting.clients[clientID] = clientPeer
@@ -53,6 +74,18 @@ func setupClientPeerConnection(meeting *Meeting, clientID string, replyTo string
 		"totalClients": len(meeting.clients),
 	})
 
+	publishMeetingRoster(meeting)
+	publishLifecycleEvent(meeting.ID, "participantJoined", map[string]interface{}{
+		"clientId":     clientID,
+		"role":         options.role,
+		"mediaMode":    options.mediaMode,
+		"migratedFrom": options.migratedFrom,
+	})
+
+	if len(iceServers) > 0 {
+		sendICEServersToClient(clientID, meeting.ID, options.replyTo, iceServers)
+	}
+
 	peerConnection.OnICECandidate(func(c *webrtc.ICECandidate) {
 		if c == nil {
 			sfuLogger.Debug("WEBRTC", "ICE candidate gathering complete", map[string]interface{}{
@@ -66,7 +99,7 @@ func setupClientPeerConnection(meeting *Meeting, clientID string, replyTo string
 			"meetingID": meeting.ID,
 			"candidate": c.String(),
 		})
-		sendSFUSignalToClient(clientID, "candidate", "", c, meeting.ID, replyTo)
+		sendSFUSignalToClient(clientID, "candidate", "", c, meeting.ID, options.replyTo)
 	})
 
 	peerConnection.OnConnectionStateChange(func(s webrtc.PeerConnectionState) {
@@ -75,194 +108,313 @@ func setupClientPeerConnection(meeting *Meeting, clientID string, replyTo string
 			"meetingID": meeting.ID,
 			"state":     s.String(),
 		})
+		publishLifecycleEvent(meeting.ID, "connectionStateChanged", map[string]interface{}{
+			"clientId": clientID,
+			"state":    s.String(),
+		})
 
-		if s == webrtc.PeerConnectionStateFailed || s == webrtc.PeerConnectionStateClosed {
-			sfuLogger.Warn("WEBRTC", "PeerConnection closed or failed", map[string]interface{}{
-				"clientID":  clientID,
-				"meetingID": meeting.ID,
-				"state":     s.String(),
-			})
+		switch s {
+		case webrtc.PeerConnectionStateConnected:
+			cancelReconnectGrace(clientPeer)
+			notifyMigrationSource(meeting, clientPeer)
+		case webrtc.PeerConnectionStateDisconnected:
+			// Network changes often recover on their own; keep the peer and its subscriptions
+			startReconnectGrace(meeting, clientPeer)
+		case webrtc.PeerConnectionStateFailed:
+			startReconnectGrace(meeting, clientPeer)
+			restartClientICE(meeting, clientPeer)
+		case webrtc.PeerConnectionStateClosed:
+			evictClient(meeting, clientID, s.String())
+		}
+	})
 
-			meeting.mu.Lock()
-			if _, ok := meeting.clients[clientID]; ok {
-				delete(meeting.clients, clientID)
-				sfuLogger.Info("WEBRTC", "Client removed from meeting", map[string]interface{}{
-					"clientID":         clientID,
-					"meetingID":        meeting.ID,
-					"remainingClients": len(meeting.clients),
-				})
-
-				metricsMu.Lock()
-				sfuMetrics.ConnectedClients--
-				if len(meeting.clients) == 0 {
-					sfuMetrics.ActiveMeetings--
-					sfuLogger.Info("WEBRTC", "Meeting became empty", map[string]interface{}{
-						"meetingID":      meeting.ID,
-						"activeMeetings": sfuMetrics.ActiveMeetings,
-					})
-				}
-				metricsMu.Unlock()
+	peerConnection.OnTrack(func(remoteTrack *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+		meeting.mu.Lock()
+		source := publisherTrackSource(clientPeer, remoteTrack)
+		allowed := roleCanPublish(clientPeer.role, remoteTrack.Kind(), source)
+		limited := allowed && screenShareLimitReached(meeting, remoteTrack, source)
+		if allowed && !limited {
+			// A local publisher replaces any relayed copy of the same track (e.g. after migration)
+			delete(meeting.relayedTracks, remoteTrack.ID())
+		}
+		meeting.mu.Unlock()
 
-				sfuState.UpdateMetrics(sfuMetrics.ConnectedClients, sfuMetrics.ActiveMeetings)
-			}
-			meeting.mu.Unlock()
+		switch {
+		case !allowed:
+			rejectPublish(meeting, clientPeer, remoteTrack, receiver, "publish_not_allowed")
+		case limited:
+			rejectPublish(meeting, clientPeer, remoteTrack, receiver, "screen_share_limit")
+		default:
+			publishTrack(meeting, clientID, peerConnection, remoteTrack, receiver, source)
 		}
 	})
 
-	peerConnection.OnTrack(func(remoteTrack *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
-		sfuLogger.Info("WEBRTC", "Received remote track", map[string]interface{}{
-			"clientID":  clientID,
-			"meetingID": meeting.ID,
-			"trackID":   remoteTrack.ID(),
-			"trackKind": remoteTrack.Kind().String(),
-			"streamID":  remoteTrack.StreamID(),
-		})
+	sfuLogger.Debug("WEBRTC", "Adding existing tracks to new client", map[string]interface{}{
+		"clientID":       clientID,
+		"meetingID":      meeting.ID,
+		"existingTracks": len(meeting.routers),
+	})
 
-		trackLocal, newTrackErr := webrtc.NewTrackLocalStaticRTP(remoteTrack.Codec().RTPCodecCapability, remoteTrack.ID(), remoteTrack.StreamID())
-		if newTrackErr != nil {
-			sfuLogger.Error("WEBRTC", "Error creating local track", newTrackErr, map[string]interface{}{
-				"clientID":  clientID,
-				"meetingID": meeting.ID,
-				"trackID":   remoteTrack.ID(),
-			})
-			sfuState.IncrementCounters(0, 0, 1)
-			return
+	// One offer carries every existing track, however many there are
+	added := false
+	meeting.mu.RLock()
+	for _, router := range meeting.routers {
+		if attachTrackToPeer(meeting, clientPeer, router) {
+			added = true
 		}
+	}
+	meeting.mu.RUnlock()
+	if added {
+		renegotiateClient(clientPeer, "")
+	}
 
-		sfuLogger.Debug("WEBRTC", "Local track created successfully", map[string]interface{}{
-			"clientID":  clientID,
-			"meetingID": meeting.ID,
-			"trackID":   remoteTrack.ID(),
-			"trackKind": remoteTrack.Kind().String(),
-		})
+	sfuLogger.Info("WEBRTC", "Client peer connection setup completed", map[string]interface{}{
+		"clientID":     clientID,
+		"meetingID":    meeting.ID,
+		"totalClients": len(meeting.clients),
+		"totalTracks":  len(meeting.routers),
+	})
+}
 
-		meeting.mu.Lock()
-		meeting.trackLocals[remoteTrack.ID()] = trackLocal
-		meeting.mu.Unlock()
+// routeToSubscribers adds a newly routed track to the meeting's clients and relays
+func routeToSubscribers(meeting *Meeting, router *TrackRouter, publisherID string) {
+	meeting.mu.RLock()
+	for _, existingClientPeer := range meeting.clients {
+		// Don't send back to sender, nor to clients being moved to another SFU
+		if existingClientPeer.ID != publisherID && !isClientMigrating(meeting, existingClientPeer.ID) {
+			addTrackToPeer(meeting, existingClientPeer, router)
+		}
+	}
+	meeting.mu.RUnlock()
+
+	addTrackToRelays(meeting, router)
+}
+
+// publishTrack exposes a remote track to the meeting: it creates the track's router,
+// adds it to every other client and relay, and forwards RTP until the remote track ends.
+// If the meeting already routes a track with the same ID (a relayed copy replaced by the
+// local publisher, or the other way round) the existing down tracks switch to the new
+// source without renegotiation.
+// publisherID is the client ID for local publishers or the relay ID for relayed tracks;
+// source is the track source announced by the publisher (or by the origin of a relayed track).
+func publishTrack(meeting *Meeting, publisherID string, pc *webrtc.PeerConnection, remoteTrack *webrtc.TrackRemote, receiver *webrtc.RTPReceiver, source string) {
+	sfuLogger.Info("WEBRTC", "Received remote track", map[string]interface{}{
+		"publisherID": publisherID,
+		"meetingID":   meeting.ID,
+		"trackID":     remoteTrack.ID(),
+		"trackKind":   remoteTrack.Kind().String(),
+		"streamID":    remoteTrack.StreamID(),
+		"source":      source,
+	})
+
+	meeting.mu.Lock()
+	_, local := meeting.clients[publisherID]
+	router, existing := meeting.routers[remoteTrack.ID()]
+	var previous *TrackRouter
+	if existing && !router.canRoute(remoteTrack) {
+		previous = router
+		existing = false
+	}
+	if !existing {
+		router = newTrackRouter(remoteTrack, meeting.e2ee, source)
+		meeting.routers[remoteTrack.ID()] = router
+	}
+	meeting.trackPublishers[remoteTrack.ID()] = publisherID
+	meeting.mu.Unlock()
+
+	if previous != nil {
+		previous.Close()
+	}
 
+	generation := router.attachSource(publisherID, receiver, func() {
+		requestKeyframe(pc, remoteTrack)
+	})
+
+	if local {
+		publishLifecycleEvent(meeting.ID, "trackPublished", trackEventData(router, publisherID))
+	}
+
+	if existing {
+		sfuLogger.Info("WEBRTC", "Switched track router to new publisher", map[string]interface{}{
+			"publisherID": publisherID,
+			"meetingID":   meeting.ID,
+			"trackID":     remoteTrack.ID(),
+			"downTracks":  len(router.DownTracks()),
+		})
+	} else {
 		sfuLogger.Debug("WEBRTC", "Adding track to existing clients", map[string]interface{}{
-			"clientID":        clientID,
+			"publisherID":     publisherID,
 			"meetingID":       meeting.ID,
 			"trackID":         remoteTrack.ID(),
 			"existingClients": len(meeting.clients),
 		})
 
-		meeting.mu.RLock()
-		for _, existingClientPeer := range meeting.clients {
-			if existingClientPeer.ID != clientID { // Don't send back to sender
-				addTrackToPeer(existingClientPeer.PeerConnection, trackLocal, replyTo)
-			}
+		routeToSubscribers(meeting, router, publisherID)
+		if local {
+			announceScreenShare(meeting, router, publisherID, true)
 		}
-		meeting.mu.RUnlock()
+	}
 
-		rtpBuf := make([]byte, 1500)
-		packetCount := int64(0)
+	packetCount := int64(0)
 
-		sfuLogger.Debug("WEBRTC", "Starting RTP packet forwarding", map[string]interface{}{
-			"clientID":  clientID,
-			"meetingID": meeting.ID,
-			"trackID":   remoteTrack.ID(),
-		})
+	sfuLogger.Debug("WEBRTC", "Starting RTP packet forwarding", map[string]interface{}{
+		"publisherID": publisherID,
+		"meetingID":   meeting.ID,
+		"trackID":     remoteTrack.ID(),
+	})
 
-		for {
-			i, _, readErr := remoteTrack.Read(rtpBuf)
-			if readErr != nil {
-				sfuLogger.Error("WEBRTC", "Error reading from remote track", readErr, map[string]interface{}{
-					"clientID":    clientID,
-					"meetingID":   meeting.ID,
-					"trackID":     remoteTrack.ID(),
-					"packetCount": packetCount,
-				})
-				sfuState.IncrementCounters(0, 0, 1)
-
-				meeting.mu.Lock()
-				delete(meeting.trackLocals, remoteTrack.ID())
-				meeting.mu.Unlock()
-				return
-			}
+	for {
+		fp := getForwardPacket()
+		i, _, readErr := remoteTrack.Read(fp.buf[:])
+		if readErr != nil {
+			fp.release()
+			sfuLogger.Error("WEBRTC", "Error reading from remote track", readErr, map[string]interface{}{
+				"publisherID": publisherID,
+				"meetingID":   meeting.ID,
+				"trackID":     remoteTrack.ID(),
+				"packetCount": packetCount,
+			})
+			sfuState.IncrementCounters(0, 0, 1)
 
-			if _, writeErr := trackLocal.Write(rtpBuf[:i]); writeErr != nil {
-				sfuLogger.Error("WEBRTC", "Error writing to local track", writeErr, map[string]interface{}{
-					"clientID":    clientID,
-					"meetingID":   meeting.ID,
-					"trackID":     remoteTrack.ID(),
-					"packetCount": packetCount,
-				})
-				sfuState.IncrementCounters(0, 0, 1)
-				return
+			// Only unpublish if the router did not switch to another publisher meanwhile
+			meeting.mu.Lock()
+			replaced := meeting.routers[remoteTrack.ID()] != router || !router.isSource(generation)
+			if !replaced {
+				delete(meeting.routers, remoteTrack.ID())
+				delete(meeting.relayedTracks, remoteTrack.ID())
+				delete(meeting.trackPublishers, remoteTrack.ID())
 			}
+			meeting.mu.Unlock()
 
-			packetCount++
-			if packetCount%1000 == 0 { // Log every 1000 packets
-				sfuLogger.Debug("WEBRTC", "RTP packet forwarding progress", map[string]interface{}{
-					"clientID":    clientID,
-					"meetingID":   meeting.ID,
-					"trackID":     remoteTrack.ID(),
-					"packetCount": packetCount,
-				})
+			if !replaced {
+				router.Close()
+				removeTrackFromRelays(meeting, remoteTrack.ID())
+				if local {
+					announceScreenShare(meeting, router, publisherID, false)
+					publishLifecycleEvent(meeting.ID, "trackUnpublished", trackEventData(router, publisherID))
+				}
 			}
+			return
 		}
-	})
 
-	sfuLogger.Debug("WEBRTC", "Adding existing tracks to new client", map[string]interface{}{
-		"clientID":       clientID,
-		"meetingID":      meeting.ID,
-		"existingTracks": len(meeting.trackLocals),
-	})
+		if !router.isSource(generation) {
+			// Another publisher took over the track; stop forwarding this copy
+			fp.release()
+			return
+		}
 
-	meeting.mu.RLock()
-	for _, trackLocal := range meeting.trackLocals {
-		addTrackToPeer(peerConnection, trackLocal, replyTo)
+		if unmarshalErr := fp.packet.Unmarshal(fp.buf[:i]); unmarshalErr != nil {
+			fp.release()
+			continue
+		}
+
+		// Queues the packet on every down track; per-subscriber statistics are in getForwardStats
+		router.WriteRTP(fp)
+		fp.release()
+		packetCount++
 	}
-	meeting.mu.RUnlock()
+}
 
-	sfuLogger.Info("WEBRTC", "Client peer connection setup completed", map[string]interface{}{
-		"clientID":     clientID,
-		"meetingID":    meeting.ID,
-		"totalClients": len(meeting.clients),
-		"totalTracks":  len(meeting.trackLocals),
-	})
+// addTrackToPeer creates the client's down track of a router and renegotiates the client.
+// The caller holds meeting.mu for reading.
+func addTrackToPeer(meeting *Meeting, clientPeer *ClientPeer, router *TrackRouter) {
+	if !attachTrackToPeer(meeting, clientPeer, router) {
+		return
+	}
+	if isWebinarViewer(meeting, clientPeer) {
+		scheduleRenegotiation(clientPeer)
+		return
+	}
+	renegotiateClient(clientPeer, router.ID())
 }
 
-func addTrackToPeer(pc *webrtc.PeerConnection, trackLocal *webrtc.TrackLocalStaticRTP, replyTo string) {
+// attachTrackToPeer creates the client's down track of a router without renegotiating.
+// It reports whether a track was added. The caller holds meeting.mu for reading.
+func attachTrackToPeer(meeting *Meeting, clientPeer *ClientPeer, router *TrackRouter) bool {
+	if router.Kind() == webrtc.RTPCodecTypeVideo && clientPeer.mediaMode == mediaModeAudioOnly {
+		return false
+	}
+	if !publisherAllowed(meeting, router) {
+		// The publisher was demoted while the track was being set up
+		return false
+	}
+	if !inSameBreakoutRoom(meeting, clientPeer.ID, router) {
+		return false
+	}
+
+	pc := clientPeer.PeerConnection
 	sfuLogger.Debug("WEBRTC", "Adding track to peer connection", map[string]interface{}{
-		"trackID":   trackLocal.ID(),
-		"trackKind": trackLocal.Kind().String(),
-		"streamID":  trackLocal.StreamID(),
+		"clientID":  clientPeer.ID,
+		"trackID":   router.ID(),
+		"trackKind": router.Kind().String(),
+		"streamID":  router.StreamID(),
 	})
 
-	_, err := pc.AddTransceiverFromKind(trackLocal.Kind(), webrtc.RTPTransceiverInit{
-		Direction: webrtc.RTPTransceiverDirectionSendonly,
-	})
-	if err != nil {
-		sfuLogger.Error("WEBRTC", "Error adding transceiver", err, map[string]interface{}{
-			"trackID":   trackLocal.ID(),
-			"trackKind": trackLocal.Kind().String(),
-		})
-		sfuState.IncrementCounters(0, 0, 1)
-		return
+	downTrack := router.AddDownTrack(clientPeer.ID)
+	if downTrack.layers != nil {
+		downTrack.allocator = clientPeer.allocator
 	}
-
-	_, err = pc.AddTrack(trackLocal)
+	applyMediaMode(clientPeer.mediaMode, downTrack)
+	// A sendonly transceiver of its own: AddTrack would reuse or create a sendrecv one,
+	// inviting the client to send media upstream on the SFU's m-line
+	transceiver, err := pc.AddTransceiverFromTrack(downTrack, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionSendonly})
 	if err != nil {
+		router.RemoveDownTrack(clientPeer.ID)
 		sfuLogger.Error("WEBRTC", "Error adding track to peer connection", err, map[string]interface{}{
-			"trackID":   trackLocal.ID(),
-			"trackKind": trackLocal.Kind().String(),
+			"clientID":  clientPeer.ID,
+			"trackID":   router.ID(),
+			"trackKind": router.Kind().String(),
 		})
 		sfuState.IncrementCounters(0, 0, 1)
-		return
+		return false
 	}
 
 	sfuLogger.Debug("WEBRTC", "Track added to peer connection", map[string]interface{}{
-		"trackID":   trackLocal.ID(),
-		"trackKind": trackLocal.Kind().String(),
+		"clientID":  clientPeer.ID,
+		"trackID":   router.ID(),
+		"trackKind": router.Kind().String(),
 	})
 
-	// Trigger renegotiation by creating and sending an offer
+	if downTrack.allocator != nil {
+		downTrack.allocator.add(downTrack)
+	}
+	go readSenderRTCP(transceiver.Sender(), downTrack)
+	return true
+}
+
+// renegotiateClient sends the client an offer after the SFU added or removed a track.
+// Callers may hold meeting.mu, which the signal handlers take while holding clientPeer.mu,
+// so the offer is made on its own goroutine.
+func renegotiateClient(clientPeer *ClientPeer, trackID string) {
+	go offerToClient(clientPeer, trackID)
+}
+
+// offerToClient makes an SFU-initiated offer under clientPeer.mu. While another negotiation
+// is in flight the offer is deferred until handleWebRTCSignal has brought signaling back to stable.
+func offerToClient(clientPeer *ClientPeer, trackID string) {
+	clientPeer.mu.Lock()
+	defer clientPeer.mu.Unlock()
+
+	pc := clientPeer.PeerConnection
+	if pc.ConnectionState() == webrtc.PeerConnectionStateClosed {
+		return
+	}
+	if pc.SignalingState() != webrtc.SignalingStateStable {
+		clientPeer.renegotiate = true
+		sfuLogger.Debug("WEBRTC", "Deferring renegotiation while negotiation is in progress", map[string]interface{}{
+			"clientID":       clientPeer.ID,
+			"trackID":        trackID,
+			"signalingState": pc.SignalingState().String(),
+		})
+		return
+	}
+	clientPeer.renegotiate = false
+
 	offer, err := pc.CreateOffer(nil)
 	if err != nil {
 		sfuLogger.Error("WEBRTC", "Error creating offer for renegotiation", err, map[string]interface{}{
-			"trackID": trackLocal.ID(),
+			"clientID": clientPeer.ID,
+			"trackID":  trackID,
 		})
 		sfuState.IncrementCounters(0, 0, 1)
 		return
@@ -271,41 +423,32 @@ func addTrackToPeer(pc *webrtc.PeerConnection, trackLocal *webrtc.TrackLocalStat
 	err = pc.SetLocalDescription(offer)
 	if err != nil {
 		sfuLogger.Error("WEBRTC", "Error setting local description for renegotiation", err, map[string]interface{}{
-			"trackID": trackLocal.ID(),
+			"clientID": clientPeer.ID,
+			"trackID":  trackID,
 		})
 		sfuState.IncrementCounters(0, 0, 1)
 		return
 	}
 
-	// Find the client ID for this PeerConnection and send the offer
-	// We need to find which client this PeerConnection belongs to
-	meetingsMu.RLock()
-	for _, meeting := range meetings {
-		meeting.mu.RLock()
-		for clientID, clientPeer := range meeting.clients {
-			if clientPeer.PeerConnection == pc {
-				// We don't have the replyTo topic here. This is a renegotiation initiated by the SFU.
-				// The response should go to the main topic, and the signaling server will need to handle it.
-				// In the future, we could store the replyTo topic in the ClientPeer struct.
-				sendSFUSignalToClient(clientID, "offer", offer.SDP, nil, meeting.ID, replyTo)
-				meeting.mu.RUnlock()
-				meetingsMu.RUnlock()
-
-				sfuLogger.Info("WEBRTC", "Sent renegotiation offer to client", map[string]interface{}{
-					"clientID":  clientID,
-					"meetingID": meeting.ID,
-					"trackID":   trackLocal.ID(),
-					"offerSDP":  offer.SDP[:100] + "...", // Log first 100 chars of SDP
-				})
-				return
-			}
-		}
-		meeting.mu.RUnlock()
-	}
-	meetingsMu.RUnlock()
+	// This is a renegotiation initiated by the SFU; replyTo is the topic of the
+	// signaling server serving this client (ClientPeer.ReplyTo).
+	sendSFUSignalToClient(clientPeer.ID, "offer", offer.SDP, nil, clientPeer.MeetingID, clientPeer.ReplyTo)
 
-	sfuLogger.Warn("WEBRTC", "Could not find client for PeerConnection", map[string]interface{}{
-		"trackID":   trackLocal.ID(),
-		"trackKind": trackLocal.Kind().String(),
+	sfuLogger.Info("WEBRTC", "Sent renegotiation offer to client", map[string]interface{}{
+		"clientID":  clientPeer.ID,
+		"meetingID": clientPeer.MeetingID,
+		"trackID":   trackID,
+		"offerSDP":  offer.SDP[:100] + "...", // Log first 100 chars of SDP
 	})
 }
+
+// requestKeyframe asks the publisher of a remote track for a new keyframe
+func requestKeyframe(pc *webrtc.PeerConnection, remoteTrack *webrtc.TrackRemote) {
+	err := pc.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: uint32(remoteTrack.SSRC())}})
+	if err != nil {
+		sfuLogger.Debug("WEBRTC", "Error sending keyframe request to publisher", map[string]interface{}{
+			"trackID": remoteTrack.ID(),
+			"error":   err.Error(),
+		})
+	}
+}
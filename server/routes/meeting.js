@@ -25,7 +25,7 @@ try{
 }
 
 const { createMeeting, addParticipantToMeeting, findBestSfu, findBestSignalingServer } = require('../utils/meetings/meetings-helpers.js');
-const { decryptSecret } = require('../utils/auth/encrytion.js');
+const { decryptSecret, issueJoinToken } = require('../utils/auth/encrytion.js');
 const supabase = require('../utils/datamanagement/supabase.js');
 const { sendMeetingPreparationCommand } = require('../utils/kafka-utils.js');
 
@@ -204,7 +204,8 @@ router.post('/create', async (req, res) => {
             meetingID: String(meetingId),
             meetingCode: meetingInfo.meeting_code, // Also return the meeting code for reference
             sfu: assignedSfuId,
-            signalingServer: assignedSignalingServerUrl
+            signalingServer: assignedSignalingServerUrl,
+            joinToken: issueJoinToken(meetingId, userId, 'host') // Passed to the signaling server's joinMeeting
         });
 
     } catch (error) {
@@ -276,7 +277,8 @@ router.post('/join', async (req, res) => {
             meetingCode: meeting.meeting_code, // Also return the meeting code for reference
             meetingName: meetingName,
             sfu: assignedSfuId,
-            signalingServer: assignedSignalingServerUrl
+            signalingServer: assignedSignalingServerUrl,
+            joinToken: issueJoinToken(meeting.id, userId, 'attendee') // Passed to the signaling server's joinMeeting
         });
 
     } catch (error) {
@@ -206,6 +206,40 @@ setSFUCommandHandler((sfuCommand) => {
       eventType,
       clientsCount: clients.size
     });
+  } else if (sfuCommand.type === 'meetingMigrated') {
+    const { meetingId, sfuId, previousSfuId } = sfuCommand.payload;
+
+    Logger.info('KAFKA', 'Meeting migrated to another SFU', {
+      meetingId,
+      sfuId,
+      previousSfuId
+    });
+
+    // Route further signaling for this meeting to the new SFU
+    redis.hset(`meeting:${meetingId}:metadata`, 'sfu_id', sfuId).catch((error) => {
+      Logger.error('KAFKA', 'Failed to update SFU assignment after migration', error, {
+        meetingId,
+        sfuId
+      });
+    });
+  } else if (sfuCommand.type === 'meetingHistory') {
+    const { targetClientId, meetingId } = sfuCommand.payload;
+    const targetWs = clients.get(targetClientId);
+
+    Logger.info('KAFKA', 'Delivering meeting history to client', {
+      targetClientId,
+      meetingId,
+      messages: sfuCommand.payload.messages?.length
+    });
+
+    if (targetWs && targetWs.readyState === WebSocket.OPEN) {
+      targetWs.send(JSON.stringify({ type: 'meetingHistory', payload: sfuCommand.payload }));
+    } else {
+      Logger.warn('KAFKA', 'Target client not connected for meeting history', {
+        targetClientId,
+        meetingId
+      });
+    }
   } else if (sfuCommand.type === 'prepareMeeting') {
     Logger.info('KAFKA', 'Processing prepare meeting command', sfuCommand.payload);
   } else {
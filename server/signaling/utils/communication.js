@@ -1,4 +1,5 @@
 const { Kafka } = require('kafkajs');
+const { sealSfuCommandMessages } = require('../../utils/kafka-envelope.js');
 
 const Logger = {
   levels: {
@@ -448,7 +449,9 @@ async function safeKafkaSend(topic, messages) {
     
     // Follow the pattern: connect → send → disconnect
     await producer.connect();
-    await producer.send({ topic, messages });
+    // SFUs verify the signature of every command addressed to them
+    const outgoing = topic === 'sfu_commands' ? sealSfuCommandMessages(messages, 'signaling') : messages;
+    await producer.send({ topic, messages: outgoing });
     await producer.disconnect();
     
     KafkaState.updateStats('messageSent', messages.length);
@@ -238,7 +238,7 @@ async function RegisterClientSfu(payload, ws, clients, sfus) {
 }
 
 async function ClientJoinsMeeting(ws, payload, senderId, clients) {
-    const {meetingId} = payload;
+    const {meetingId, mediaMode, joinToken} = payload;
     
     HelperState.updateStats('meetingJoin');
     
@@ -274,7 +274,7 @@ async function ClientJoinsMeeting(ws, payload, senderId, clients) {
             });
             
             await safeKafkaSend('sfu_commands', [
-                { key: assignedSfuId, value: JSON.stringify({ type: 'clientJoined', payload: { clientId: String(senderId), meetingId: String(meetingId) } }) }
+                { key: assignedSfuId, value: JSON.stringify({ type: 'clientJoined', payload: { clientId: String(senderId), meetingId: String(meetingId), mediaMode: mediaMode ? String(mediaMode) : undefined, token: joinToken ? String(joinToken) : undefined } }) }
             ]);
 
             sendWebSocketMessage(ws, { 
@@ -563,6 +563,7 @@ async function WebRTCHandler(payload, senderId, type, meetingId) {
                      payload: { type: type,
                                 sdp: payload.sdp, 
                                 candidate: payload.candidate, 
+                                trackSources: payload.trackSources, // Offers announce camera/microphone/screen per track
                                 senderId: String(senderId), 
                                 meetingId: String(meetingId) } 
                 })
@@ -601,7 +602,7 @@ async function WebRTCHandler(payload, senderId, type, meetingId) {
 }
 
 function SfuSignalToClient(payload, clients) {
-    const { targetClientId, signalType, sdp, candidate, meetingId: sfuMeetingId } = payload;
+    const { targetClientId, signalType, sdp, candidate, iceServers, meetingId: sfuMeetingId } = payload;
     
     // Enhanced target identification
     const targetInfo = identifyMessageSource(targetClientId);
@@ -658,6 +659,7 @@ function SfuSignalToClient(payload, clients) {
                     payload: {
                         sdp: sdp,
                         candidate: candidate,
+                        iceServers: iceServers,
                         senderId: 'sfu',
                         meetingId: sfuMeetingId
                     }
@@ -129,10 +129,40 @@ async function authenticateToken(req, res, next) {
   });
 }
 
+// 🎟️ 4. Issue a short-lived token the SFU verifies before letting a user into a meeting
+// HS256 with SFU_JOIN_TOKEN_SECRET, or RS256 with the PEM key in SFU_JOIN_TOKEN_PRIVATE_KEY
+// (the SFU then needs the matching public key in its key set, under SFU_JOIN_TOKEN_KEY_ID)
+function issueJoinToken(meetingId, userId, role) {
+  const options = {
+    subject: String(userId),
+    audience: process.env.SFU_JOIN_TOKEN_AUDIENCE || 'sfu',
+    issuer: process.env.SFU_JOIN_TOKEN_ISSUER || 'videochat-auth',
+    expiresIn: process.env.SFU_JOIN_TOKEN_TTL || '10m'
+  };
+  if (process.env.SFU_JOIN_TOKEN_KEY_ID) {
+    options.keyid = process.env.SFU_JOIN_TOKEN_KEY_ID;
+  }
+
+  let key;
+  if (process.env.SFU_JOIN_TOKEN_PRIVATE_KEY) {
+    key = fs.readFileSync(process.env.SFU_JOIN_TOKEN_PRIVATE_KEY, 'utf8');
+    options.algorithm = 'RS256';
+  } else if (process.env.SFU_JOIN_TOKEN_SECRET) {
+    key = process.env.SFU_JOIN_TOKEN_SECRET;
+    options.algorithm = 'HS256';
+  } else {
+    // SFUs without join token keys accept joins without a token
+    return null;
+  }
+
+  return jwt.sign({ meetingId: String(meetingId), role }, key, options);
+}
+
 
 module.exports = {
   generateAndSaveJWTSecret,
   encryptSecret,
   decryptSecret,
-  authenticateToken
+  authenticateToken,
+  issueJoinToken
 };
@@ -0,0 +1,86 @@
+const crypto = require('crypto');
+const fs = require('fs');
+
+// Commands on sfu_commands are wrapped in an envelope the SFU verifies before handling them.
+// The signature covers the target SFU (the Kafka key), issuer, timestamp, nonce and the exact
+// command JSON. HS256 uses SFU_COMMAND_SECRET (shared with the SFUs); EdDSA uses the Ed25519
+// PEM key in SFU_COMMAND_SIGNING_KEY_FILE, whose public key the SFUs list under
+// SFU_COMMAND_SIGNING_KEY_ID with this service's issuer names in its "issuers" member.
+// SFUs only accept the shared secret from the issuers in their SFU_COMMAND_SECRET_ISSUERS
+// (other SFUs by default), so prefer EdDSA here. Without either key, commands are sent
+// unsigned and SFUs in the default required mode reject them.
+const SIGNING_VERSION = 'sfu-command-v1';
+
+let signingKey;
+
+function loadSigningKey() {
+  if (signingKey !== undefined) {
+    return signingKey;
+  }
+
+  if (process.env.SFU_COMMAND_SIGNING_KEY_FILE) {
+    signingKey = {
+      alg: 'EdDSA',
+      kid: process.env.SFU_COMMAND_SIGNING_KEY_ID || '',
+      key: crypto.createPrivateKey(fs.readFileSync(process.env.SFU_COMMAND_SIGNING_KEY_FILE, 'utf8'))
+    };
+  } else if (process.env.SFU_COMMAND_SECRET) {
+    signingKey = { alg: 'HS256', kid: '', key: process.env.SFU_COMMAND_SECRET };
+  } else {
+    signingKey = null;
+  }
+  return signingKey;
+}
+
+/**
+ * Wrap a serialized SFU command in a signed envelope
+ * @param {string} targetSfuId - The SFU the command is keyed to
+ * @param {string} commandJson - The command, already JSON encoded
+ * @param {string} issuer - Name of the sending service
+ * @returns {string} - The envelope, or commandJson unchanged when no signing key is configured
+ */
+function sealSfuCommand(targetSfuId, commandJson, issuer) {
+  const key = loadSigningKey();
+  if (!key) {
+    return commandJson;
+  }
+
+  const timestamp = Date.now();
+  const nonce = crypto.randomUUID();
+  const signingInput = Buffer.from(
+    [SIGNING_VERSION, targetSfuId, issuer, String(timestamp), nonce, commandJson].join('\n')
+  );
+
+  const signature = key.alg === 'EdDSA'
+    ? crypto.sign(null, signingInput, key.key)
+    : crypto.createHmac('sha256', key.key).update(signingInput).digest();
+
+  // The command is embedded verbatim so the SFU verifies exactly the signed bytes
+  const header = JSON.stringify({
+    issuer,
+    kid: key.kid || undefined,
+    alg: key.alg,
+    timestamp,
+    nonce,
+    signature: signature.toString('base64url')
+  });
+  return `${header.slice(0, -1)},"command":${commandJson}}`;
+}
+
+/**
+ * Sign every message of a batch for the sfu_commands topic
+ * @param {Array} messages - Kafka messages with key (target SFU ID) and JSON string value
+ * @param {string} issuer - Name of the sending service
+ * @returns {Array} - Messages with sealed values
+ */
+function sealSfuCommandMessages(messages, issuer) {
+  return messages.map(message => ({
+    ...message,
+    value: sealSfuCommand(String(message.key), String(message.value), issuer)
+  }));
+}
+
+module.exports = {
+  sealSfuCommand,
+  sealSfuCommandMessages
+};
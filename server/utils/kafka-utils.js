@@ -1,4 +1,5 @@
 const { Kafka } = require('kafkajs');
+const { sealSfuCommandMessages } = require('./kafka-envelope.js');
 
 // Kafka configuration
 const KAFKA_CONFIG = {
@@ -24,7 +25,11 @@ async function sendKafkaMessage(topic, messages, timeoutMs = 3000) {
     try {
         await Promise.race([
             producer.connect().then(() => 
-                producer.send({ topic, messages })
+                producer.send({
+                    topic,
+                    // SFUs verify the signature of every command addressed to them
+                    messages: topic === 'sfu_commands' ? sealSfuCommandMessages(messages, KAFKA_CONFIG.clientId) : messages
+                })
             ).finally(() => producer.disconnect()),
             timeoutPromise
         ]);